@@ -1,9 +1,48 @@
 package gorse
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 // Client defines the minimal integration seam for Gorse retrieval/ranking.
 // Implementations should include deterministic tie-breaker handling before returning.
 type Client interface {
 	Recommend(ctx context.Context, userID string, n int) ([]string, error)
 }
+
+// FeedbackWriter inserts user feedback so Gorse can retrain on it.
+type FeedbackWriter interface {
+	InsertFeedback(ctx context.Context, feedback []Feedback) error
+}
+
+// Feedback mirrors the Gorse feedback wire format.
+type Feedback struct {
+	FeedbackType string `json:"FeedbackType"`
+	UserID       string `json:"UserId"`
+	ItemID       string `json:"ItemId"`
+	Timestamp    string `json:"Timestamp"`
+}
+
+// ErrNotConfigured is returned by writes to a client without a Gorse URL.
+var ErrNotConfigured = errors.New("gorse_not_configured")
+
+// StatusError reports a non-2xx Gorse response.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("gorse_status_%d", e.Code)
+}
+
+// Retryable reports whether a Gorse call that failed with err may succeed on
+// retry. Transport errors, 429 and 5xx are retryable; other 4xx are not.
+func Retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code == 429 || se.Code >= 500
+	}
+	return err != nil
+}
@@ -1,12 +1,13 @@
 package gorse
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"sort"
 	"time"
 )
 
@@ -30,7 +31,26 @@ func (c *HTTPClient) Recommend(ctx context.Context, userID string, n int) ([]str
 	if c.baseURL == "" || userID == "" || n <= 0 {
 		return nil, nil
 	}
-	u := fmt.Sprintf("%s/api/recommend/%s?n=%d", c.baseURL, url.PathEscape(userID), n)
+	return c.fetchIDs(ctx, fmt.Sprintf("%s/api/recommend/%s?n=%d", c.baseURL, url.PathEscape(userID), n))
+}
+
+// Popular returns Gorse's non-personalized popular items, in upstream order.
+func (c *HTTPClient) Popular(ctx context.Context, n int) ([]string, error) {
+	if c.baseURL == "" || n <= 0 {
+		return nil, nil
+	}
+	return c.fetchIDs(ctx, fmt.Sprintf("%s/api/popular?n=%d", c.baseURL, n))
+}
+
+// Latest returns Gorse's most recently inserted items, in upstream order.
+func (c *HTTPClient) Latest(ctx context.Context, n int) ([]string, error) {
+	if c.baseURL == "" || n <= 0 {
+		return nil, nil
+	}
+	return c.fetchIDs(ctx, fmt.Sprintf("%s/api/latest?n=%d", c.baseURL, n))
+}
+
+func (c *HTTPClient) fetchIDs(ctx context.Context, u string) ([]string, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return nil, err
@@ -44,7 +64,7 @@ func (c *HTTPClient) Recommend(ctx context.Context, userID string, n int) ([]str
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("gorse_status_%d", resp.StatusCode)
+		return nil, &StatusError{Code: resp.StatusCode}
 	}
 
 	var raw any
@@ -83,7 +103,7 @@ func (c *HTTPClient) Recommend(ctx context.Context, userID string, n int) ([]str
 		}
 	}
 
-	// Ensure deterministic tie behavior even if upstream emits duplicates.
+	// Keep Gorse's ranking order; duplicates keep their first position.
 	dedup := map[string]struct{}{}
 	out := make([]string, 0, len(ids))
 	for _, id := range ids {
@@ -93,12 +113,48 @@ func (c *HTTPClient) Recommend(ctx context.Context, userID string, n int) ([]str
 		dedup[id] = struct{}{}
 		out = append(out, id)
 	}
-	sort.Strings(out)
 	return out, nil
 }
 
+// InsertFeedback posts feedback to Gorse. It returns ErrNotConfigured when
+// the client has no base URL, so callers never count unsent rows as written.
+func (c *HTTPClient) InsertFeedback(ctx context.Context, feedback []Feedback) error {
+	if c.baseURL == "" {
+		return ErrNotConfigured
+	}
+	if len(feedback) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(feedback)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/feedback", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 400 {
+		return &StatusError{Code: resp.StatusCode}
+	}
+	return nil
+}
+
 type NoopClient struct{}
 
 func (NoopClient) Recommend(context.Context, string, int) ([]string, error) {
 	return nil, nil
 }
+
+func (NoopClient) InsertFeedback(context.Context, []Feedback) error {
+	return nil
+}
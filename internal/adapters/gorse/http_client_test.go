@@ -0,0 +1,24 @@
+package gorse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRecommendPreservesUpstreamOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`["zeta","alpha","zeta","mid"]`))
+	}))
+	defer srv.Close()
+
+	ids, err := NewHTTPClient(srv.URL, "").Recommend(context.Background(), "u1", 4)
+	if err != nil {
+		t.Fatalf("recommend: %v", err)
+	}
+	if want := []string{"zeta", "alpha", "mid"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,332 @@
+package gorse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourcePrimary names the personalized recommend call in a Trace.
+const SourcePrimary = "primary"
+
+// Attempt records how one retrieval source fared. Outcome is "ok",
+// "degraded", "empty" (answered with no items) or "circuit_open" (not called
+// because the breaker is open).
+type Attempt struct {
+	Source  string
+	Outcome string
+	Err     string
+}
+
+// TracedClient is a Client that also reports which sources answered. The
+// trace always starts with the primary source, followed by each fallback
+// tried in order.
+type TracedClient interface {
+	Client
+	RecommendTraced(ctx context.Context, userID string, n int) ([]string, []Attempt, error)
+}
+
+// RecommendTraced calls c and returns its trace, synthesizing a single primary
+// attempt for clients that do not trace themselves.
+func RecommendTraced(ctx context.Context, c Client, userID string, n int) ([]string, []Attempt, error) {
+	if tc, ok := c.(TracedClient); ok {
+		return tc.RecommendTraced(ctx, userID, n)
+	}
+	ids, err := c.Recommend(ctx, userID, n)
+	if err != nil {
+		return nil, []Attempt{{Source: SourcePrimary, Outcome: "degraded", Err: err.Error()}}, err
+	}
+	return ids, []Attempt{{Source: SourcePrimary, Outcome: "ok"}}, nil
+}
+
+// ListSource serves the non-personalized lists used as fallbacks.
+type ListSource interface {
+	Popular(ctx context.Context, n int) ([]string, error)
+	Latest(ctx context.Context, n int) ([]string, error)
+}
+
+type ResilientConfig struct {
+	MaxAttempts    int
+	BaseBackoff    time.Duration
+	MaxBackoff     time.Duration
+	AttemptTimeout time.Duration
+	// Deadline bounds a whole retrieval: primary retries and fallbacks. When
+	// Gorse-backed fallbacks are configured the primary retries stop one
+	// AttemptTimeout early so a fallback call still fits.
+	Deadline         time.Duration
+	BreakerFailures  int
+	BreakerOpenFor   time.Duration
+	LastGoodCapacity int
+	// Fallbacks are tried in order when the primary call fails or the breaker
+	// is open: "popular", "latest" or "last_good".
+	Fallbacks []string
+}
+
+type fallback struct {
+	name  string
+	fetch func(ctx context.Context, userID string, n int) ([]string, error)
+	// upstream fallbacks call Gorse, so they share its timeout and breaker:
+	// they are skipped while it rejects calls and their outcome is reported
+	// to it like a primary attempt.
+	upstream bool
+}
+
+// ResilientClient wraps a Client with bounded jittered retries, a circuit
+// breaker and ordered fallbacks.
+type ResilientClient struct {
+	primary   Client
+	cfg       ResilientConfig
+	breaker   *Breaker
+	fallbacks []fallback
+
+	mu       sync.Mutex
+	lastGood map[string][]string
+	order    []string
+}
+
+func NewResilientClient(primary Client, cfg ResilientConfig) (*ResilientClient, error) {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = 50 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 500 * time.Millisecond
+	}
+	if cfg.LastGoodCapacity <= 0 {
+		cfg.LastGoodCapacity = 10000
+	}
+	c := &ResilientClient{
+		primary:  primary,
+		cfg:      cfg,
+		breaker:  NewBreaker(cfg.BreakerFailures, cfg.BreakerOpenFor),
+		lastGood: map[string][]string{},
+	}
+	lists, _ := primary.(ListSource)
+	for _, raw := range cfg.Fallbacks {
+		name := strings.TrimSpace(raw)
+		switch name {
+		case "":
+			continue
+		case "popular", "latest":
+			if lists == nil {
+				return nil, fmt.Errorf("gorse fallback %q needs a client with popular/latest endpoints", name)
+			}
+			fetch := lists.Popular
+			if name == "latest" {
+				fetch = lists.Latest
+			}
+			c.fallbacks = append(c.fallbacks, fallback{name: name, upstream: true, fetch: func(ctx context.Context, _ string, n int) ([]string, error) {
+				return fetch(ctx, n)
+			}})
+		case "last_good":
+			c.fallbacks = append(c.fallbacks, fallback{name: name, fetch: c.loadLastGood})
+		default:
+			return nil, fmt.Errorf("unknown gorse fallback %q", name)
+		}
+	}
+	return c, nil
+}
+
+type lastGoodKey struct{}
+
+// WithoutLastGood marks ctx so a ResilientClient answering on it leaves its
+// last_good cache untouched. Read-only callers such as shadow and what-if
+// runs use it so their traffic does not change what later fallbacks serve.
+func WithoutLastGood(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lastGoodKey{}, true)
+}
+
+func (c *ResilientClient) BreakerState() string {
+	return c.breaker.State()
+}
+
+func (c *ResilientClient) Recommend(ctx context.Context, userID string, n int) ([]string, error) {
+	ids, _, err := c.RecommendTraced(ctx, userID, n)
+	return ids, err
+}
+
+func (c *ResilientClient) RecommendTraced(ctx context.Context, userID string, n int) ([]string, []Attempt, error) {
+	parent := ctx
+	if c.cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Deadline)
+		defer cancel()
+	}
+	primaryCtx, cancelPrimary := c.primaryContext(ctx)
+	ids, primary, err := c.recommendPrimary(parent, primaryCtx, userID, n)
+	cancelPrimary()
+	trace := []Attempt{primary}
+	if err == nil {
+		if skip, _ := ctx.Value(lastGoodKey{}).(bool); !skip {
+			c.storeLastGood(userID, ids)
+		}
+		return ids, trace, nil
+	}
+	for _, fb := range c.fallbacks {
+		if fb.upstream && !c.breaker.Allow() {
+			// Gorse is known to be down; do not wait on it again.
+			trace = append(trace, Attempt{Source: fb.name, Outcome: "circuit_open"})
+			continue
+		}
+		fbIDs, fbErr := c.fetchFallback(ctx, fb, userID, n)
+		if fb.upstream {
+			c.report(parent, fbErr)
+		}
+		switch {
+		case fbErr != nil:
+			trace = append(trace, Attempt{Source: fb.name, Outcome: "degraded", Err: fbErr.Error()})
+		case len(fbIDs) == 0:
+			trace = append(trace, Attempt{Source: fb.name, Outcome: "empty"})
+		default:
+			trace = append(trace, Attempt{Source: fb.name, Outcome: "ok"})
+			return fbIDs, trace, nil
+		}
+	}
+	return nil, trace, err
+}
+
+// recommendPrimary calls Gorse under ctx, retrying retryable errors. It stops
+// retrying once parent, the caller's context, is done.
+func (c *ResilientClient) recommendPrimary(parent, ctx context.Context, userID string, n int) ([]string, Attempt, error) {
+	var lastErr error
+	for attempt := 0; attempt < c.cfg.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, c.backoff(attempt)); err != nil {
+				lastErr = err
+				break
+			}
+		}
+		if !c.breaker.Allow() {
+			if lastErr == nil {
+				return nil, Attempt{Source: SourcePrimary, Outcome: "circuit_open"}, errCircuitOpen
+			}
+			break
+		}
+		ids, err := c.callPrimary(ctx, userID, n)
+		c.report(parent, err)
+		if err == nil {
+			return ids, Attempt{Source: SourcePrimary, Outcome: "ok"}, nil
+		}
+		lastErr = err
+		if !Retryable(err) || parent.Err() != nil {
+			break
+		}
+	}
+	return nil, Attempt{Source: SourcePrimary, Outcome: "degraded", Err: lastErr.Error()}, lastErr
+}
+
+var errCircuitOpen = errors.New("gorse circuit open")
+
+// report records the outcome of a Gorse call the breaker allowed. A
+// non-retryable error still means the upstream answered, so it counts as
+// healthy even if the request was bad. Calls cut short because the caller's
+// context was canceled say nothing about Gorse and are not recorded.
+func (c *ResilientClient) report(parent context.Context, err error) {
+	if parent.Err() != nil {
+		c.breaker.Release()
+		return
+	}
+	if err != nil && Retryable(err) {
+		c.breaker.Failure()
+		return
+	}
+	c.breaker.Success()
+}
+
+func (c *ResilientClient) callPrimary(ctx context.Context, userID string, n int) ([]string, error) {
+	if c.cfg.AttemptTimeout <= 0 {
+		return c.primary.Recommend(ctx, userID, n)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, c.cfg.AttemptTimeout)
+	defer cancel()
+	return c.primary.Recommend(attemptCtx, userID, n)
+}
+
+// primaryContext reserves the end of the retrieval deadline for one
+// Gorse-backed fallback call. Without a deadline, or when the reserve would
+// leave the primary less than an attempt, ctx is returned as is.
+func (c *ResilientClient) primaryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || c.cfg.AttemptTimeout <= 0 || !c.hasUpstreamFallback() {
+		return ctx, func() {}
+	}
+	reserved := deadline.Add(-c.cfg.AttemptTimeout)
+	if time.Until(reserved) < c.cfg.AttemptTimeout {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, reserved)
+}
+
+func (c *ResilientClient) hasUpstreamFallback() bool {
+	for _, fb := range c.fallbacks {
+		if fb.upstream {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchFallback bounds Gorse-backed fallbacks by AttemptTimeout like primary
+// attempts; last_good is local and always answers.
+func (c *ResilientClient) fetchFallback(ctx context.Context, fb fallback, userID string, n int) ([]string, error) {
+	if !fb.upstream || c.cfg.AttemptTimeout <= 0 {
+		return fb.fetch(ctx, userID, n)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, c.cfg.AttemptTimeout)
+	defer cancel()
+	return fb.fetch(attemptCtx, userID, n)
+}
+
+// backoff doubles BaseBackoff per retry, capped at MaxBackoff, and picks a
+// uniformly random delay in [d/2, d].
+func (c *ResilientClient) backoff(attempt int) time.Duration {
+	d := c.cfg.BaseBackoff << (attempt - 1)
+	if d <= 0 || d > c.cfg.MaxBackoff {
+		d = c.cfg.MaxBackoff
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (c *ResilientClient) storeLastGood(userID string, ids []string) {
+	if userID == "" || len(ids) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.lastGood[userID]; !ok {
+		c.order = append(c.order, userID)
+		if len(c.order) > c.cfg.LastGoodCapacity {
+			delete(c.lastGood, c.order[0])
+			c.order = c.order[1:]
+		}
+	}
+	c.lastGood[userID] = append([]string(nil), ids...)
+}
+
+func (c *ResilientClient) loadLastGood(_ context.Context, userID string, n int) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := c.lastGood[userID]
+	if n > 0 && len(ids) > n {
+		ids = ids[:n]
+	}
+	return append([]string(nil), ids...), nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,335 @@
+package gorse
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected closed after one failure")
+	}
+	b.Failure()
+	if b.State() != BreakerOpen || b.Allow() {
+		t.Fatalf("expected open breaker to reject calls")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() || b.State() != BreakerHalfOpen {
+		t.Fatalf("expected half-open probe after open window")
+	}
+	if b.Allow() {
+		t.Fatalf("expected only one half-open probe")
+	}
+	b.Failure()
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected failed probe to re-open")
+	}
+
+	now = now.Add(time.Minute)
+	b.Allow()
+	b.Success()
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected successful probe to close")
+	}
+}
+
+func newGorseServer(t *testing.T, recommendStatus *int32, calls *int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/popular":
+			_, _ = w.Write([]byte(`[{"Id":"p1"},{"Id":"p2"}]`))
+		case "/api/latest":
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			atomic.AddInt32(calls, 1)
+			if status := atomic.LoadInt32(recommendStatus); status != http.StatusOK {
+				w.WriteHeader(int(status))
+				return
+			}
+			_, _ = w.Write([]byte(`["r2","r1"]`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResilientClientRetriesThenFallsBack(t *testing.T) {
+	status := int32(http.StatusServiceUnavailable)
+	var calls int32
+	srv := newGorseServer(t, &status, &calls)
+	c, err := NewResilientClient(NewHTTPClient(srv.URL, ""), ResilientConfig{
+		MaxAttempts:     3,
+		BaseBackoff:     time.Millisecond,
+		BreakerFailures: 10,
+		Fallbacks:       []string{"last_good", "latest", "popular"},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	ids, trace, err := c.RecommendTraced(context.Background(), "u1", 5)
+	if err != nil {
+		t.Fatalf("expected fallback to answer: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 primary attempts, got %d", calls)
+	}
+	if !reflect.DeepEqual(ids, []string{"p1", "p2"}) {
+		t.Fatalf("ids = %v", ids)
+	}
+	want := []Attempt{
+		{Source: SourcePrimary, Outcome: "degraded", Err: "gorse_status_503"},
+		{Source: "last_good", Outcome: "empty"},
+		{Source: "latest", Outcome: "empty"},
+		{Source: "popular", Outcome: "ok"},
+	}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("trace = %+v", trace)
+	}
+}
+
+func TestResilientClientServesLastGoodWhileCircuitOpen(t *testing.T) {
+	status := int32(http.StatusOK)
+	var calls int32
+	srv := newGorseServer(t, &status, &calls)
+	c, err := NewResilientClient(NewHTTPClient(srv.URL, ""), ResilientConfig{
+		MaxAttempts:     1,
+		BreakerFailures: 1,
+		BreakerOpenFor:  time.Hour,
+		Fallbacks:       []string{"last_good"},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if _, err := c.Recommend(context.Background(), "u1", 5); err != nil {
+		t.Fatalf("warm call: %v", err)
+	}
+
+	atomic.StoreInt32(&status, http.StatusBadGateway)
+	if _, _, err := c.RecommendTraced(context.Background(), "u1", 5); err != nil {
+		t.Fatalf("expected last_good fallback: %v", err)
+	}
+	if c.BreakerState() != BreakerOpen {
+		t.Fatalf("expected open breaker, got %s", c.BreakerState())
+	}
+
+	before := atomic.LoadInt32(&calls)
+	ids, trace, err := c.RecommendTraced(context.Background(), "u1", 5)
+	if err != nil || atomic.LoadInt32(&calls) != before {
+		t.Fatalf("expected no upstream call while open (err=%v)", err)
+	}
+	if trace[0].Outcome != "circuit_open" || trace[1] != (Attempt{Source: "last_good", Outcome: "ok"}) {
+		t.Fatalf("trace = %+v", trace)
+	}
+	if !reflect.DeepEqual(ids, []string{"r2", "r1"}) {
+		t.Fatalf("ids = %v", ids)
+	}
+}
+
+func TestResilientClientRejectsUnknownFallback(t *testing.T) {
+	if _, err := NewResilientClient(NoopClient{}, ResilientConfig{Fallbacks: []string{"popular"}}); err == nil {
+		t.Fatalf("expected error for list fallback without list source")
+	}
+	if _, err := NewResilientClient(NewHTTPClient("", ""), ResilientConfig{Fallbacks: []string{"nearest"}}); err == nil {
+		t.Fatalf("expected error for unknown fallback")
+	}
+}
+
+func TestRecommendTracedWrapsPlainClients(t *testing.T) {
+	_, trace, err := RecommendTraced(context.Background(), failingClient{}, "u1", 3)
+	if err == nil || len(trace) != 1 || trace[0].Outcome != "degraded" {
+		t.Fatalf("unexpected trace %+v err=%v", trace, err)
+	}
+}
+
+type failingClient struct{}
+
+func (failingClient) Recommend(context.Context, string, int) ([]string, error) {
+	return nil, errors.New("down")
+}
+
+func TestResilientClientBoundsHangingGorse(t *testing.T) {
+	var recommends, populars int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/popular" {
+			atomic.AddInt32(&populars, 1)
+			_, _ = w.Write([]byte(`["p1"]`))
+			return
+		}
+		atomic.AddInt32(&recommends, 1)
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	c, err := NewResilientClient(NewHTTPClient(srv.URL, ""), ResilientConfig{
+		MaxAttempts:     5,
+		BaseBackoff:     time.Millisecond,
+		AttemptTimeout:  50 * time.Millisecond,
+		Deadline:        200 * time.Millisecond,
+		BreakerFailures: 100,
+		Fallbacks:       []string{"popular"},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	start := time.Now()
+	ids, trace, err := c.RecommendTraced(context.Background(), "u1", 5)
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("retrieval took %s, want it bounded by the deadline", elapsed)
+	}
+	if err != nil || !reflect.DeepEqual(ids, []string{"p1"}) {
+		t.Fatalf("expected popular within the deadline, got %v %v (trace %+v)", ids, err, trace)
+	}
+	if n := atomic.LoadInt32(&recommends); n < 1 || n > 3 {
+		t.Fatalf("expected primary retries to fit before the fallback reserve, got %d", n)
+	}
+}
+
+func TestResilientClientSkipsUpstreamFallbacksWhileOpen(t *testing.T) {
+	status := int32(http.StatusBadGateway)
+	var calls int32
+	var populars int32
+	srv := newGorseServer(t, &status, &calls)
+	lists := countingLists{HTTPClient: NewHTTPClient(srv.URL, ""), populars: &populars}
+	c, err := NewResilientClient(lists, ResilientConfig{
+		MaxAttempts:     1,
+		BreakerFailures: 1,
+		BreakerOpenFor:  time.Hour,
+		Fallbacks:       []string{"popular", "last_good"},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	_, _, _ = c.RecommendTraced(context.Background(), "u1", 5)
+	before := atomic.LoadInt32(&populars)
+
+	_, trace, _ := c.RecommendTraced(context.Background(), "u1", 5)
+	if atomic.LoadInt32(&populars) != before {
+		t.Fatalf("expected no popular call while the breaker is open")
+	}
+	if trace[0].Outcome != "circuit_open" || trace[1] != (Attempt{Source: "popular", Outcome: "circuit_open"}) {
+		t.Fatalf("trace = %+v", trace)
+	}
+}
+
+type countingLists struct {
+	*HTTPClient
+	populars *int32
+}
+
+func (c countingLists) Popular(ctx context.Context, n int) ([]string, error) {
+	atomic.AddInt32(c.populars, 1)
+	return c.HTTPClient.Popular(ctx, n)
+}
+
+type stubLists struct {
+	popularErr error
+}
+
+func (stubLists) Recommend(context.Context, string, int) ([]string, error) {
+	return nil, &StatusError{Code: http.StatusBadGateway}
+}
+
+func (s stubLists) Popular(context.Context, int) ([]string, error) {
+	if s.popularErr != nil {
+		return nil, s.popularErr
+	}
+	return []string{"p1"}, nil
+}
+
+func (stubLists) Latest(context.Context, int) ([]string, error) {
+	return nil, nil
+}
+
+func TestResilientClientReportsFallbackOutcomesToBreaker(t *testing.T) {
+	cfg := ResilientConfig{MaxAttempts: 1, BreakerFailures: 2, BreakerOpenFor: time.Hour, Fallbacks: []string{"popular"}}
+
+	failing, err := NewResilientClient(stubLists{popularErr: &StatusError{Code: http.StatusServiceUnavailable}}, cfg)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	_, trace, _ := failing.RecommendTraced(context.Background(), "u1", 5)
+	if trace[1].Outcome != "degraded" || failing.BreakerState() != BreakerOpen {
+		t.Fatalf("expected a failing popular call to trip the breaker, got %s (trace %+v)", failing.BreakerState(), trace)
+	}
+
+	working, err := NewResilientClient(stubLists{}, cfg)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if ids, _, err := working.RecommendTraced(context.Background(), "u1", 5); err != nil || !reflect.DeepEqual(ids, []string{"p1"}) {
+			t.Fatalf("expected popular fallback, got %v %v", ids, err)
+		}
+	}
+	if working.BreakerState() != BreakerClosed {
+		t.Fatalf("expected working popular calls to keep the breaker closed, got %s", working.BreakerState())
+	}
+}
+
+func TestResilientClientIgnoresCallerCancellation(t *testing.T) {
+	var recommends int32
+	started := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/popular" {
+			_, _ = w.Write([]byte(`["p1"]`))
+			return
+		}
+		atomic.AddInt32(&recommends, 1)
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	c, err := NewResilientClient(NewHTTPClient(srv.URL, ""), ResilientConfig{
+		MaxAttempts:     3,
+		BaseBackoff:     time.Millisecond,
+		BreakerFailures: 1,
+		BreakerOpenFor:  time.Hour,
+		Fallbacks:       []string{"popular"},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, trace, _ := c.RecommendTraced(ctx, "u1", 5)
+	if c.BreakerState() != BreakerClosed {
+		t.Fatalf("expected caller cancellation to leave the breaker closed, got %s (trace %+v)", c.BreakerState(), trace)
+	}
+	if n := atomic.LoadInt32(&recommends); n != 1 {
+		t.Fatalf("expected no retries after cancellation, got %d calls", n)
+	}
+
+	// A canceled half-open probe hands its slot back instead of re-opening.
+	now := time.Now()
+	c.breaker.now = func() time.Time { return now }
+	c.breaker.Failure()
+	now = now.Add(time.Hour)
+	if !c.breaker.Allow() {
+		t.Fatalf("expected a half-open probe")
+	}
+	c.breaker.Release()
+	done, stop := context.WithCancel(context.Background())
+	stop()
+	_, _, _ = c.RecommendTraced(done, "u1", 5)
+	if c.BreakerState() != BreakerHalfOpen || !c.breaker.Allow() {
+		t.Fatalf("expected the half-open breaker to be unchanged, got %s", c.BreakerState())
+	}
+}
@@ -0,0 +1,1115 @@
+package gorules
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Expressions are the subset of the GoRules ZEN expression language used by
+// decision models. They are parsed once into a tree and interpreted against
+// JSON-shaped values (nil, bool, float64, string, []any, map[string]any);
+// nothing is compiled or evaluated as code at runtime.
+//
+// Supported: number, string, bool and null literals; field access with dots
+// and brackets; array literals; ranges [a..b], (a..b), [a..b) and (a..b];
+// arithmetic (+ - * / % ^), comparisons, and/or/not (also && || !), in and
+// not in, the ?? and ?: operators, and the builtin functions in builtins.
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+var twoCharOps = []string{"..", "==", "!=", "<=", ">=", "&&", "||", "??"}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isDigit(c):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			if i+1 < len(src) && src[i] == '.' && isDigit(src[i+1]) {
+				i++
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number at %d", start)
+			}
+			toks = append(toks, token{kind: tokNumber, text: src[start:i], num: n, pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			var b strings.Builder
+			i++
+			closed := false
+			for i < len(src) {
+				ch := src[i]
+				if ch == c {
+					closed = true
+					i++
+					break
+				}
+				if ch == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(src[i])
+					}
+					i++
+					continue
+				}
+				b.WriteByte(ch)
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			toks = append(toks, token{kind: tokString, text: b.String(), pos: start})
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start})
+		default:
+			op := ""
+			for _, two := range twoCharOps {
+				if strings.HasPrefix(src[i:], two) {
+					op = two
+					break
+				}
+			}
+			if op == "" {
+				if !strings.ContainsRune("+-*/%^<>!?:()[],.", rune(c)) {
+					return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+				}
+				op = string(c)
+			}
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// env is what an expression is evaluated against: the node input as scope
+// and, in unary tests and expression nodes, the $ reference.
+type env struct {
+	scope  map[string]any
+	dollar any
+}
+
+type node interface {
+	eval(e env) (any, error)
+}
+
+type (
+	literal struct{ v any }
+	ident   struct{ name string }
+	dollar  struct{}
+	member  struct {
+		obj  node
+		name string
+	}
+	index struct{ obj, idx node }
+	unary struct {
+		op string
+		x  node
+	}
+	binary struct {
+		op   string
+		l, r node
+	}
+	ternary  struct{ cond, a, b node }
+	listNode struct{ items []node }
+	rangeLit struct {
+		lo, hi       node
+		loInc, hiInc bool
+	}
+	inNode struct {
+		x, coll node
+		negate  bool
+	}
+	call struct {
+		fn   string
+		args []node
+	}
+)
+
+// rangeValue is an interval of numbers, the value of a range literal.
+type rangeValue struct {
+	lo, hi       float64
+	loInc, hiInc bool
+}
+
+func (r rangeValue) contains(x float64) bool {
+	if x < r.lo || (x == r.lo && !r.loInc) {
+		return false
+	}
+	if x > r.hi || (x == r.hi && !r.hiInc) {
+		return false
+	}
+	return true
+}
+
+type parser struct {
+	toks       []token
+	pos        int
+	usesDollar bool
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the current token is the operator or keyword s.
+func (p *parser) is(s string) bool {
+	t := p.peek()
+	return (t.kind == tokOp || t.kind == tokIdent) && t.text == s
+}
+
+func (p *parser) isAt(offset int, s string) bool {
+	if p.pos+offset >= len(p.toks) {
+		return false
+	}
+	t := p.toks[p.pos+offset]
+	return (t.kind == tokOp || t.kind == tokIdent) && t.text == s
+}
+
+func (p *parser) expect(s string) error {
+	if !p.is(s) {
+		return p.errorf("expected %q", s)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	t := p.peek()
+	at := t.text
+	if t.kind == tokEOF {
+		at = "end of expression"
+	}
+	return fmt.Errorf("%s at %d (%s)", fmt.Sprintf(format, args...), t.pos, at)
+}
+
+// parseExpression parses a complete expression.
+func parseExpression(src string) (node, bool, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, false, err
+	}
+	p := &parser{toks: toks}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, false, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, false, p.errorf("unexpected token")
+	}
+	return n, p.usesDollar, nil
+}
+
+func (p *parser) parseExpr() (node, error) {
+	cond, err := p.parseNullish()
+	if err != nil {
+		return nil, err
+	}
+	if !p.is("?") {
+		return cond, nil
+	}
+	p.next()
+	a, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return ternary{cond: cond, a: a, b: b}, nil
+}
+
+func (p *parser) parseNullish() (node, error) {
+	l, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("??") {
+		p.next()
+		r, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: "??", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("or") || p.is("||") {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: "or", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("and") || p.is("&&") {
+		p.next()
+		r, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: "and", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseCompare() (node, error) {
+	l, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.is(op) {
+			p.next()
+			r, err := p.parseAdd()
+			if err != nil {
+				return nil, err
+			}
+			return binary{op: op, l: l, r: r}, nil
+		}
+	}
+	negate := false
+	if p.is("not") && p.isAt(1, "in") {
+		p.next()
+		negate = true
+	}
+	if p.is("in") {
+		p.next()
+		r, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{x: l, coll: r, negate: negate}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parseAdd() (node, error) {
+	l, err := p.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+") || p.is("-") {
+		op := p.next().text
+		r, err := p.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseMul() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*") || p.is("/") || p.is("%") {
+		op := p.next().text
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.is("-") || p.is("+") || p.is("!") || (p.is("not") && !p.isAt(1, "in")) {
+		op := p.next().text
+		if op == "!" {
+			op = "not"
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{op: op, x: x}, nil
+	}
+	return p.parsePow()
+}
+
+func (p *parser) parsePow() (node, error) {
+	l, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	if p.is("^") {
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return binary{op: "^", l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.is("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, p.errorf("expected field name")
+			}
+			n = member{obj: n, name: t.text}
+		case p.is("["):
+			p.next()
+			idx, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = index{obj: n, idx: idx}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.next()
+		return literal{v: t.num}, nil
+	case tokString:
+		p.next()
+		return literal{v: t.text}, nil
+	case tokIdent:
+		p.next()
+		switch t.text {
+		case "true":
+			return literal{v: true}, nil
+		case "false":
+			return literal{v: false}, nil
+		case "null":
+			return literal{v: nil}, nil
+		case "$":
+			p.usesDollar = true
+			return dollar{}, nil
+		}
+		if p.is("(") {
+			if _, ok := builtins[t.text]; !ok {
+				return nil, fmt.Errorf("unknown function %q at %d", t.text, t.pos)
+			}
+			p.next()
+			var args []node
+			for !p.is(")") {
+				if len(args) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				arg, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+			}
+			p.next()
+			return call{fn: t.text, args: args}, nil
+		}
+		return ident{name: t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			p.next()
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if p.is("..") {
+				return p.parseRangeTail(e, false)
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		case "[":
+			p.next()
+			if p.is("]") {
+				p.next()
+				return listNode{}, nil
+			}
+			first, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if p.is("..") {
+				return p.parseRangeTail(first, true)
+			}
+			items := []node{first}
+			for p.is(",") {
+				p.next()
+				item, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			return listNode{items: items}, nil
+		}
+	}
+	return nil, p.errorf("unexpected token")
+}
+
+func (p *parser) parseRangeTail(lo node, loInc bool) (node, error) {
+	p.next()
+	hi, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.is("]"):
+		p.next()
+		return rangeLit{lo: lo, hi: hi, loInc: loInc, hiInc: true}, nil
+	case p.is(")"):
+		p.next()
+		return rangeLit{lo: lo, hi: hi, loInc: loInc, hiInc: false}, nil
+	}
+	return nil, p.errorf("expected ] or ) to close range")
+}
+
+func (n literal) eval(env) (any, error) { return n.v, nil }
+
+func (n ident) eval(e env) (any, error) { return e.scope[n.name], nil }
+
+func (dollar) eval(e env) (any, error) { return e.dollar, nil }
+
+func (n member) eval(e env) (any, error) {
+	obj, err := n.obj.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := obj.(map[string]any); ok {
+		return m[n.name], nil
+	}
+	return nil, nil
+}
+
+func (n index) eval(e env) (any, error) {
+	obj, err := n.obj.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := n.idx.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch o := obj.(type) {
+	case map[string]any:
+		if key, ok := idx.(string); ok {
+			return o[key], nil
+		}
+	case []any:
+		if f, ok := idx.(float64); ok && f == math.Trunc(f) {
+			i := int(f)
+			if i < 0 {
+				i += len(o)
+			}
+			if i >= 0 && i < len(o) {
+				return o[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (n unary) eval(e env) (any, error) {
+	x, err := n.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "not" {
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("not: expected boolean, got %s", typeName(x))
+		}
+		return !b, nil
+	}
+	f, ok := x.(float64)
+	if !ok {
+		return nil, fmt.Errorf("unary %s: expected number, got %s", n.op, typeName(x))
+	}
+	if n.op == "-" {
+		return -f, nil
+	}
+	return f, nil
+}
+
+func (n binary) eval(e env) (any, error) {
+	l, err := n.l.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "??":
+		if l != nil {
+			return l, nil
+		}
+		return n.r.eval(e)
+	case "and", "or":
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected boolean, got %s", n.op, typeName(l))
+		}
+		if (n.op == "and" && !lb) || (n.op == "or" && lb) {
+			return lb, nil
+		}
+		r, err := n.r.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected boolean, got %s", n.op, typeName(r))
+		}
+		return rb, nil
+	}
+	r, err := n.r.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "<", "<=", ">", ">=":
+		return compare(n.op, l, r)
+	case "+":
+		if ls, ok := l.(string); ok {
+			if rs, ok := r.(string); ok {
+				return ls + rs, nil
+			}
+		}
+	}
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%s: unsupported operands %s and %s", n.op, typeName(l), typeName(r))
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(lf, rf), nil
+	case "^":
+		return math.Pow(lf, rf), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func (n ternary) eval(e env) (any, error) {
+	c, err := n.cond.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := c.(bool)
+	if !ok {
+		return nil, fmt.Errorf("?: expected boolean condition, got %s", typeName(c))
+	}
+	if b {
+		return n.a.eval(e)
+	}
+	return n.b.eval(e)
+}
+
+func (n listNode) eval(e env) (any, error) {
+	out := make([]any, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (n rangeLit) eval(e env) (any, error) {
+	lo, err := n.lo.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := n.hi.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	lf, lok := lo.(float64)
+	hf, hok := hi.(float64)
+	if !lok || !hok {
+		return nil, fmt.Errorf("range bounds must be numbers")
+	}
+	return rangeValue{lo: lf, hi: hf, loInc: n.loInc, hiInc: n.hiInc}, nil
+}
+
+func (n inNode) eval(e env) (any, error) {
+	x, err := n.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	coll, err := n.coll.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	found, err := contains(coll, x)
+	if err != nil {
+		return nil, err
+	}
+	return found != n.negate, nil
+}
+
+// contains reports whether x is a member of coll: an element of an array, a
+// number within a range, a key of an object or a substring of a string.
+func contains(coll, x any) (bool, error) {
+	switch c := coll.(type) {
+	case []any:
+		for _, item := range c {
+			if equal(item, x) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case rangeValue:
+		f, ok := x.(float64)
+		return ok && c.contains(f), nil
+	case map[string]any:
+		key, ok := x.(string)
+		if !ok {
+			return false, nil
+		}
+		_, found := c[key]
+		return found, nil
+	case string:
+		s, ok := x.(string)
+		return ok && strings.Contains(c, s), nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("in: unsupported collection %s", typeName(coll))
+}
+
+func (n call) eval(e env) (any, error) {
+	args := make([]any, 0, len(n.args))
+	for _, a := range n.args {
+		v, err := a.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	return builtins[n.fn](args)
+}
+
+func equal(a, b any) bool {
+	if ra, ok := a.(rangeValue); ok {
+		rb, ok := b.(rangeValue)
+		return ok && ra == rb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(op string, l, r any) (bool, error) {
+	var c int
+	switch lv := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return false, fmt.Errorf("%s: cannot compare number with %s", op, typeName(r))
+		}
+		switch {
+		case lv < rv:
+			c = -1
+		case lv > rv:
+			c = 1
+		}
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return false, fmt.Errorf("%s: cannot compare string with %s", op, typeName(r))
+		}
+		c = strings.Compare(lv, rv)
+	default:
+		// Comparisons involving null are false rather than errors, so a
+		// missing field simply fails an ordering test.
+		if l == nil || r == nil {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: cannot compare %s", op, typeName(l))
+	}
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case rangeValue:
+		return "range"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+type builtin func(args []any) (any, error)
+
+var builtins map[string]builtin
+
+func init() {
+	builtins = map[string]builtin{
+		"len": func(args []any) (any, error) {
+			if err := arity("len", args, 1); err != nil {
+				return nil, err
+			}
+			switch v := args[0].(type) {
+			case string:
+				return float64(len([]rune(v))), nil
+			case []any:
+				return float64(len(v)), nil
+			case map[string]any:
+				return float64(len(v)), nil
+			}
+			return nil, fmt.Errorf("len: unsupported %s", typeName(args[0]))
+		},
+		"upper":      stringFn("upper", strings.ToUpper),
+		"lower":      stringFn("lower", strings.ToLower),
+		"trim":       stringFn("trim", strings.TrimSpace),
+		"contains":   stringPredicate("contains", strings.Contains),
+		"startsWith": stringPredicate("startsWith", strings.HasPrefix),
+		"endsWith":   stringPredicate("endsWith", strings.HasSuffix),
+		"abs":        numberFn("abs", math.Abs),
+		"floor":      numberFn("floor", math.Floor),
+		"ceil":       numberFn("ceil", math.Ceil),
+		"round":      numberFn("round", math.Round),
+		"min":        aggregateFn("min", func(xs []float64) float64 { sort.Float64s(xs); return xs[0] }),
+		"max":        aggregateFn("max", func(xs []float64) float64 { sort.Float64s(xs); return xs[len(xs)-1] }),
+		"sum": aggregateFn("sum", func(xs []float64) float64 {
+			var s float64
+			for _, x := range xs {
+				s += x
+			}
+			return s
+		}),
+		"avg": aggregateFn("avg", func(xs []float64) float64 {
+			var s float64
+			for _, x := range xs {
+				s += x
+			}
+			return s / float64(len(xs))
+		}),
+		"string": func(args []any) (any, error) {
+			if err := arity("string", args, 1); err != nil {
+				return nil, err
+			}
+			switch v := args[0].(type) {
+			case string:
+				return v, nil
+			case float64:
+				return strconv.FormatFloat(v, 'f', -1, 64), nil
+			case bool:
+				return strconv.FormatBool(v), nil
+			case nil:
+				return "null", nil
+			}
+			return nil, fmt.Errorf("string: unsupported %s", typeName(args[0]))
+		},
+		"number": func(args []any) (any, error) {
+			if err := arity("number", args, 1); err != nil {
+				return nil, err
+			}
+			switch v := args[0].(type) {
+			case float64:
+				return v, nil
+			case string:
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					return nil, fmt.Errorf("number: %q is not numeric", v)
+				}
+				return f, nil
+			case bool:
+				if v {
+					return 1.0, nil
+				}
+				return 0.0, nil
+			}
+			return nil, fmt.Errorf("number: unsupported %s", typeName(args[0]))
+		},
+	}
+}
+
+func arity(name string, args []any, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("%s: expected %d argument(s), got %d", name, n, len(args))
+	}
+	return nil
+}
+
+func stringFn(name string, f func(string) string) builtin {
+	return func(args []any) (any, error) {
+		if err := arity(name, args, 1); err != nil {
+			return nil, err
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected string, got %s", name, typeName(args[0]))
+		}
+		return f(s), nil
+	}
+}
+
+func stringPredicate(name string, f func(string, string) bool) builtin {
+	return func(args []any) (any, error) {
+		if err := arity(name, args, 2); err != nil {
+			return nil, err
+		}
+		if name == "contains" {
+			if _, ok := args[0].([]any); ok {
+				return contains(args[0], args[1])
+			}
+		}
+		s, ok1 := args[0].(string)
+		sub, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%s: expected strings", name)
+		}
+		return f(s, sub), nil
+	}
+}
+
+func numberFn(name string, f func(float64) float64) builtin {
+	return func(args []any) (any, error) {
+		if err := arity(name, args, 1); err != nil {
+			return nil, err
+		}
+		x, ok := args[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected number, got %s", name, typeName(args[0]))
+		}
+		return f(x), nil
+	}
+}
+
+// aggregateFn accepts either one array argument or the numbers themselves.
+func aggregateFn(name string, f func([]float64) float64) builtin {
+	return func(args []any) (any, error) {
+		if len(args) == 1 {
+			if xs, ok := args[0].([]any); ok {
+				args = xs
+			}
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s: expected at least one number", name)
+		}
+		xs := make([]float64, 0, len(args))
+		for _, a := range args {
+			x, ok := a.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected numbers, got %s", name, typeName(a))
+			}
+			xs = append(xs, x)
+		}
+		return f(xs), nil
+	}
+}
+
+// unaryTest is a compiled decision table input cell, tested against the
+// value of the column's field. An empty cell or "-" matches anything. A cell
+// starting with a comparison operator compares against the value ("> 5");
+// a cell referencing $ must evaluate to a boolean; otherwise the cell is a
+// comma-separated list of candidates and matches when the value equals one of
+// them, falls within a range or is an element of an array.
+type unaryTest struct {
+	src        string
+	always     bool
+	usesDollar bool
+	items      []node
+}
+
+func compileUnaryTest(src string) (*unaryTest, error) {
+	src = strings.TrimSpace(src)
+	if src == "" || src == "-" {
+		return &unaryTest{src: src, always: true}, nil
+	}
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	if toks[0].kind == tokOp {
+		switch toks[0].text {
+		case "<", "<=", ">", ">=", "==", "!=":
+			toks = append([]token{{kind: tokIdent, text: "$"}}, toks...)
+		}
+	}
+	p := &parser{toks: toks}
+	var items []node
+	for {
+		item, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	if p.usesDollar && len(items) > 1 {
+		return nil, fmt.Errorf("$ cannot be used in a list of values")
+	}
+	return &unaryTest{src: src, usesDollar: p.usesDollar, items: items}, nil
+}
+
+func (u *unaryTest) match(scope map[string]any, value any) (bool, error) {
+	if u.always {
+		return true, nil
+	}
+	e := env{scope: scope, dollar: value}
+	if u.usesDollar {
+		v, err := u.items[0].eval(e)
+		if err != nil {
+			return false, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return false, fmt.Errorf("unary test %q: expected boolean, got %s", u.src, typeName(v))
+		}
+		return b, nil
+	}
+	for _, item := range u.items {
+		v, err := item.eval(e)
+		if err != nil {
+			return false, err
+		}
+		switch c := v.(type) {
+		case rangeValue, []any:
+			found, err := contains(c, value)
+			if err != nil {
+				return false, err
+			}
+			if found {
+				return true, nil
+			}
+		default:
+			if equal(v, value) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
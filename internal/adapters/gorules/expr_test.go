@@ -0,0 +1,111 @@
+package gorules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpressionEvaluation(t *testing.T) {
+	scope := map[string]any{
+		"plan":     "pro",
+		"seats":    12.0,
+		"tags":     []any{"beta", "ml"},
+		"customer": map[string]any{"region": "eu", "score": 0.75},
+	}
+	cases := []struct {
+		src  string
+		want any
+	}{
+		{"seats * 2 + 1", 25.0},
+		{"2 ^ 3 ^ 2", 512.0},
+		{"-seats % 5", -2.0},
+		{"plan == 'pro' and seats >= 10", true},
+		{"not (plan == 'pro') || false", false},
+		{"'beta' in tags", true},
+		{"'gamma' not in tags", true},
+		{"seats in [10..12]", true},
+		{"seats in [10..12)", false},
+		{"customer.region + '-' + upper(plan)", "eu-PRO"},
+		{"customer['score'] > 0.5 ? 'high' : 'low'", "high"},
+		{"tags[-1]", "ml"},
+		{"missing ?? 'default'", "default"},
+		{"missing.deeper == null", true},
+		{"max(1, seats, 3) + sum([1, 2])", 15.0},
+		{"len(tags) == 2 and startsWith(plan, 'p')", true},
+		{"string(seats) + string(number('3'))", "123"},
+	}
+	for _, c := range cases {
+		expr, _, err := parseExpression(c.src)
+		if err != nil {
+			t.Fatalf("parse %q: %v", c.src, err)
+		}
+		got, err := expr.eval(env{scope: scope})
+		if err != nil {
+			t.Fatalf("eval %q: %v", c.src, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%q = %#v, want %#v", c.src, got, c.want)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	for _, src := range []string{"1 +", "foo(1)", "'open", "(1..", "a ? b", "1 # 2"} {
+		if _, _, err := parseExpression(src); err == nil {
+			t.Fatalf("expected parse error for %q", src)
+		}
+	}
+	for _, src := range []string{"1 / 0", "'a' - 1", "1 and true", "not 1", "'a' < 1"} {
+		expr, _, err := parseExpression(src)
+		if err != nil {
+			t.Fatalf("parse %q: %v", src, err)
+		}
+		if _, err := expr.eval(env{}); err == nil {
+			t.Fatalf("expected evaluation error for %q", src)
+		}
+	}
+}
+
+func TestUnaryTests(t *testing.T) {
+	cases := []struct {
+		cell  string
+		value any
+		want  bool
+	}{
+		{"", "anything", true},
+		{"-", nil, true},
+		{"'pro'", "pro", true},
+		{"'pro', 'team'", "team", true},
+		{"'pro', 'team'", "free", false},
+		{"> 10", 11.0, true},
+		{">= 10", 9.0, false},
+		{"[1..5]", 5.0, true},
+		{"(1..5)", 5.0, false},
+		{"['a', 'b']", "b", true},
+		{"$ > 1 and $ < 3", 2.0, true},
+		{"contains($, 'pre')", "premium", true},
+		{"limit", 4.0, true},
+	}
+	scope := map[string]any{"limit": 4.0}
+	for _, c := range cases {
+		test, err := compileUnaryTest(c.cell)
+		if err != nil {
+			t.Fatalf("compile %q: %v", c.cell, err)
+		}
+		got, err := test.match(scope, c.value)
+		if err != nil {
+			t.Fatalf("match %q: %v", c.cell, err)
+		}
+		if got != c.want {
+			t.Fatalf("%q against %v = %v, want %v", c.cell, c.value, got, c.want)
+		}
+	}
+	if test, _ := compileUnaryTest("$ + 1"); test != nil {
+		if _, err := test.match(nil, 1.0); err == nil {
+			t.Fatalf("expected non-boolean $ test to fail")
+		}
+	}
+	if _, err := compileUnaryTest("$ > 1, 3"); err == nil {
+		t.Fatalf("expected $ in a value list to be rejected")
+	}
+}
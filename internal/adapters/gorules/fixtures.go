@@ -0,0 +1,121 @@
+package gorules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Fixture is a test case published with a policy version: an input and the
+// output fields the policy must produce for it. Expect keys may be dotted
+// paths; fields not named in Expect are not checked.
+type Fixture struct {
+	Name   string         `json:"name"`
+	Input  map[string]any `json:"input"`
+	Expect map[string]any `json:"expect"`
+}
+
+// Mismatch is one expected output field the policy got wrong.
+type Mismatch struct {
+	Field    string `json:"field"`
+	Expected any    `json:"expected"`
+	Actual   any    `json:"actual"`
+}
+
+// FixtureResult is the outcome of one fixture. Error is set when the policy
+// failed to evaluate at all.
+type FixtureResult struct {
+	Name       string     `json:"name"`
+	Passed     bool       `json:"passed"`
+	Mismatches []Mismatch `json:"mismatches,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ValidateFixtures checks fixtures are named uniquely and expect something.
+func ValidateFixtures(fixtures []Fixture) error {
+	seen := map[string]struct{}{}
+	for i, f := range fixtures {
+		name := strings.TrimSpace(f.Name)
+		if name == "" {
+			return fmt.Errorf("fixtures[%d]: name is required", i)
+		}
+		if _, dup := seen[name]; dup {
+			return fmt.Errorf("fixtures[%d]: duplicate name %q", i, name)
+		}
+		seen[name] = struct{}{}
+		if len(f.Expect) == 0 {
+			return fmt.Errorf("fixture %q: expect is required", name)
+		}
+	}
+	return nil
+}
+
+// RunFixtures evaluates each fixture with client under policyVersion and
+// compares the expected fields. Values are compared in their JSON form, so
+// []string and []any outputs with the same elements match.
+func RunFixtures(ctx context.Context, client Client, tenantID, policyVersion string, fixtures []Fixture) []FixtureResult {
+	out := make([]FixtureResult, 0, len(fixtures))
+	for _, f := range fixtures {
+		res := FixtureResult{Name: f.Name}
+		input := make(map[string]any, len(f.Input)+1)
+		for k, v := range f.Input {
+			input[k] = v
+		}
+		input["policy_version"] = policyVersion
+
+		got, err := client.Evaluate(ctx, tenantID, input)
+		if err == nil {
+			res.Mismatches, err = compareExpected(f.Expect, got)
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		res.Passed = err == nil && len(res.Mismatches) == 0
+		out = append(out, res)
+	}
+	return out
+}
+
+func compareExpected(expect, got map[string]any) ([]Mismatch, error) {
+	outputs := make(map[string]any, len(got))
+	for k, v := range got {
+		if k != "trace" {
+			outputs[k] = v
+		}
+	}
+	actual, err := normalizeValue(outputs)
+	if err != nil {
+		return nil, fmt.Errorf("normalize output: %w", err)
+	}
+	fields := make([]string, 0, len(expect))
+	for k := range expect {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	var mismatches []Mismatch
+	for _, field := range fields {
+		want, err := normalizeValue(expect[field])
+		if err != nil {
+			return nil, fmt.Errorf("normalize expected %s: %w", field, err)
+		}
+		have := lookupPath(actual.(map[string]any), field)
+		if !equal(want, have) {
+			mismatches = append(mismatches, Mismatch{Field: field, Expected: want, Actual: have})
+		}
+	}
+	return mismatches, nil
+}
+
+// FormatMismatches renders mismatches as a one-line summary.
+func FormatMismatches(ms []Mismatch) string {
+	parts := make([]string, 0, len(ms))
+	for _, m := range ms {
+		want, _ := json.Marshal(m.Expected)
+		have, _ := json.Marshal(m.Actual)
+		parts = append(parts, fmt.Sprintf("%s: expected %s, got %s", m.Field, want, have))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,640 @@
+package gorules
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Node types of a JSON Decision Model (JDM) graph as exported by the GoRules
+// editor. Function, sub-decision and custom nodes execute code or load other
+// models and are rejected by ParseDecision.
+const (
+	NodeInput         = "inputNode"
+	NodeOutput        = "outputNode"
+	NodeDecisionTable = "decisionTableNode"
+	NodeExpression    = "expressionNode"
+	NodeSwitch        = "switchNode"
+)
+
+// Hit policies for decision tables and switch nodes. With "first" the first
+// matching row or statement wins; with "collect" all matching ones apply.
+const (
+	HitFirst   = "first"
+	HitCollect = "collect"
+)
+
+type jdmDocument struct {
+	Nodes []jdmNode `json:"nodes"`
+	Edges []jdmEdge `json:"edges"`
+}
+
+type jdmNode struct {
+	ID      string          `json:"id"`
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	Content json.RawMessage `json:"content"`
+}
+
+type jdmEdge struct {
+	ID           string `json:"id"`
+	SourceID     string `json:"sourceId"`
+	TargetID     string `json:"targetId"`
+	SourceHandle string `json:"sourceHandle,omitempty"`
+}
+
+type tableContent struct {
+	HitPolicy   string           `json:"hitPolicy"`
+	PassThrough bool             `json:"passThrough"`
+	Inputs      []tableColumn    `json:"inputs"`
+	Outputs     []tableColumn    `json:"outputs"`
+	Rules       []map[string]any `json:"rules"`
+}
+
+type tableColumn struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Field string `json:"field"`
+}
+
+type expressionContent struct {
+	PassThrough bool `json:"passThrough"`
+	Expressions []struct {
+		ID    string `json:"id"`
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"expressions"`
+}
+
+type switchContent struct {
+	HitPolicy  string `json:"hitPolicy"`
+	Statements []struct {
+		ID        string `json:"id"`
+		Condition string `json:"condition"`
+	} `json:"statements"`
+}
+
+// Decision is a parsed and validated decision model. Every expression is
+// compiled up front, so a Decision that parsed cleanly only fails at
+// evaluation time on type errors in the data it is given. It is safe for
+// concurrent use.
+type Decision struct {
+	nodes    []*compiledNode
+	incoming map[string][]jdmEdge
+	outgoing map[string][]jdmEdge
+}
+
+type compiledNode struct {
+	jdmNode
+	table *compiledTable
+	exprs []compiledAssignment
+	pass  bool
+	sw    *compiledSwitch
+}
+
+type compiledTable struct {
+	hitPolicy string
+	inputs    []tableColumn
+	outputs   []tableColumn
+	rules     []compiledRow
+}
+
+type compiledRow struct {
+	id      string
+	tests   []*unaryTest
+	outputs []compiledAssignment
+}
+
+type compiledAssignment struct {
+	key  string
+	expr node
+}
+
+type compiledSwitch struct {
+	hitPolicy  string
+	statements []compiledStatement
+}
+
+type compiledStatement struct {
+	id   string
+	cond node // nil for the default branch
+}
+
+// NodeTrace records one executed node: the input it received, the output it
+// produced and, for tables and switches, the ids of the rows or statements
+// that matched.
+type NodeTrace struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Input   any      `json:"input"`
+	Output  any      `json:"output"`
+	Matched []string `json:"matched,omitempty"`
+}
+
+// Result is the output of a decision model together with its execution trace
+// in evaluation order.
+type Result struct {
+	Output map[string]any `json:"output"`
+	Trace  []NodeTrace    `json:"trace"`
+}
+
+// ParseDecision parses and validates a JDM document. The graph must have
+// exactly one input node, edges must connect existing nodes without cycles,
+// and every expression and table cell must compile.
+func ParseDecision(raw []byte) (*Decision, error) {
+	var doc jdmDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("decode decision model: %w", err)
+	}
+	d := &Decision{incoming: map[string][]jdmEdge{}, outgoing: map[string][]jdmEdge{}}
+	byID := map[string]*compiledNode{}
+	inputs := 0
+	for _, n := range doc.Nodes {
+		if n.ID == "" {
+			return nil, fmt.Errorf("node without id")
+		}
+		if _, dup := byID[n.ID]; dup {
+			return nil, fmt.Errorf("duplicate node id %q", n.ID)
+		}
+		cn, err := compileNode(n)
+		if err != nil {
+			return nil, fmt.Errorf("node %q: %w", n.ID, err)
+		}
+		if n.Type == NodeInput {
+			inputs++
+		}
+		byID[n.ID] = cn
+		d.nodes = append(d.nodes, cn)
+	}
+	if inputs != 1 {
+		return nil, fmt.Errorf("decision model must have exactly one %s, found %d", NodeInput, inputs)
+	}
+	edgeIDs := map[string]bool{}
+	for _, e := range doc.Edges {
+		if e.ID == "" {
+			return nil, fmt.Errorf("edge without id")
+		}
+		if edgeIDs[e.ID] {
+			return nil, fmt.Errorf("duplicate edge id %q", e.ID)
+		}
+		edgeIDs[e.ID] = true
+		src, ok := byID[e.SourceID]
+		if !ok {
+			return nil, fmt.Errorf("edge %q: unknown source %q", e.ID, e.SourceID)
+		}
+		dst, ok := byID[e.TargetID]
+		if !ok {
+			return nil, fmt.Errorf("edge %q: unknown target %q", e.ID, e.TargetID)
+		}
+		if dst.Type == NodeInput || src.Type == NodeOutput {
+			return nil, fmt.Errorf("edge %q: %s cannot feed %s", e.ID, src.Type, dst.Type)
+		}
+		if src.sw != nil && !src.sw.hasStatement(e.SourceHandle) {
+			return nil, fmt.Errorf("edge %q: switch %q has no statement %q", e.ID, src.ID, e.SourceHandle)
+		}
+		d.incoming[e.TargetID] = append(d.incoming[e.TargetID], e)
+		d.outgoing[e.SourceID] = append(d.outgoing[e.SourceID], e)
+	}
+	order, err := d.topoOrder()
+	if err != nil {
+		return nil, err
+	}
+	d.nodes = order
+	return d, nil
+}
+
+// topoOrder sorts nodes so every node follows its predecessors, breaking ties
+// by document order so evaluation and traces are deterministic.
+func (d *Decision) topoOrder() ([]*compiledNode, error) {
+	pos := make(map[string]int, len(d.nodes))
+	indegree := make(map[string]int, len(d.nodes))
+	for i, n := range d.nodes {
+		pos[n.ID] = i
+		indegree[n.ID] = len(d.incoming[n.ID])
+	}
+	var ready []*compiledNode
+	for _, n := range d.nodes {
+		if indegree[n.ID] == 0 {
+			ready = append(ready, n)
+		}
+	}
+	order := make([]*compiledNode, 0, len(d.nodes))
+	for len(ready) > 0 {
+		sort.SliceStable(ready, func(i, j int) bool { return pos[ready[i].ID] < pos[ready[j].ID] })
+		n := ready[0]
+		ready = ready[1:]
+		order = append(order, n)
+		for _, e := range d.outgoing[n.ID] {
+			indegree[e.TargetID]--
+			if indegree[e.TargetID] == 0 {
+				ready = append(ready, d.nodes[pos[e.TargetID]])
+			}
+		}
+	}
+	if len(order) != len(d.nodes) {
+		return nil, fmt.Errorf("decision model graph contains a cycle")
+	}
+	return order, nil
+}
+
+func compileNode(n jdmNode) (*compiledNode, error) {
+	cn := &compiledNode{jdmNode: n}
+	switch n.Type {
+	case NodeInput, NodeOutput:
+		return cn, nil
+	case NodeDecisionTable:
+		var c tableContent
+		if err := json.Unmarshal(n.Content, &c); err != nil {
+			return nil, fmt.Errorf("decode decision table: %w", err)
+		}
+		t, err := compileTable(c)
+		if err != nil {
+			return nil, err
+		}
+		cn.table, cn.pass = t, c.PassThrough
+		return cn, nil
+	case NodeExpression:
+		var c expressionContent
+		if err := json.Unmarshal(n.Content, &c); err != nil {
+			return nil, fmt.Errorf("decode expressions: %w", err)
+		}
+		for _, x := range c.Expressions {
+			if strings.TrimSpace(x.Key) == "" {
+				return nil, fmt.Errorf("expression %q has no key", x.ID)
+			}
+			expr, _, err := parseExpression(x.Value)
+			if err != nil {
+				return nil, fmt.Errorf("expression %q: %w", x.Key, err)
+			}
+			cn.exprs = append(cn.exprs, compiledAssignment{key: x.Key, expr: expr})
+		}
+		cn.pass = c.PassThrough
+		return cn, nil
+	case NodeSwitch:
+		var c switchContent
+		if err := json.Unmarshal(n.Content, &c); err != nil {
+			return nil, fmt.Errorf("decode switch: %w", err)
+		}
+		sw := &compiledSwitch{hitPolicy: defaultHitPolicy(c.HitPolicy)}
+		if err := validHitPolicy(sw.hitPolicy); err != nil {
+			return nil, err
+		}
+		for _, s := range c.Statements {
+			st := compiledStatement{id: s.ID}
+			if strings.TrimSpace(s.Condition) != "" {
+				cond, _, err := parseExpression(s.Condition)
+				if err != nil {
+					return nil, fmt.Errorf("statement %q: %w", s.ID, err)
+				}
+				st.cond = cond
+			}
+			sw.statements = append(sw.statements, st)
+		}
+		cn.sw = sw
+		return cn, nil
+	}
+	return nil, fmt.Errorf("unsupported node type %q", n.Type)
+}
+
+func compileTable(c tableContent) (*compiledTable, error) {
+	t := &compiledTable{hitPolicy: defaultHitPolicy(c.HitPolicy), inputs: c.Inputs, outputs: c.Outputs}
+	if err := validHitPolicy(t.hitPolicy); err != nil {
+		return nil, err
+	}
+	for _, col := range c.Outputs {
+		if strings.TrimSpace(col.Field) == "" {
+			return nil, fmt.Errorf("output column %q has no field", col.ID)
+		}
+	}
+	for i, rule := range c.Rules {
+		row := compiledRow{id: cellString(rule["_id"])}
+		if row.id == "" {
+			row.id = fmt.Sprintf("%d", i)
+		}
+		for _, col := range c.Inputs {
+			src := cellString(rule[col.ID])
+			var test *unaryTest
+			var err error
+			if strings.TrimSpace(col.Field) == "" {
+				// Columns without a field hold standalone conditions.
+				test, err = compileCondition(src)
+			} else {
+				test, err = compileUnaryTest(src)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rule %q, input %q: %w", row.id, col.ID, err)
+			}
+			row.tests = append(row.tests, test)
+		}
+		for _, col := range c.Outputs {
+			src := strings.TrimSpace(cellString(rule[col.ID]))
+			if src == "" {
+				continue
+			}
+			expr, _, err := parseExpression(src)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q, output %q: %w", row.id, col.ID, err)
+			}
+			row.outputs = append(row.outputs, compiledAssignment{key: col.Field, expr: expr})
+		}
+		t.rules = append(t.rules, row)
+	}
+	return t, nil
+}
+
+// compileCondition compiles a cell that is a boolean expression in its own
+// right rather than a test against a field value.
+func compileCondition(src string) (*unaryTest, error) {
+	src = strings.TrimSpace(src)
+	if src == "" || src == "-" {
+		return &unaryTest{src: src, always: true}, nil
+	}
+	expr, _, err := parseExpression(src)
+	if err != nil {
+		return nil, err
+	}
+	return &unaryTest{src: src, usesDollar: true, items: []node{expr}}, nil
+}
+
+func cellString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func defaultHitPolicy(p string) string {
+	if p == "" {
+		return HitFirst
+	}
+	return p
+}
+
+func validHitPolicy(p string) error {
+	if p != HitFirst && p != HitCollect {
+		return fmt.Errorf("unsupported hit policy %q", p)
+	}
+	return nil
+}
+
+func (s *compiledSwitch) hasStatement(id string) bool {
+	for _, st := range s.statements {
+		if st.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate runs the model against input. Nodes execute in dependency order
+// and only when at least one incoming edge is active; a switch activates only
+// the edges of the statements that matched. A node's input is the merge of
+// its active predecessors' outputs, and the model output is the merge of the
+// inputs reaching its output nodes.
+func (d *Decision) Evaluate(input map[string]any) (Result, error) {
+	normalized, err := normalizeValue(input)
+	if err != nil {
+		return Result{}, fmt.Errorf("normalize input: %w", err)
+	}
+	outputs := map[string]any{}
+	active := map[string]bool{}
+	var final any = map[string]any{}
+	res := Result{Trace: []NodeTrace{}}
+
+	for _, n := range d.nodes {
+		var in any
+		if n.Type == NodeInput {
+			in = normalized
+		} else {
+			reached := false
+			for _, e := range d.incoming[n.ID] {
+				if !active[e.ID] {
+					continue
+				}
+				in = mergeValues(in, outputs[e.SourceID])
+				reached = true
+			}
+			if !reached {
+				continue
+			}
+		}
+
+		out, matched, err := n.run(in)
+		if err != nil {
+			return Result{}, fmt.Errorf("node %q (%s): %w", n.Name, n.ID, err)
+		}
+		outputs[n.ID] = out
+		if n.Type == NodeOutput {
+			final = mergeValues(final, out)
+		}
+		for _, e := range d.outgoing[n.ID] {
+			active[e.ID] = n.sw == nil || containsString(matched, e.SourceHandle)
+		}
+		res.Trace = append(res.Trace, NodeTrace{ID: n.ID, Name: n.Name, Type: n.Type, Input: in, Output: out, Matched: matched})
+	}
+
+	m, ok := final.(map[string]any)
+	if !ok {
+		return Result{}, fmt.Errorf("decision output must be an object, got %s", typeName(final))
+	}
+	res.Output = m
+	return res, nil
+}
+
+func (n *compiledNode) run(in any) (any, []string, error) {
+	scope, _ := in.(map[string]any)
+	switch {
+	case n.table != nil:
+		out, matched, err := n.table.run(scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n.pass {
+			out = mergeValues(cloneValue(in), out)
+		}
+		return out, matched, nil
+	case n.sw != nil:
+		matched, err := n.sw.run(scope)
+		return in, matched, err
+	case n.Type == NodeExpression:
+		out := map[string]any{}
+		for _, a := range n.exprs {
+			v, err := a.expr.eval(env{scope: scope, dollar: out})
+			if err != nil {
+				return nil, nil, fmt.Errorf("expression %q: %w", a.key, err)
+			}
+			setPath(out, a.key, v)
+		}
+		if n.pass {
+			return mergeValues(cloneValue(in), out), nil, nil
+		}
+		return out, nil, nil
+	}
+	return in, nil, nil
+}
+
+// run evaluates the table rows in order. With the first hit policy the output
+// is the first matching row's object (empty when none match); with collect it
+// is the list of every matching row's object.
+func (t *compiledTable) run(scope map[string]any) (any, []string, error) {
+	var collected []any
+	var matched []string
+	for _, row := range t.rules {
+		ok, err := row.matches(t.inputs, scope)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rule %q: %w", row.id, err)
+		}
+		if !ok {
+			continue
+		}
+		out := map[string]any{}
+		for _, a := range row.outputs {
+			v, err := a.expr.eval(env{scope: scope})
+			if err != nil {
+				return nil, nil, fmt.Errorf("rule %q, output %q: %w", row.id, a.key, err)
+			}
+			setPath(out, a.key, v)
+		}
+		matched = append(matched, row.id)
+		if t.hitPolicy == HitFirst {
+			return out, matched, nil
+		}
+		collected = append(collected, out)
+	}
+	if t.hitPolicy == HitFirst {
+		return map[string]any{}, matched, nil
+	}
+	if collected == nil {
+		collected = []any{}
+	}
+	return collected, matched, nil
+}
+
+func (r compiledRow) matches(inputs []tableColumn, scope map[string]any) (bool, error) {
+	for i, test := range r.tests {
+		ok, err := test.match(scope, lookupPath(scope, inputs[i].Field))
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s *compiledSwitch) run(scope map[string]any) ([]string, error) {
+	var matched []string
+	for _, st := range s.statements {
+		if st.cond == nil {
+			// A statement without a condition is the default branch and
+			// only applies when nothing before it matched.
+			if len(matched) == 0 {
+				matched = append(matched, st.id)
+			}
+			if s.hitPolicy == HitFirst {
+				return matched, nil
+			}
+			continue
+		}
+		v, err := st.cond.eval(env{scope: scope})
+		if err != nil {
+			return nil, fmt.Errorf("statement %q: %w", st.id, err)
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("statement %q: expected boolean, got %s", st.id, typeName(v))
+		}
+		if !b {
+			continue
+		}
+		matched = append(matched, st.id)
+		if s.hitPolicy == HitFirst {
+			return matched, nil
+		}
+	}
+	return matched, nil
+}
+
+// normalizeValue converts arbitrary Go values (typed maps and slices, ints)
+// into the JSON shapes expressions operate on.
+func normalizeValue(v any) (any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// mergeValues deep-merges src into dst when both are objects; otherwise src
+// replaces dst. dst is not modified.
+func mergeValues(dst, src any) any {
+	dm, dok := dst.(map[string]any)
+	sm, sok := src.(map[string]any)
+	if !dok || !sok {
+		return cloneValue(src)
+	}
+	out := cloneValue(dm).(map[string]any)
+	for k, v := range sm {
+		out[k] = mergeValues(out[k], v)
+	}
+	return out
+}
+
+func cloneValue(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, item := range x {
+			out[k] = cloneValue(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, item := range x {
+			out[i] = cloneValue(item)
+		}
+		return out
+	}
+	return v
+}
+
+// setPath assigns v at a dotted path such as "pricing.discount", creating
+// intermediate objects as needed.
+func setPath(m map[string]any, path string, v any) {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[p] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = v
+}
+
+func lookupPath(m map[string]any, path string) any {
+	if path == "" {
+		return nil
+	}
+	var cur any = m
+	for _, p := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = obj[p]
+	}
+	return cur
+}
+
+func containsString(xs []string, s string) bool {
+	for _, x := range xs {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
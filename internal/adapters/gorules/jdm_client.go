@@ -0,0 +1,152 @@
+package gorules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ModelSource loads JDM documents by tenant and policy version. found is
+// false when no model exists for the pair.
+type ModelSource interface {
+	GetDecisionModel(ctx context.Context, tenantID, policyVersion string) ([]byte, bool, error)
+}
+
+// DirSource reads models from <Dir>/<tenant>/<version>.json, falling back to
+// the shared <Dir>/<version>.json.
+type DirSource struct {
+	Dir string
+}
+
+func (s DirSource) GetDecisionModel(_ context.Context, tenantID, policyVersion string) ([]byte, bool, error) {
+	if !safePathPart(policyVersion) {
+		return nil, false, fmt.Errorf("invalid policy version %q", policyVersion)
+	}
+	var paths []string
+	if tenantID != "" {
+		if !safePathPart(tenantID) {
+			return nil, false, fmt.Errorf("invalid tenant id %q", tenantID)
+		}
+		paths = append(paths, filepath.Join(s.Dir, tenantID, policyVersion+".json"))
+	}
+	paths = append(paths, filepath.Join(s.Dir, policyVersion+".json"))
+	for _, p := range paths {
+		raw, err := os.ReadFile(p)
+		if err == nil {
+			return raw, true, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, false, err
+		}
+	}
+	return nil, false, nil
+}
+
+// Sources tries each source in order and returns the first model found.
+type Sources []ModelSource
+
+func (s Sources) GetDecisionModel(ctx context.Context, tenantID, policyVersion string) ([]byte, bool, error) {
+	for _, src := range s {
+		raw, found, err := src.GetDecisionModel(ctx, tenantID, policyVersion)
+		if err != nil || found {
+			return raw, found, err
+		}
+	}
+	return nil, false, nil
+}
+
+func safePathPart(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `/\`)
+}
+
+// JDMClient evaluates policies with decision models from a ModelSource. The
+// model is chosen by tenant and by input["policy_version"], defaulting to
+// PolicyVersion. When no model exists the request goes to the fallback client
+// (the built-in LocalClient unless WithFallback says otherwise). Parsed models
+// are cached per tenant and version; versions are immutable, so the cache is
+// never invalidated.
+type JDMClient struct {
+	PolicyVersion string
+
+	source   ModelSource
+	fallback Client
+
+	mu    sync.RWMutex
+	cache map[string]*Decision
+}
+
+type JDMOption func(*JDMClient)
+
+// WithFallback sets the client used when no model exists. A nil fallback
+// makes a missing model an error.
+func WithFallback(c Client) JDMOption {
+	return func(j *JDMClient) {
+		j.fallback = c
+	}
+}
+
+func NewJDMClient(policyVersion string, source ModelSource, opts ...JDMOption) *JDMClient {
+	c := &JDMClient{
+		PolicyVersion: policyVersion,
+		source:        source,
+		fallback:      NewLocalClient(policyVersion),
+		cache:         map[string]*Decision{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Evaluate runs the model and returns its output with policy_version and the
+// node-by-node trace added.
+func (c *JDMClient) Evaluate(ctx context.Context, tenantID string, input map[string]any) (map[string]any, error) {
+	version := c.PolicyVersion
+	if v, ok := input["policy_version"].(string); ok && v != "" {
+		version = v
+	}
+	model, found, err := c.model(ctx, tenantID, version)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if c.fallback == nil {
+			return nil, fmt.Errorf("no decision model for policy version %q", version)
+		}
+		return c.fallback.Evaluate(ctx, tenantID, input)
+	}
+	res, err := model.Evaluate(input)
+	if err != nil {
+		return nil, fmt.Errorf("evaluate %s: %w", version, err)
+	}
+	out := res.Output
+	out["policy_version"] = version
+	out["trace"] = res.Trace
+	return out, nil
+}
+
+func (c *JDMClient) model(ctx context.Context, tenantID, version string) (*Decision, bool, error) {
+	key := tenantID + "|" + version
+	c.mu.RLock()
+	d, ok := c.cache[key]
+	c.mu.RUnlock()
+	if ok {
+		return d, true, nil
+	}
+	raw, found, err := c.source.GetDecisionModel(ctx, tenantID, version)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	d, err = ParseDecision(raw)
+	if err != nil {
+		return nil, false, fmt.Errorf("decision model %s: %w", version, err)
+	}
+	c.mu.Lock()
+	c.cache[key] = d
+	c.mu.Unlock()
+	return d, true, nil
+}
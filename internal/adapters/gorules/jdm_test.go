@@ -0,0 +1,284 @@
+package gorules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func loadTestDecision(t *testing.T) *Decision {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "policy-v2.json"))
+	if err != nil {
+		t.Fatalf("read model: %v", err)
+	}
+	d, err := ParseDecision(raw)
+	if err != nil {
+		t.Fatalf("parse model: %v", err)
+	}
+	return d
+}
+
+func traceIDs(trace []NodeTrace) []string {
+	ids := make([]string, 0, len(trace))
+	for _, n := range trace {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestDecisionTableFirstHit(t *testing.T) {
+	d := loadTestDecision(t)
+	res, err := d.Evaluate(map[string]any{
+		"surface":       "home",
+		"context":       map[string]string{"plan": "team"},
+		"candidate_len": 12,
+	})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if got := res.Output["blocked_tags"]; !reflect.DeepEqual(got, []any{"beta"}) {
+		t.Fatalf("blocked_tags = %v", got)
+	}
+	if res.Output["tier"] != "silver" || res.Output["allowed"] != true || res.Output["surface"] != "home" {
+		t.Fatalf("unexpected output %v", res.Output)
+	}
+	if want := []string{"in", "route", "plans", "deny", "out"}; !reflect.DeepEqual(traceIDs(res.Trace), want) {
+		t.Fatalf("trace = %v, want %v", traceIDs(res.Trace), want)
+	}
+	if !reflect.DeepEqual(res.Trace[1].Matched, []string{"ranking"}) || !reflect.DeepEqual(res.Trace[2].Matched, []string{"pro-large"}) {
+		t.Fatalf("unexpected matches %v %v", res.Trace[1].Matched, res.Trace[2].Matched)
+	}
+
+	// Too few candidates for the pro row, so the catch-all applies, and the
+	// expression node overrides it with the deny tag.
+	res, err = d.Evaluate(map[string]any{
+		"context":       map[string]any{"plan": "pro", "deny_tag": "ml"},
+		"candidate_len": 3,
+	})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if res.Output["tier"] != "bronze" || !reflect.DeepEqual(res.Output["blocked_tags"], []any{"ml"}) {
+		t.Fatalf("unexpected output %v", res.Output)
+	}
+}
+
+func TestSwitchRoutesMutations(t *testing.T) {
+	d := loadTestDecision(t)
+	cases := []struct {
+		class, target, plan, actor string
+		allowed                    bool
+		rule                       string
+	}{
+		{"set_plan", "blueprint.plan", "pro", ActorHuman, true, "named"},
+		{"set_plan", "blueprint.plan", "pro", ActorAgent, false, "agent-plan"},
+		{"set_feature_flag", "blueprint.features.beta_ui", "pro", ActorAgent, true, "flags"},
+		{"set_feature_flag", "blueprint.features.beta_ui", "free", ActorHuman, false, "free-beta"},
+		{"drop_table", "drop_table", "pro", ActorHuman, false, "deny"},
+	}
+	for _, tc := range cases {
+		res, err := d.Evaluate(mutationInput(tc.class, tc.target, tc.plan, tc.actor))
+		if err != nil {
+			t.Fatalf("evaluate %s: %v", tc.class, err)
+		}
+		if res.Output["allowed"] != tc.allowed || res.Output["rule"] != tc.rule {
+			t.Fatalf("%s by %s on %s: allowed=%v rule=%v, want %v %s", tc.class, tc.actor, tc.plan, res.Output["allowed"], res.Output["rule"], tc.allowed, tc.rule)
+		}
+		if _, ok := res.Output["tier"]; ok {
+			t.Fatalf("ranking branch ran for mutation %s: %v", tc.class, traceIDs(res.Trace))
+		}
+	}
+}
+
+func TestDecisionTableCollect(t *testing.T) {
+	d, err := ParseDecision([]byte(`{
+		"nodes": [
+			{"id": "in", "type": "inputNode"},
+			{"id": "t", "type": "decisionTableNode", "content": {
+				"hitPolicy": "collect",
+				"inputs": [{"id": "s", "field": "score"}],
+				"outputs": [{"id": "o", "field": "band.name"}],
+				"rules": [
+					{"_id": "a", "s": "> 1", "o": "'above-1'"},
+					{"_id": "b", "s": "> 5", "o": "'above-5'"},
+					{"_id": "c", "s": "< 0", "o": "'negative'"}
+				]
+			}},
+			{"id": "x", "type": "expressionNode", "content": {"expressions": [
+				{"id": "1", "key": "count", "value": "2"},
+				{"id": "2", "key": "double", "value": "$.count * 2"}
+			]}},
+			{"id": "out", "type": "outputNode"}
+		],
+		"edges": [
+			{"id": "1", "sourceId": "in", "targetId": "t"},
+			{"id": "2", "sourceId": "in", "targetId": "x"},
+			{"id": "3", "sourceId": "x", "targetId": "out"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res, err := d.Evaluate(map[string]any{"score": 7})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	table := res.Trace[1]
+	if table.ID != "t" || !reflect.DeepEqual(table.Matched, []string{"a", "b"}) {
+		t.Fatalf("unexpected table trace %+v", table)
+	}
+	want := []any{
+		map[string]any{"band": map[string]any{"name": "above-1"}},
+		map[string]any{"band": map[string]any{"name": "above-5"}},
+	}
+	if !reflect.DeepEqual(table.Output, want) {
+		t.Fatalf("collect output = %v", table.Output)
+	}
+	if want := map[string]any{"count": 2.0, "double": 4.0}; !reflect.DeepEqual(res.Output, want) {
+		t.Fatalf("output = %v, want %v", res.Output, want)
+	}
+}
+
+func TestParseDecisionRejectsInvalidModels(t *testing.T) {
+	cases := map[string]string{
+		"no input":      `{"nodes":[{"id":"out","type":"outputNode"}]}`,
+		"unknown type":  `{"nodes":[{"id":"in","type":"inputNode"},{"id":"f","type":"functionNode","content":{"source":"export const handler = () => ({})"}}]}`,
+		"bad edge":      `{"nodes":[{"id":"in","type":"inputNode"}],"edges":[{"id":"e","sourceId":"in","targetId":"nope"}]}`,
+		"bad cell":      `{"nodes":[{"id":"in","type":"inputNode"},{"id":"t","type":"decisionTableNode","content":{"inputs":[{"id":"i","field":"a"}],"outputs":[{"id":"o","field":"b"}],"rules":[{"i":"> >","o":"1"}]}}]}`,
+		"hit policy":    `{"nodes":[{"id":"in","type":"inputNode"},{"id":"t","type":"decisionTableNode","content":{"hitPolicy":"unique"}}]}`,
+		"switch handle": `{"nodes":[{"id":"in","type":"inputNode"},{"id":"s","type":"switchNode","content":{"statements":[{"id":"a","condition":"true"}]}},{"id":"out","type":"outputNode"}],"edges":[{"id":"e1","sourceId":"in","targetId":"s"},{"id":"e2","sourceId":"s","targetId":"out","sourceHandle":"b"}]}`,
+		"cycle": `{"nodes":[{"id":"in","type":"inputNode"},{"id":"a","type":"expressionNode","content":{}},{"id":"b","type":"expressionNode","content":{}}],
+			"edges":[{"id":"1","sourceId":"in","targetId":"a"},{"id":"2","sourceId":"a","targetId":"b"},{"id":"3","sourceId":"b","targetId":"a"}]}`,
+	}
+	for name, raw := range cases {
+		if _, err := ParseDecision([]byte(raw)); err == nil {
+			t.Fatalf("%s: expected parse error", name)
+		}
+	}
+}
+
+func TestParseDecisionRejectsMissingAndDuplicateIDs(t *testing.T) {
+	cases := map[string]struct{ raw, want string }{
+		"empty node id": {
+			`{"nodes":[{"id":"in","type":"inputNode"},{"id":"","type":"outputNode"}]}`,
+			"node without id",
+		},
+		"duplicate node id": {
+			`{"nodes":[{"id":"in","type":"inputNode"},{"id":"in","type":"outputNode"}]}`,
+			`duplicate node id "in"`,
+		},
+		"empty edge id": {
+			`{"nodes":[{"id":"in","type":"inputNode"},{"id":"out","type":"outputNode"}],"edges":[{"id":"","sourceId":"in","targetId":"out"}]}`,
+			"edge without id",
+		},
+		"duplicate edge id": {
+			`{"nodes":[{"id":"in","type":"inputNode"},{"id":"x","type":"expressionNode","content":{}},{"id":"out","type":"outputNode"}],
+			"edges":[{"id":"1","sourceId":"in","targetId":"x"},{"id":"1","sourceId":"x","targetId":"out"}]}`,
+			`duplicate edge id "1"`,
+		},
+	}
+	for name, c := range cases {
+		_, err := ParseDecision([]byte(c.raw))
+		if err == nil || err.Error() != c.want {
+			t.Fatalf("%s: expected %q, got %v", name, c.want, err)
+		}
+	}
+}
+
+func TestJDMClientResolvesModelsPerTenantAndVersion(t *testing.T) {
+	dir := t.TempDir()
+	model, err := os.ReadFile(filepath.Join("testdata", "policy-v2.json"))
+	if err != nil {
+		t.Fatalf("read model: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "t_acme"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "t_acme", "policy-v2.json"), model, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	shared := `{"nodes":[{"id":"in","type":"inputNode"},{"id":"x","type":"expressionNode","content":{"expressions":[{"id":"1","key":"blocked_items","value":"['shared']"}]}},{"id":"out","type":"outputNode"}],
+		"edges":[{"id":"1","sourceId":"in","targetId":"x"},{"id":"2","sourceId":"x","targetId":"out"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "policy-v2.json"), []byte(shared), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewJDMClient("policy-v2", DirSource{Dir: dir})
+	ctx := context.Background()
+	out, err := client.Evaluate(ctx, "t_acme", map[string]any{"context": map[string]string{"plan": "enterprise"}})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if out["tier"] != "gold" || out["policy_version"] != "policy-v2" {
+		t.Fatalf("unexpected tenant output %v", out)
+	}
+	if trace, ok := out["trace"].([]NodeTrace); !ok || len(trace) != 5 {
+		t.Fatalf("expected node trace, got %v", out["trace"])
+	}
+
+	out, err = client.Evaluate(ctx, "t_other", map[string]any{})
+	if err != nil {
+		t.Fatalf("evaluate shared: %v", err)
+	}
+	if !reflect.DeepEqual(out["blocked_items"], []any{"shared"}) {
+		t.Fatalf("expected shared model, got %v", out)
+	}
+
+	// Unknown versions fall back to the local client.
+	out, err = client.Evaluate(ctx, "t_acme", map[string]any{"policy_version": "policy-v1", "mutation_class": "set_name"})
+	if err != nil {
+		t.Fatalf("evaluate fallback: %v", err)
+	}
+	if out["allowed"] != true || out["policy_version"] != "policy-v2" {
+		t.Fatalf("unexpected fallback output %v", out)
+	}
+
+	strict := NewJDMClient("policy-v2", DirSource{Dir: dir}, WithFallback(nil))
+	if _, err := strict.Evaluate(ctx, "t_acme", map[string]any{"policy_version": "policy-v9"}); err == nil {
+		t.Fatalf("expected missing model error without fallback")
+	}
+	if _, err := strict.Evaluate(ctx, "../etc", map[string]any{}); err == nil || !strings.Contains(err.Error(), "invalid tenant") {
+		t.Fatalf("expected path traversal to be rejected, got %v", err)
+	}
+}
+
+func TestRunFixtures(t *testing.T) {
+	dir := t.TempDir()
+	model, err := os.ReadFile(filepath.Join("testdata", "policy-v2.json"))
+	if err != nil {
+		t.Fatalf("read model: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "policy-v2.json"), model, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fixtures := []Fixture{
+		{Name: "enterprise", Input: map[string]any{"context": map[string]any{"plan": "enterprise"}}, Expect: map[string]any{"blocked_tags": []string{}, "tier": "gold"}},
+		{Name: "deny tag", Input: map[string]any{"context": map[string]any{"deny_tag": "ml"}}, Expect: map[string]any{"blocked_tags": []string{"beta"}, "allowed": true}},
+		{Name: "mutation", Input: map[string]any{"mutation_class": "drop_table"}, Expect: map[string]any{"allowed": false}},
+	}
+	if err := ValidateFixtures(fixtures); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	results := RunFixtures(context.Background(), NewJDMClient("policy-v1", DirSource{Dir: dir}), "t_acme", "policy-v2", fixtures)
+	if len(results) != 3 || !results[0].Passed || !results[2].Passed {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	failed := results[1]
+	if failed.Passed || len(failed.Mismatches) != 1 || failed.Mismatches[0].Field != "blocked_tags" {
+		t.Fatalf("expected blocked_tags mismatch, got %+v", failed)
+	}
+	if got := FormatMismatches(failed.Mismatches); got != `blocked_tags: expected ["beta"], got ["ml"]` {
+		t.Fatalf("summary = %s", got)
+	}
+
+	if err := ValidateFixtures([]Fixture{{Name: "a", Expect: map[string]any{"x": 1}}, {Name: "a", Expect: map[string]any{"x": 1}}}); err == nil {
+		t.Fatalf("expected duplicate fixture names to be rejected")
+	}
+	if err := ValidateFixtures([]Fixture{{Name: "a"}}); err == nil {
+		t.Fatalf("expected fixtures without expectations to be rejected")
+	}
+}
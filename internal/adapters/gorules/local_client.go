@@ -2,15 +2,18 @@ package gorules
 
 import "context"
 
+// LocalClient is the built-in policy. Ranking requests block the context's
+// deny_tag; mutations are checked against MutationRules.
 type LocalClient struct {
 	PolicyVersion string
+	MutationRules []MutationRule
 }
 
 func NewLocalClient(policyVersion string) *LocalClient {
-	return &LocalClient{PolicyVersion: policyVersion}
+	return &LocalClient{PolicyVersion: policyVersion, MutationRules: DefaultMutationRules}
 }
 
-func (c *LocalClient) Evaluate(_ context.Context, _ string, input map[string]any) (map[string]any, error) {
+func (c *LocalClient) Evaluate(_ context.Context, tenantID string, input map[string]any) (map[string]any, error) {
 	blockedTags := []string{}
 	if ctxRaw, ok := input["context"]; ok {
 		if m, ok := ctxRaw.(map[string]string); ok {
@@ -19,23 +22,14 @@ func (c *LocalClient) Evaluate(_ context.Context, _ string, input map[string]any
 			}
 		}
 	}
-	allowedMutations := []string{"set_name", "set_plan", "set_region", "set_feature_flag"}
-	if classRaw, ok := input["mutation_class"]; ok {
-		if class, ok := classRaw.(string); ok {
-			allowed := false
-			for _, x := range allowedMutations {
-				if class == x {
-					allowed = true
-					break
-				}
-			}
-			return map[string]any{
-				"allowed":           allowed,
-				"policy_version":    c.PolicyVersion,
-				"blocked_tags":      blockedTags,
-				"allowed_mutations": allowedMutations,
-			}, nil
-		}
+	if _, ok := input["mutation_class"].(string); ok {
+		rule, allowed := EvaluateMutationRules(c.MutationRules, tenantID, input)
+		return map[string]any{
+			"allowed":        allowed,
+			"policy_version": c.PolicyVersion,
+			"blocked_tags":   blockedTags,
+			"rule":           rule,
+		}, nil
 	}
 	return map[string]any{
 		"allowed":        true,
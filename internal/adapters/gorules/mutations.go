@@ -0,0 +1,218 @@
+package gorules
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Actor types a mutation can be made by.
+const (
+	ActorHuman = "human"
+	ActorAgent = "agent"
+)
+
+// Mutation is an app mutation as presented to a policy. Path is the target
+// the mutation writes, e.g. "name" or "blueprint.features.beta".
+type Mutation struct {
+	TenantID  string
+	AppID     string
+	Blueprint map[string]any
+	Class     string
+	Path      string
+	Value     any
+	ActorType string
+	ActorID   string
+}
+
+// Input is the evaluation input for m. The app's plan is lifted out of the
+// blueprint so rules can match it directly.
+func (m Mutation) Input() map[string]any {
+	plan, _ := m.Blueprint["plan"].(string)
+	blueprint := m.Blueprint
+	if blueprint == nil {
+		blueprint = map[string]any{}
+	}
+	return map[string]any{
+		"tenant_id":      m.TenantID,
+		"mutation_class": m.Class,
+		"path":           m.Path,
+		"value":          m.Value,
+		"plan":           plan,
+		"actor":          map[string]any{"type": m.ActorType, "id": m.ActorID},
+		"app":            map[string]any{"id": m.AppID, "blueprint": blueprint},
+	}
+}
+
+// MutationRule is one entry of a mutation allowlist. Each selector lists the
+// values it matches and matches anything when empty; Paths are path.Match
+// patterns over the target path, so "blueprint.features.*" covers every
+// feature flag. Effect is "allow" or "deny".
+type MutationRule struct {
+	ID      string   `json:"id"`
+	Effect  string   `json:"effect"`
+	Tenants []string `json:"tenants,omitempty"`
+	Plans   []string `json:"plans,omitempty"`
+	Actors  []string `json:"actors,omitempty"`
+	Classes []string `json:"classes,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+}
+
+// DefaultMutationRules is the built-in allowlist: the four mutation classes
+// the API implements, for every tenant, plan and actor.
+var DefaultMutationRules = []MutationRule{
+	{ID: "builtin-classes", Effect: "allow", Classes: []string{"set_name", "set_plan", "set_region", "set_feature_flag"}},
+}
+
+// defaultDeny is reported when no rule matches.
+var defaultDeny = MutationRule{ID: "default-deny", Effect: "deny"}
+
+// EvaluateMutationRules returns the first rule matching the mutation input,
+// or the implicit default-deny rule.
+func EvaluateMutationRules(rules []MutationRule, tenantID string, input map[string]any) (MutationRule, bool) {
+	class, _ := input["mutation_class"].(string)
+	target, _ := input["path"].(string)
+	plan, _ := input["plan"].(string)
+	var actor string
+	if a, ok := input["actor"].(map[string]any); ok {
+		actor, _ = a["type"].(string)
+	}
+	for _, r := range rules {
+		if matchAny(r.Tenants, tenantID) && matchAny(r.Plans, plan) && matchAny(r.Actors, actor) &&
+			matchAny(r.Classes, class) && matchPath(r.Paths, target) {
+			return r, r.Effect == "allow"
+		}
+	}
+	return defaultDeny, false
+}
+
+func matchAny(values []string, v string) bool {
+	return len(values) == 0 || containsString(values, v)
+}
+
+func matchPath(patterns []string, target string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// DeniedBy returns the rule a policy output names as its reason: the
+// "rule" field when the policy sets one, else the last decision table row
+// that matched in the trace, as "<node>:<row>". The trace may be in-process
+// or decoded from a remote agent's JSON.
+func DeniedBy(out map[string]any) any {
+	if r, ok := out["rule"]; ok && r != nil {
+		return r
+	}
+	trace := traceNodes(out["trace"])
+	for i := len(trace) - 1; i >= 0; i-- {
+		if n := trace[i]; n.Type == NodeDecisionTable && len(n.Matched) > 0 {
+			return n.ID + ":" + strings.Join(n.Matched, ",")
+		}
+	}
+	return nil
+}
+
+// traceNodes reads a trace as []NodeTrace. Besides the in-process form it
+// accepts the same list decoded from JSON, and a GoRules agent trace: an
+// object keyed by node id, ordered by each node's "order", whose decision
+// tables report matched rows under traceData.rule._id.
+func traceNodes(v any) []NodeTrace {
+	switch t := v.(type) {
+	case []NodeTrace:
+		return t
+	case []any:
+		out := make([]NodeTrace, 0, len(t))
+		for _, x := range t {
+			m, _ := x.(map[string]any)
+			id, _ := m["id"].(string)
+			typ, _ := m["type"].(string)
+			out = append(out, NodeTrace{ID: id, Type: typ, Matched: stringList(m["matched"])})
+		}
+		return out
+	case map[string]any:
+		ids := make([]string, 0, len(t))
+		for id := range t {
+			ids = append(ids, id)
+		}
+		order := func(id string) float64 {
+			m, _ := t[id].(map[string]any)
+			n, _ := m["order"].(float64)
+			return n
+		}
+		sort.SliceStable(ids, func(i, j int) bool {
+			if oi, oj := order(ids[i]), order(ids[j]); oi != oj {
+				return oi < oj
+			}
+			return ids[i] < ids[j]
+		})
+		out := make([]NodeTrace, 0, len(ids))
+		for _, id := range ids {
+			m, _ := t[id].(map[string]any)
+			n := NodeTrace{ID: id, Matched: agentMatchedRows(m["traceData"])}
+			if len(n.Matched) > 0 {
+				n.Type = NodeDecisionTable
+			}
+			out = append(out, n)
+		}
+		return out
+	}
+	return nil
+}
+
+// agentMatchedRows returns the row ids in a GoRules decision table
+// traceData: one {"rule": {...}} for first-hit tables, a list for collect.
+func agentMatchedRows(v any) []string {
+	hits, ok := v.([]any)
+	if !ok {
+		hits = []any{v}
+	}
+	var rows []string
+	for _, h := range hits {
+		m, _ := h.(map[string]any)
+		rule, _ := m["rule"].(map[string]any)
+		if id, ok := rule["_id"].(string); ok && id != "" {
+			rows = append(rows, id)
+		}
+	}
+	return rows
+}
+
+func stringList(v any) []string {
+	list, _ := v.([]any)
+	out := make([]string, 0, len(list))
+	for _, x := range list {
+		if s, ok := x.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// MutationVerdict reads a mutation policy's output. Only allowed=true allows;
+// an output without a boolean "allowed" is a policy error and denies, with
+// the error reported as the denying rule.
+func MutationVerdict(out map[string]any) (bool, any) {
+	v, present := out["allowed"]
+	allowed, isBool := v.(bool)
+	switch {
+	case isBool && allowed:
+		return true, nil
+	case isBool:
+		return false, DeniedBy(out)
+	case !present:
+		return false, invalidOutputRule("policy output has no allowed field")
+	default:
+		return false, invalidOutputRule("policy output allowed is " + typeName(v) + ", want bool")
+	}
+}
+
+func invalidOutputRule(reason string) map[string]any {
+	return map[string]any{"id": "invalid-policy-output", "effect": "deny", "reason": reason}
+}
@@ -0,0 +1,120 @@
+package gorules
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func mutationInput(class, target, plan, actor string) map[string]any {
+	return Mutation{
+		TenantID:  "t_acme",
+		AppID:     "app_1",
+		Blueprint: map[string]any{"plan": plan},
+		Class:     class,
+		Path:      target,
+		ActorType: actor,
+		ActorID:   "dev-user",
+	}.Input()
+}
+
+func TestMutationRulesMatchTenantPlanActorAndPath(t *testing.T) {
+	rules := []MutationRule{
+		{ID: "no-agent-plan", Effect: "deny", Actors: []string{ActorAgent}, Classes: []string{"set_plan"}},
+		{ID: "globex-flags", Effect: "deny", Tenants: []string{"t_globex"}, Paths: []string{"blueprint.features.*"}},
+		{ID: "free-region", Effect: "deny", Plans: []string{"free"}, Classes: []string{"set_region"}},
+		{ID: "core", Effect: "allow", Classes: []string{"set_name", "set_plan", "set_region", "set_feature_flag"}},
+	}
+	cases := []struct {
+		tenant, class, target, plan, actor string
+		rule                               string
+		allowed                            bool
+	}{
+		{"t_acme", "set_plan", "blueprint.plan", "pro", ActorHuman, "core", true},
+		{"t_acme", "set_plan", "blueprint.plan", "pro", ActorAgent, "no-agent-plan", false},
+		{"t_globex", "set_feature_flag", "blueprint.features.beta", "pro", ActorHuman, "globex-flags", false},
+		{"t_acme", "set_feature_flag", "blueprint.features.beta", "pro", ActorHuman, "core", true},
+		{"t_acme", "set_region", "blueprint.region", "free", ActorHuman, "free-region", false},
+		{"t_acme", "drop_table", "drop_table", "pro", ActorHuman, "default-deny", false},
+	}
+	for _, tc := range cases {
+		rule, allowed := EvaluateMutationRules(rules, tc.tenant, mutationInput(tc.class, tc.target, tc.plan, tc.actor))
+		if rule.ID != tc.rule || allowed != tc.allowed {
+			t.Fatalf("%s %s by %s on %s: got %s/%v, want %s/%v", tc.tenant, tc.class, tc.actor, tc.plan, rule.ID, allowed, tc.rule, tc.allowed)
+		}
+	}
+}
+
+func TestLocalClientReportsMutationRule(t *testing.T) {
+	c := NewLocalClient("policy-v1")
+	out, err := c.Evaluate(context.Background(), "t_acme", mutationInput("set_region", "blueprint.region", "", ActorAgent))
+	if err != nil || out["allowed"] != true {
+		t.Fatalf("expected the built-in classes to stay allowed, got %v %v", out, err)
+	}
+
+	c.MutationRules = []MutationRule{{ID: "humans-only", Effect: "allow", Actors: []string{ActorHuman}}}
+	out, err = c.Evaluate(context.Background(), "t_acme", mutationInput("set_region", "blueprint.region", "", ActorAgent))
+	if err != nil || out["allowed"] != false {
+		t.Fatalf("expected agent mutation denied, got %v %v", out, err)
+	}
+	if rule, ok := DeniedBy(out).(MutationRule); !ok || rule.ID != "default-deny" {
+		t.Fatalf("denied by %v", DeniedBy(out))
+	}
+}
+
+func TestDeniedByFallsBackToMatchedRow(t *testing.T) {
+	out := map[string]any{"allowed": false, "trace": []NodeTrace{
+		{ID: "route", Type: NodeSwitch, Matched: []string{"mutation"}},
+		{ID: "mutations", Type: NodeDecisionTable, Matched: []string{"deny"}},
+	}}
+	if got := DeniedBy(out); got != "mutations:deny" {
+		t.Fatalf("denied by %v", got)
+	}
+	if got := DeniedBy(map[string]any{"allowed": false}); got != nil {
+		t.Fatalf("expected no rule, got %v", got)
+	}
+}
+
+func TestDeniedByReadsRemoteTraces(t *testing.T) {
+	decoded := `{"allowed":false,"trace":[
+		{"id":"route","type":"switchNode","matched":["mutation"]},
+		{"id":"mutations","type":"decisionTableNode","matched":["deny-agent"]},
+		{"id":"out","type":"outputNode"}
+	]}`
+	agent := `{"allowed":false,"trace":{
+		"out":{"id":"out","name":"response","order":2},
+		"in":{"id":"in","name":"request","order":0},
+		"mutations":{"id":"mutations","name":"mutations","order":1,"traceData":{"index":3,"rule":{"_id":"deny-agent","mutation_class":"'set_plan'"}}}
+	}}`
+	collect := `{"allowed":false,"trace":{"mutations":{"id":"mutations","traceData":[{"rule":{"_id":"a"}},{"rule":{"_id":"b"}}]}}}`
+	cases := map[string]struct{ raw, want string }{
+		"decoded list":  {decoded, "mutations:deny-agent"},
+		"agent object":  {agent, "mutations:deny-agent"},
+		"agent collect": {collect, "mutations:a,b"},
+	}
+	for name, c := range cases {
+		var out map[string]any
+		if err := json.Unmarshal([]byte(c.raw), &out); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if allowed, rule := MutationVerdict(out); allowed || rule != c.want {
+			t.Fatalf("%s: expected deny by %q, got %v %v", name, c.want, allowed, rule)
+		}
+	}
+}
+
+func TestMutationVerdictFailsClosed(t *testing.T) {
+	if allowed, rule := MutationVerdict(map[string]any{"allowed": true}); !allowed || rule != nil {
+		t.Fatalf("expected allow, got %v %v", allowed, rule)
+	}
+	if allowed, rule := MutationVerdict(map[string]any{"allowed": false, "rule": "r1"}); allowed || rule != "r1" {
+		t.Fatalf("expected deny by r1, got %v %v", allowed, rule)
+	}
+	for _, out := range []map[string]any{{}, {"allowed": "true"}, {"allowed": nil}} {
+		allowed, rule := MutationVerdict(out)
+		r, _ := rule.(map[string]any)
+		if allowed || r["id"] != "invalid-policy-output" {
+			t.Fatalf("%v: expected invalid-output denial, got %v %v", out, allowed, rule)
+		}
+	}
+}
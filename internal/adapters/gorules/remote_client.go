@@ -0,0 +1,231 @@
+package gorules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Evaluator names reported in policy outputs under "evaluator".
+const (
+	EvaluatorLocal         = "local"
+	EvaluatorRemote        = "remote"
+	EvaluatorLocalFallback = "local_fallback"
+)
+
+// DefaultTenant is the ParseRemoteTargets key that applies to tenants
+// without their own entry.
+const DefaultTenant = "*"
+
+const maxRemoteResponse = 1 << 20
+
+// StatusError is a non-2xx response from a remote evaluator.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("gorules: status %d", e.Code)
+}
+
+// ParseRemoteTargets parses comma-separated tenant=url pairs naming each
+// tenant's GoRules agent project, e.g.
+// "t_acme=http://agent:8080/api/projects/vda,*=http://agent:8080/api/projects/shared".
+func ParseRemoteTargets(raw string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		tenant, target, ok := strings.Cut(part, "=")
+		tenant, target = strings.TrimSpace(tenant), strings.TrimRight(strings.TrimSpace(target), "/")
+		if !ok || tenant == "" || target == "" {
+			return nil, fmt.Errorf("remote target %q: want tenant=url", part)
+		}
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("remote target %q: invalid url", part)
+		}
+		if _, dup := out[tenant]; dup {
+			return nil, fmt.Errorf("remote target for %q listed twice", tenant)
+		}
+		out[tenant] = target
+	}
+	return out, nil
+}
+
+// RemoteClient evaluates policies on a GoRules agent, posting the input as
+// the evaluation context to <target>/evaluate/<policy_version>.json with
+// tracing on; the agent's trace is returned under "trace". Tenants
+// without a target, and requests whose remote is unreachable (transport
+// errors, timeouts, 5xx), are answered by the fallback client. Other
+// failures, such as a 4xx or a malformed result, are returned as errors so a
+// misconfigured document is not silently masked. Outputs carry "evaluator"
+// naming who answered.
+type RemoteClient struct {
+	PolicyVersion string
+
+	targets  map[string]string
+	token    string
+	fallback Client
+	http     *http.Client
+}
+
+type RemoteOption func(*RemoteClient)
+
+// WithRemoteToken sets the X-Access-Token sent to the agent.
+func WithRemoteToken(token string) RemoteOption {
+	return func(c *RemoteClient) {
+		c.token = token
+	}
+}
+
+// WithRemoteTimeout bounds each remote evaluation.
+func WithRemoteTimeout(d time.Duration) RemoteOption {
+	return func(c *RemoteClient) {
+		if d > 0 {
+			c.http.Timeout = d
+		}
+	}
+}
+
+func NewRemoteClient(policyVersion string, targets map[string]string, fallback Client, opts ...RemoteOption) *RemoteClient {
+	c := &RemoteClient{
+		PolicyVersion: policyVersion,
+		targets:       targets,
+		fallback:      fallback,
+		http: &http.Client{
+			Timeout: 500 * time.Millisecond,
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *RemoteClient) Evaluate(ctx context.Context, tenantID string, input map[string]any) (map[string]any, error) {
+	version := c.PolicyVersion
+	if v, ok := input["policy_version"].(string); ok && v != "" {
+		version = v
+	}
+	target, ok := c.targets[tenantID]
+	if !ok {
+		target, ok = c.targets[DefaultTenant]
+	}
+	if !ok {
+		return c.local(ctx, tenantID, input, EvaluatorLocal)
+	}
+	out, err := c.remote(ctx, target, version, input)
+	if err == nil {
+		out["policy_version"] = version
+		out["evaluator"] = EvaluatorRemote
+		return out, nil
+	}
+	if !unreachable(err) {
+		return nil, fmt.Errorf("remote evaluate %s: %w", version, err)
+	}
+	return c.local(ctx, tenantID, input, EvaluatorLocalFallback)
+}
+
+func (c *RemoteClient) local(ctx context.Context, tenantID string, input map[string]any, evaluator string) (map[string]any, error) {
+	if c.fallback == nil {
+		return nil, errors.New("no evaluator available for tenant " + tenantID)
+	}
+	out, err := c.fallback.Evaluate(ctx, tenantID, input)
+	if err != nil {
+		return nil, err
+	}
+	out["evaluator"] = evaluator
+	return out, nil
+}
+
+func (c *RemoteClient) remote(ctx context.Context, target, version string, input map[string]any) (map[string]any, error) {
+	body, err := json.Marshal(map[string]any{"context": input, "trace": true})
+	if err != nil {
+		return nil, err
+	}
+	u := target + "/evaluate/" + url.PathEscape(version+".json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("X-Access-Token", c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxRemoteResponse))
+		return nil, &StatusError{Code: resp.StatusCode}
+	}
+
+	var payload struct {
+		Result json.RawMessage `json:"result"`
+		Trace  any             `json:"trace"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxRemoteResponse)).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal(payload.Result, &result); err != nil || result == nil {
+		return nil, errors.New("response result must be an object")
+	}
+	if err := validateResult(result); err != nil {
+		return nil, err
+	}
+	// The agent returns its trace beside the result; keep it so callers can
+	// name the rule that decided, as with in-process traces.
+	if _, ok := result["trace"]; !ok && payload.Trace != nil {
+		result["trace"] = payload.Trace
+	}
+	return result, nil
+}
+
+// validateResult checks the fields callers act on have the expected types.
+func validateResult(result map[string]any) error {
+	if v, ok := result["allowed"]; ok {
+		if _, isBool := v.(bool); !isBool {
+			return fmt.Errorf("result.allowed: want bool, got %s", typeName(v))
+		}
+	}
+	for _, field := range []string{"blocked_tags", "blocked_items"} {
+		v, ok := result[field]
+		if !ok || v == nil {
+			continue
+		}
+		list, isList := v.([]any)
+		if !isList {
+			return fmt.Errorf("result.%s: want array, got %s", field, typeName(v))
+		}
+		for i, x := range list {
+			if _, isString := x.(string); !isString {
+				return fmt.Errorf("result.%s[%d]: want string, got %s", field, i, typeName(x))
+			}
+		}
+	}
+	return nil
+}
+
+// unreachable reports whether err means the remote could not answer, as
+// opposed to answering badly.
+func unreachable(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded)
+}
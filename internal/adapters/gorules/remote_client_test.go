@@ -0,0 +1,145 @@
+package gorules
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeAgent serves GoRules agent style evaluations. respond gets the decoded
+// context and writes the reply.
+func fakeAgent(t *testing.T, respond func(w http.ResponseWriter, r *http.Request, input map[string]any)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Context map[string]any `json:"context"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		respond(w, r, body.Context)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRemoteClientAnswersFromAgent(t *testing.T) {
+	var gotPath, gotToken string
+	srv := fakeAgent(t, func(w http.ResponseWriter, r *http.Request, input map[string]any) {
+		gotPath, gotToken = r.URL.Path, r.Header.Get("X-Access-Token")
+		tag := input["context"].(map[string]any)["deny_tag"]
+		_, _ = w.Write([]byte(`{"result":{"allowed":true,"blocked_tags":["` + tag.(string) + `"]},"performance":"0.2ms"}`))
+	})
+	targets, err := ParseRemoteTargets("t_acme=" + srv.URL + "/api/projects/vda/")
+	if err != nil {
+		t.Fatalf("parse targets: %v", err)
+	}
+	c := NewRemoteClient("policy-v1", targets, NewLocalClient("policy-v1"), WithRemoteToken("secret"))
+
+	out, err := c.Evaluate(context.Background(), "t_acme", map[string]any{
+		"context":        map[string]string{"deny_tag": "beta"},
+		"policy_version": "policy-v2",
+	})
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if gotPath != "/api/projects/vda/evaluate/policy-v2.json" || gotToken != "secret" {
+		t.Fatalf("agent saw path %q token %q", gotPath, gotToken)
+	}
+	if out["evaluator"] != EvaluatorRemote || out["policy_version"] != "policy-v2" {
+		t.Fatalf("unexpected output %v", out)
+	}
+	if tags := out["blocked_tags"].([]any); len(tags) != 1 || tags[0] != "beta" {
+		t.Fatalf("blocked_tags = %v", out["blocked_tags"])
+	}
+
+	local, err := c.Evaluate(context.Background(), "t_other", map[string]any{})
+	if err != nil || local["evaluator"] != EvaluatorLocal {
+		t.Fatalf("expected tenants without a target to stay local, got %v %v", local, err)
+	}
+}
+
+func TestRemoteClientKeepsAgentTraceForDenials(t *testing.T) {
+	srv := fakeAgent(t, func(w http.ResponseWriter, _ *http.Request, _ map[string]any) {
+		_, _ = w.Write([]byte(`{"result":{"allowed":false},"trace":{
+			"in":{"id":"in","name":"request","order":0},
+			"mutations":{"id":"mutations","name":"mutations","order":1,"traceData":{"index":0,"rule":{"_id":"deny-agent"}}}
+		}}`))
+	})
+	c := NewRemoteClient("policy-v1", map[string]string{"t_acme": srv.URL}, nil)
+	out, err := c.Evaluate(context.Background(), "t_acme", mutationInput("set_plan", "plan", "pro", ActorAgent))
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if allowed, rule := MutationVerdict(out); allowed || rule != "mutations:deny-agent" {
+		t.Fatalf("expected deny by mutations:deny-agent, got %v %v", allowed, rule)
+	}
+}
+
+func TestRemoteClientFallsBackWhenUnreachable(t *testing.T) {
+	down := fakeAgent(t, func(w http.ResponseWriter, _ *http.Request, _ map[string]any) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	slow := fakeAgent(t, func(w http.ResponseWriter, r *http.Request, _ map[string]any) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	for name, target := range map[string]string{"5xx": down.URL, "timeout": slow.URL, "refused": closed.URL} {
+		c := NewRemoteClient("policy-v1", map[string]string{DefaultTenant: target}, NewLocalClient("policy-v1"), WithRemoteTimeout(50*time.Millisecond))
+		out, err := c.Evaluate(context.Background(), "t_acme", map[string]any{"mutation_class": "set_name"})
+		if err != nil {
+			t.Fatalf("%s: expected fallback, got %v", name, err)
+		}
+		if out["evaluator"] != EvaluatorLocalFallback || out["allowed"] != true {
+			t.Fatalf("%s: unexpected output %v", name, out)
+		}
+	}
+
+	c := NewRemoteClient("policy-v1", map[string]string{DefaultTenant: closed.URL}, nil)
+	if _, err := c.Evaluate(context.Background(), "t_acme", map[string]any{}); err == nil {
+		t.Fatalf("expected an error without a fallback")
+	}
+}
+
+func TestRemoteClientRejectsBadResponses(t *testing.T) {
+	cases := map[string]func(w http.ResponseWriter){
+		"4xx":        func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+		"not json":   func(w http.ResponseWriter) { _, _ = w.Write([]byte("<html>")) },
+		"no result":  func(w http.ResponseWriter) { _, _ = w.Write([]byte(`{"performance":"1ms"}`)) },
+		"array":      func(w http.ResponseWriter) { _, _ = w.Write([]byte(`{"result":[true]}`)) },
+		"bad tags":   func(w http.ResponseWriter) { _, _ = w.Write([]byte(`{"result":{"blocked_tags":"beta"}}`)) },
+		"bad allow":  func(w http.ResponseWriter) { _, _ = w.Write([]byte(`{"result":{"allowed":"yes"}}`)) },
+		"bad member": func(w http.ResponseWriter) { _, _ = w.Write([]byte(`{"result":{"blocked_items":[1]}}`)) },
+	}
+	for name, respond := range cases {
+		srv := fakeAgent(t, func(w http.ResponseWriter, _ *http.Request, _ map[string]any) { respond(w) })
+		c := NewRemoteClient("policy-v1", map[string]string{"t_acme": srv.URL}, NewLocalClient("policy-v1"))
+		if out, err := c.Evaluate(context.Background(), "t_acme", map[string]any{}); err == nil {
+			t.Fatalf("%s: expected an error, got %v", name, out)
+		}
+	}
+}
+
+func TestParseRemoteTargets(t *testing.T) {
+	got, err := ParseRemoteTargets(" t_acme=https://agent/api/projects/a , *=http://agent:8080/api/projects/shared/ ")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got["t_acme"] != "https://agent/api/projects/a" || got[DefaultTenant] != "http://agent:8080/api/projects/shared" {
+		t.Fatalf("targets = %v", got)
+	}
+	for _, raw := range []string{"t_acme", "=http://agent", "t_acme=ftp://agent", "t_acme=http://a,t_acme=http://b"} {
+		if _, err := ParseRemoteTargets(raw); err == nil {
+			t.Fatalf("%q: expected an error", raw)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package pipeline
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
 
 // Stage is a deterministic pipeline stage. Stages must be pure with respect
 // to input payload + explicit external dependencies.
@@ -17,3 +22,102 @@ func Run(ctx context.Context, initial map[string]any, stages ...Stage) (map[stri
 	}
 	return payload, nil
 }
+
+// Named pairs a stage with the name it is traced under.
+type Named struct {
+	Name  string
+	Stage Stage
+}
+
+// Trace is the recorded outcome of one named stage.
+type Trace struct {
+	Stage   string
+	Outcome string
+	Message string
+}
+
+// Result lets a stage report an outcome other than "ok" (for example
+// "degraded" or "skipped") without aborting the run. Extra traces are
+// recorded right after the stage's own trace.
+type Result struct {
+	Outcome string
+	Message string
+	Extra   []Trace
+}
+
+func (r *Result) Error() string {
+	if r.Message == "" {
+		return r.Outcome
+	}
+	return r.Outcome + ": " + r.Message
+}
+
+// Outcome builds a Result for a stage to return as its error.
+func Outcome(outcome, message string, extra ...Trace) error {
+	return &Result{Outcome: outcome, Message: message, Extra: extra}
+}
+
+// RunNamed runs stages in order and traces each one. A stage returning a
+// *Result keeps the run going with the payload it returned (or the previous
+// payload when nil); any other error is traced as "failed" and stops the run.
+func RunNamed(ctx context.Context, initial map[string]any, stages ...Named) (map[string]any, []Trace, error) {
+	payload := initial
+	traces := make([]Trace, 0, len(stages))
+	for _, s := range stages {
+		next, err := s.Stage(ctx, payload)
+		var res *Result
+		switch {
+		case err == nil:
+			traces = append(traces, Trace{Stage: s.Name, Outcome: "ok"})
+		case errors.As(err, &res):
+			traces = append(traces, Trace{Stage: s.Name, Outcome: res.Outcome, Message: res.Message})
+			traces = append(traces, res.Extra...)
+		default:
+			traces = append(traces, Trace{Stage: s.Name, Outcome: "failed", Message: err.Error()})
+			return payload, traces, err
+		}
+		if next != nil {
+			payload = next
+		}
+	}
+	return payload, traces, nil
+}
+
+// Registry maps stage names to stages so callers can assemble pipelines from
+// configuration.
+type Registry struct {
+	mu     sync.RWMutex
+	stages map[string]Stage
+}
+
+func NewRegistry() *Registry {
+	return &Registry{stages: map[string]Stage{}}
+}
+
+// Register adds or replaces the stage registered under name.
+func (r *Registry) Register(name string, stage Stage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stages[name] = stage
+}
+
+// Resolve returns the named stages in the order given, failing on the first
+// unknown or repeated name.
+func (r *Registry) Resolve(names []string) ([]Named, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Named, 0, len(names))
+	seen := map[string]struct{}{}
+	for _, name := range names {
+		stage, ok := r.stages[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown stage %q", name)
+		}
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("stage %q listed twice", name)
+		}
+		seen[name] = struct{}{}
+		out = append(out, Named{Name: name, Stage: stage})
+	}
+	return out, nil
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func appendStage(v string) Stage {
+	return func(_ context.Context, payload map[string]any) (map[string]any, error) {
+		seen, _ := payload["seen"].([]string)
+		return map[string]any{"seen": append(append([]string{}, seen...), v)}, nil
+	}
+}
+
+func TestRunNamedTracesEveryStage(t *testing.T) {
+	degrade := func(_ context.Context, payload map[string]any) (map[string]any, error) {
+		return nil, Outcome("degraded", "upstream down", Trace{Stage: "fallback", Outcome: "ok"})
+	}
+	payload, traces, err := RunNamed(context.Background(), map[string]any{},
+		Named{Name: "a", Stage: appendStage("a")},
+		Named{Name: "b", Stage: degrade},
+		Named{Name: "c", Stage: appendStage("c")},
+	)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := payload["seen"]; !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Fatalf("payload = %v", got)
+	}
+	want := []Trace{
+		{Stage: "a", Outcome: "ok"},
+		{Stage: "b", Outcome: "degraded", Message: "upstream down"},
+		{Stage: "fallback", Outcome: "ok"},
+		{Stage: "c", Outcome: "ok"},
+	}
+	if !reflect.DeepEqual(traces, want) {
+		t.Fatalf("traces = %+v", traces)
+	}
+}
+
+func TestRunNamedStopsOnHardError(t *testing.T) {
+	boom := func(context.Context, map[string]any) (map[string]any, error) {
+		return nil, errors.New("boom")
+	}
+	_, traces, err := RunNamed(context.Background(), map[string]any{},
+		Named{Name: "boom", Stage: boom},
+		Named{Name: "never", Stage: appendStage("x")},
+	)
+	if err == nil || len(traces) != 1 || traces[0].Outcome != "failed" {
+		t.Fatalf("unexpected result traces=%+v err=%v", traces, err)
+	}
+}
+
+func TestRegistryResolve(t *testing.T) {
+	r := NewRegistry()
+	r.Register("a", appendStage("a"))
+	r.Register("b", appendStage("b"))
+
+	named, err := r.Resolve([]string{"b", "a"})
+	if err != nil || len(named) != 2 || named[0].Name != "b" {
+		t.Fatalf("resolve: %+v %v", named, err)
+	}
+	if _, err := r.Resolve([]string{"a", "missing"}); err == nil {
+		t.Fatalf("expected unknown stage error")
+	}
+	if _, err := r.Resolve([]string{"a", "a"}); err == nil {
+		t.Fatalf("expected duplicate stage error")
+	}
+}
@@ -0,0 +1,82 @@
+package canonical
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"testing"
+)
+
+// jcs_vectors.json is shared with the TypeScript and Python clients; keep it
+// the single source of truth for canonical forms and v2 hashes.
+type vector struct {
+	Name      string `json:"name"`
+	Input     string `json:"input"`
+	Canonical string `json:"canonical"`
+	Hash      string `json:"hash"`
+}
+
+func TestGoldenVectors(t *testing.T) {
+	raw, err := os.ReadFile("testdata/jcs_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vectors {
+		got, err := Canonicalize([]byte(v.Input))
+		if err != nil {
+			t.Fatalf("%s: %v", v.Name, err)
+		}
+		if string(got) != v.Canonical {
+			t.Fatalf("%s: canonical form\n got: %s\nwant: %s", v.Name, got, v.Canonical)
+		}
+		h, err := Hash(V2, json.RawMessage(v.Input))
+		if err != nil || h != v.Hash {
+			t.Fatalf("%s: hash %s (err %v), want %s", v.Name, h, err, v.Hash)
+		}
+	}
+}
+
+func TestFormatNumberRejectsNonFinite(t *testing.T) {
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := FormatNumber(f); err == nil {
+			t.Fatalf("expected error for %v", f)
+		}
+	}
+}
+
+func TestCanonicalizeRejectsDuplicatesAndTrailingData(t *testing.T) {
+	if _, err := Canonicalize([]byte(`{"a":1,"a":2}`)); err == nil {
+		t.Fatalf("expected duplicate member to be rejected")
+	}
+	if _, err := Canonicalize([]byte(`{"a":1} {}`)); err == nil {
+		t.Fatalf("expected trailing data to be rejected")
+	}
+}
+
+func TestVerifyHashAcceptsLegacyAndCurrent(t *testing.T) {
+	doc := map[string]any{"b": 1.5, "a": "<x>"}
+	legacy, _ := Hash(V1, doc)
+	current, _ := Hash(V2, doc)
+	if HashVersion(legacy) != V1 || HashVersion(current) != V2 {
+		t.Fatalf("unexpected versions %s %s", HashVersion(legacy), HashVersion(current))
+	}
+	if len(Digest(current)) != 64 || Digest(legacy) != legacy {
+		t.Fatalf("unexpected digests %s %s", Digest(legacy), Digest(current))
+	}
+	for _, h := range []string{legacy, current} {
+		ok, err := VerifyHash(h, doc)
+		if err != nil || !ok {
+			t.Fatalf("expected %s to verify, got %v %v", h, ok, err)
+		}
+	}
+	if ok, _ := VerifyHash(current, map[string]any{"b": 1.5}); ok {
+		t.Fatalf("expected changed document to fail verification")
+	}
+	if _, err := VerifyHash("v9:00", doc); err == nil {
+		t.Fatalf("expected unknown version to error")
+	}
+}
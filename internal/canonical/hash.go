@@ -0,0 +1,72 @@
+package canonical
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Hash versions. V1 is the legacy scheme: SHA-256 over encoding/json output,
+// written as bare hex. V2 is SHA-256 over the RFC 8785 form, written as
+// "v2:" followed by the hex digest. New hashes use Current; V1 hashes are
+// still accepted by VerifyHash.
+const (
+	V1      = "v1"
+	V2      = "v2"
+	Current = V2
+)
+
+const versionSep = ":"
+
+// Hash returns the versioned content hash of v.
+func Hash(version string, v any) (string, error) {
+	var raw []byte
+	var err error
+	switch version {
+	case V1:
+		raw, err = json.Marshal(v)
+	case V2:
+		raw, err = Marshal(v)
+	default:
+		return "", fmt.Errorf("unknown hash version %q", version)
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	digest := hex.EncodeToString(sum[:])
+	if version == V1 {
+		return digest, nil
+	}
+	return version + versionSep + digest, nil
+}
+
+// HashVersion reports the version a hash was made with. Unprefixed hashes
+// are V1.
+func HashVersion(h string) string {
+	if version, _, ok := strings.Cut(h, versionSep); ok {
+		return version
+	}
+	return V1
+}
+
+// Digest strips the version prefix, leaving the hex digest.
+func Digest(h string) string {
+	if _, digest, ok := strings.Cut(h, versionSep); ok {
+		return digest
+	}
+	return h
+}
+
+// VerifyHash recomputes the hash of v with the version h was made with and
+// reports whether they match.
+func VerifyHash(h string, v any) (bool, error) {
+	got, err := Hash(HashVersion(h), v)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(h)) == 1, nil
+}
@@ -0,0 +1,120 @@
+package decision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CatalogSelector sources candidates from the tenant catalog instead of the
+// request body: either every item in Segment (a taxonomy tag and its
+// descendants) or the listed ItemIDs.
+type CatalogSelector struct {
+	Segment string   `json:"segment,omitempty"`
+	ItemIDs []string `json:"item_ids,omitempty"`
+}
+
+// CatalogPersistence resolves catalog-backed candidates. ResolveCatalog
+// returns a JSON array of candidate items as of revision.
+type CatalogPersistence interface {
+	CatalogRevision(ctx context.Context, tenantID string) (int64, error)
+	ResolveCatalog(ctx context.Context, tenantID string, revision int64, segment string, itemIDs []string) ([]byte, error)
+}
+
+const catalogVersionSep = "+cat."
+
+// CatalogDataVersion is the data_version of a tenant whose catalog is at
+// revision: the engine data version with the revision appended, so every
+// catalog change yields a new data_version.
+func CatalogDataVersion(base string, revision int64) string {
+	return base + catalogVersionSep + strconv.FormatInt(revision, 10)
+}
+
+// ParseCatalogDataVersion splits a data_version built by CatalogDataVersion.
+func ParseCatalogDataVersion(dataVersion string) (string, int64, bool) {
+	i := strings.LastIndex(dataVersion, catalogVersionSep)
+	if i < 0 {
+		return dataVersion, 0, false
+	}
+	rev, err := strconv.ParseInt(dataVersion[i+len(catalogVersionSep):], 10, 64)
+	if err != nil || rev < 0 {
+		return dataVersion, 0, false
+	}
+	return dataVersion[:i], rev, true
+}
+
+// WithCatalog lets requests reference catalog items instead of carrying
+// candidate attributes.
+func WithCatalog(p CatalogPersistence) Option {
+	return func(e *Engine) {
+		e.catalog = p
+	}
+}
+
+func (s CatalogSelector) Validate() error {
+	hasSegment := strings.TrimSpace(s.Segment) != ""
+	if hasSegment == (len(s.ItemIDs) > 0) {
+		return fmt.Errorf("catalog requires exactly one of segment or item_ids")
+	}
+	return nil
+}
+
+// resolveCatalog fills req.CandidateItems from the catalog. The revision comes
+// from a pinned catalog data_version (replays) or the tenant's current
+// revision, and the returned engine carries the matching data_version.
+func (e *Engine) resolveCatalog(ctx context.Context, req DecisionRequest) (*Engine, DecisionRequest, []StageTrace) {
+	if req.Catalog == nil {
+		return e, req, nil
+	}
+	trace := StageTrace{Stage: "catalog_resolve", Outcome: "ok"}
+	if e.catalog == nil {
+		trace.Outcome = "degraded"
+		trace.ErrMessage = "catalog not configured"
+		req.CandidateItems = nil
+		return e, req, []StageTrace{trace}
+	}
+
+	base, rev, pinned := ParseCatalogDataVersion(e.DataVersion)
+	if !pinned {
+		current, err := e.catalog.CatalogRevision(ctx, req.TenantID)
+		if err != nil {
+			trace.Outcome = "degraded"
+			trace.ErrMessage = err.Error()
+			req.CandidateItems = nil
+			return e, req, []StageTrace{trace}
+		}
+		rev = current
+	}
+	eng := e.WithVersions(e.PolicyVersion, CatalogDataVersion(base, rev))
+
+	raw, err := e.catalog.ResolveCatalog(ctx, req.TenantID, rev, req.Catalog.Segment, req.Catalog.ItemIDs)
+	var items []CandidateItem
+	if err == nil {
+		err = json.Unmarshal(raw, &items)
+	}
+	if err != nil {
+		trace.Outcome = "degraded"
+		trace.ErrMessage = err.Error()
+		req.CandidateItems = nil
+		return eng, req, []StageTrace{trace}
+	}
+	req.CandidateItems = items
+	if len(req.Catalog.ItemIDs) > 0 {
+		found := make(map[string]struct{}, len(items))
+		for _, it := range items {
+			found[it.ItemID] = struct{}{}
+		}
+		missing := 0
+		for _, id := range req.Catalog.ItemIDs {
+			if _, ok := found[id]; !ok {
+				missing++
+			}
+		}
+		if missing > 0 {
+			trace.ErrMessage = fmt.Sprintf("missing_items=%d", missing)
+		}
+	}
+	return eng, req, []StageTrace{trace}
+}
@@ -0,0 +1,129 @@
+package decision
+
+import (
+	"math"
+	"sort"
+)
+
+// scoreEpsilon absorbs float noise when comparing recomputed scores.
+const scoreEpsilon = 1e-9
+
+// DecisionDiff compares two decisions over the same request.
+type DecisionDiff struct {
+	HashMatch       bool         `json:"hash_match"`
+	BaselineHash    string       `json:"baseline_hash"`
+	CandidateHash   string       `json:"candidate_hash"`
+	OrderChanged    bool         `json:"order_changed"`
+	ItemsAdded      []string     `json:"items_added,omitempty"`
+	ItemsRemoved    []string     `json:"items_removed,omitempty"`
+	RankChanges     []RankChange `json:"rank_changes,omitempty"`
+	ScoreDeltas     []ScoreDelta `json:"score_deltas,omitempty"`
+	MaxScoreDelta   float64      `json:"max_score_delta"`
+	StagesMatch     bool         `json:"stages_match"`
+	VersionsChanged bool         `json:"versions_changed"`
+}
+
+type RankChange struct {
+	ItemID        string `json:"item_id"`
+	BaselineRank  int    `json:"baseline_rank"`
+	CandidateRank int    `json:"candidate_rank"`
+}
+
+type ScoreDelta struct {
+	ItemID         string  `json:"item_id"`
+	BaselineScore  float64 `json:"baseline_score"`
+	CandidateScore float64 `json:"candidate_score"`
+	Delta          float64 `json:"delta"`
+}
+
+// Mismatch reports whether the candidate diverges from the baseline in hash
+// or ranked output.
+func (d DecisionDiff) Mismatch() bool {
+	return !d.HashMatch || d.OrderChanged || len(d.ItemsAdded) > 0 || len(d.ItemsRemoved) > 0 || len(d.ScoreDeltas) > 0
+}
+
+// CompareDecisions diffs candidate against baseline. Ranks are zero-based.
+// All slices are ordered by item_id so the diff itself is deterministic.
+func CompareDecisions(baseline, candidate DecisionResponse) DecisionDiff {
+	d := DecisionDiff{
+		HashMatch:       baseline.DecisionHash == candidate.DecisionHash,
+		BaselineHash:    baseline.DecisionHash,
+		CandidateHash:   candidate.DecisionHash,
+		StagesMatch:     stagesEqual(baseline.Stages, candidate.Stages),
+		VersionsChanged: baseline.PolicyVersion != candidate.PolicyVersion || baseline.DataVersion != candidate.DataVersion,
+	}
+
+	baseRank := rankIndex(baseline.Items)
+	candRank := rankIndex(candidate.Items)
+	for id, br := range baseRank {
+		cr, ok := candRank[id]
+		if !ok {
+			d.ItemsRemoved = append(d.ItemsRemoved, id)
+			continue
+		}
+		if br != cr {
+			d.RankChanges = append(d.RankChanges, RankChange{ItemID: id, BaselineRank: br, CandidateRank: cr})
+		}
+		bs, cs := baseline.Items[br].Score, candidate.Items[cr].Score
+		if delta := cs - bs; math.Abs(delta) > scoreEpsilon {
+			d.ScoreDeltas = append(d.ScoreDeltas, ScoreDelta{ItemID: id, BaselineScore: bs, CandidateScore: cs, Delta: delta})
+			if math.Abs(delta) > d.MaxScoreDelta {
+				d.MaxScoreDelta = math.Abs(delta)
+			}
+		}
+	}
+	for id := range candRank {
+		if _, ok := baseRank[id]; !ok {
+			d.ItemsAdded = append(d.ItemsAdded, id)
+		}
+	}
+	d.OrderChanged = len(d.RankChanges) > 0 || len(d.ItemsAdded) > 0 || len(d.ItemsRemoved) > 0
+
+	sort.Strings(d.ItemsAdded)
+	sort.Strings(d.ItemsRemoved)
+	sort.Slice(d.RankChanges, func(i, j int) bool { return d.RankChanges[i].ItemID < d.RankChanges[j].ItemID })
+	sort.Slice(d.ScoreDeltas, func(i, j int) bool { return d.ScoreDeltas[i].ItemID < d.ScoreDeltas[j].ItemID })
+	return d
+}
+
+func rankIndex(items []RankedItem) map[string]int {
+	out := make(map[string]int, len(items))
+	for i, item := range items {
+		out[item.ItemID] = i
+	}
+	return out
+}
+
+// stagesEqual compares stages as they are hashed, ignoring which policy
+// evaluator answered.
+func stagesEqual(a, b []StageTrace) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = hashableStages(a), hashableStages(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RankDivergence is the fraction of ranked positions whose item differs
+// between two rankings, in [0, 1]. Identical rankings score 0.
+func RankDivergence(baseline, candidate []RankedItem) float64 {
+	n := len(baseline)
+	if len(candidate) > n {
+		n = len(candidate)
+	}
+	if n == 0 {
+		return 0
+	}
+	differ := 0
+	for i := 0; i < n; i++ {
+		if i >= len(baseline) || i >= len(candidate) || baseline[i].ItemID != candidate[i].ItemID {
+			differ++
+		}
+	}
+	return float64(differ) / float64(n)
+}
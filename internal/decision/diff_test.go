@@ -0,0 +1,175 @@
+package decision
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorules"
+)
+
+type failingGorse struct{}
+
+func (failingGorse) Recommend(context.Context, string, int) ([]string, error) {
+	return nil, errors.New("gorse_down")
+}
+
+func replayRequestFixture() DecisionRequest {
+	return DecisionRequest{
+		TenantID: "t",
+		UserID:   "u",
+		Surface:  "home",
+		Context:  map[string]string{"plan": "enterprise"},
+		CandidateItems: []CandidateItem{
+			{ItemID: "a", BaseScore: 3, Tags: []string{"enterprise"}},
+			{ItemID: "b", BaseScore: 5},
+			{ItemID: "c", BaseScore: 4, Tags: []string{"promo"}},
+		},
+	}
+}
+
+func TestRecomputeReproducesHashFromStoredInputs(t *testing.T) {
+	live := NewEngine("policy-v1", "data-v1", stubGorse{ids: []string{"c", "a"}}, stubPolicy{})
+	original, inputs := live.DecideRecorded(context.Background(), replayRequestFixture())
+
+	// Round-trip through JSON the way the decisions table stores them.
+	rawReq, _ := json.Marshal(CanonicalRequest(replayRequestFixture()))
+	rawIn, _ := json.Marshal(inputs)
+	var req DecisionRequest
+	var in DecisionInputs
+	_ = json.Unmarshal(rawReq, &req)
+	_ = json.Unmarshal(rawIn, &in)
+
+	// Gorse has since retrained; recompute must not consult it.
+	later := NewEngine("policy-v1", "data-v1", stubGorse{ids: []string{"b"}}, stubPolicy{})
+	recomputed := later.Recompute(context.Background(), req, in)
+
+	diff := CompareDecisions(original, recomputed)
+	if !diff.HashMatch || diff.Mismatch() {
+		t.Fatalf("expected exact recompute, got %#v", diff)
+	}
+	if !diff.StagesMatch {
+		t.Fatalf("expected identical stages")
+	}
+}
+
+func TestRecomputePreservesDegradedGorseStage(t *testing.T) {
+	live := NewEngine("policy-v1", "data-v1", failingGorse{}, stubPolicy{})
+	original, inputs := live.DecideRecorded(context.Background(), replayRequestFixture())
+	if original.DependencyStatus != "degraded" {
+		t.Fatalf("expected degraded decision, got %s", original.DependencyStatus)
+	}
+	recomputed := NewEngine("policy-v1", "data-v1", stubGorse{ids: []string{"a"}}, stubPolicy{}).
+		Recompute(context.Background(), replayRequestFixture(), inputs)
+	if recomputed.DecisionHash != original.DecisionHash || recomputed.DependencyStatus != "degraded" {
+		t.Fatalf("expected degraded recompute to match, got %s/%s", recomputed.DecisionHash, recomputed.DependencyStatus)
+	}
+}
+
+type failingPolicy struct{}
+
+func (failingPolicy) Evaluate(context.Context, string, map[string]any) (map[string]any, error) {
+	return nil, errors.New("policy unavailable")
+}
+
+func TestRecomputeReusesRecordedPolicyEvaluation(t *testing.T) {
+	live := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{blocked: []string{"promo"}})
+	original, inputs := live.DecideRecorded(context.Background(), replayRequestFixture())
+	if inputs.Policy == nil || !reflect.DeepEqual(inputs.Policy.BlockedTags, []string{"promo"}) {
+		t.Fatalf("expected the policy output recorded, got %+v", inputs.Policy)
+	}
+	rawIn, _ := json.Marshal(inputs)
+	var in DecisionInputs
+	_ = json.Unmarshal(rawIn, &in)
+
+	// The policy document has since changed and then become unreachable;
+	// recompute must filter with what the decision recorded.
+	for _, policy := range []gorules.Client{stubPolicy{}, failingPolicy{}} {
+		recomputed := NewEngine("policy-v1", "data-v1", stubGorse{}, policy).Recompute(context.Background(), replayRequestFixture(), in)
+		if recomputed.DecisionHash != original.DecisionHash || len(recomputed.Items) != 2 {
+			t.Fatalf("expected the recorded filters reused, got %+v", recomputed.Items)
+		}
+	}
+
+	// A different policy version is evaluated live, as are inputs recorded
+	// before policy outputs were.
+	other := NewEngine("policy-v2", "data-v1", stubGorse{}, stubPolicy{}).Recompute(context.Background(), replayRequestFixture(), in)
+	in.Policy = nil
+	legacy := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}).Recompute(context.Background(), replayRequestFixture(), in)
+	if len(other.Items) != 3 || len(legacy.Items) != 3 {
+		t.Fatalf("expected live evaluation, got %d and %d items", len(other.Items), len(legacy.Items))
+	}
+}
+
+func TestRecomputePreservesDegradedPolicyStage(t *testing.T) {
+	original, inputs := NewEngine("policy-v1", "data-v1", stubGorse{}, failingPolicy{}).DecideRecorded(context.Background(), replayRequestFixture())
+	if inputs.Policy == nil || inputs.Policy.Outcome != "degraded" {
+		t.Fatalf("expected the failed evaluation recorded, got %+v", inputs.Policy)
+	}
+	recomputed := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}).Recompute(context.Background(), replayRequestFixture(), inputs)
+	if recomputed.DecisionHash != original.DecisionHash || recomputed.DependencyStatus != "degraded" {
+		t.Fatalf("expected degraded recompute to match, got %s/%s", recomputed.DecisionHash, recomputed.DependencyStatus)
+	}
+}
+
+func TestCompareDecisionsReportsOrderAndScoreChanges(t *testing.T) {
+	baseline := DecisionResponse{
+		DecisionHash: "h1",
+		Items:        []RankedItem{{ItemID: "a", Score: 3}, {ItemID: "b", Score: 2}, {ItemID: "c", Score: 1}},
+	}
+	candidate := DecisionResponse{
+		DecisionHash: "h2",
+		Items:        []RankedItem{{ItemID: "b", Score: 4}, {ItemID: "a", Score: 3}, {ItemID: "d", Score: 0.5}},
+	}
+	diff := CompareDecisions(baseline, candidate)
+	if diff.HashMatch || !diff.OrderChanged || !diff.Mismatch() {
+		t.Fatalf("expected mismatch, got %#v", diff)
+	}
+	if len(diff.ItemsAdded) != 1 || diff.ItemsAdded[0] != "d" {
+		t.Fatalf("expected d added, got %#v", diff.ItemsAdded)
+	}
+	if len(diff.ItemsRemoved) != 1 || diff.ItemsRemoved[0] != "c" {
+		t.Fatalf("expected c removed, got %#v", diff.ItemsRemoved)
+	}
+	if len(diff.RankChanges) != 2 || diff.RankChanges[0].ItemID != "a" || diff.RankChanges[0].CandidateRank != 1 {
+		t.Fatalf("unexpected rank changes %#v", diff.RankChanges)
+	}
+	if len(diff.ScoreDeltas) != 1 || diff.ScoreDeltas[0].ItemID != "b" || diff.ScoreDeltas[0].Delta != 2 || diff.MaxScoreDelta != 2 {
+		t.Fatalf("unexpected score deltas %#v", diff.ScoreDeltas)
+	}
+}
+
+func TestWithVersionsPinsVersionsAndChangesHash(t *testing.T) {
+	base := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{})
+	pinned := base.WithVersions("policy-v2", "data-v7")
+	if base.PolicyVersion != "policy-v1" || pinned.PolicyVersion != "policy-v2" || pinned.DataVersion != "data-v7" {
+		t.Fatalf("expected copy with pinned versions, got base=%s pinned=%s/%s", base.PolicyVersion, pinned.PolicyVersion, pinned.DataVersion)
+	}
+	r1 := base.Decide(context.Background(), replayRequestFixture())
+	r2 := pinned.Decide(context.Background(), replayRequestFixture())
+	if r1.DecisionHash == r2.DecisionHash {
+		t.Fatalf("expected version change to alter decision hash")
+	}
+	if !CompareDecisions(r1, r2).VersionsChanged {
+		t.Fatalf("expected versions_changed in diff")
+	}
+}
+
+func TestRankDivergence(t *testing.T) {
+	a := []RankedItem{{ItemID: "x"}, {ItemID: "y"}, {ItemID: "z"}}
+	if got := RankDivergence(a, a); got != 0 {
+		t.Fatalf("expected zero divergence for identical rankings, got %v", got)
+	}
+	swapped := []RankedItem{{ItemID: "y"}, {ItemID: "x"}, {ItemID: "z"}}
+	if got := RankDivergence(a, swapped); got != 2.0/3.0 {
+		t.Fatalf("expected 2/3 divergence, got %v", got)
+	}
+	if got := RankDivergence(a, a[:2]); got != 1.0/3.0 {
+		t.Fatalf("expected truncated tail to count, got %v", got)
+	}
+	if got := RankDivergence(nil, nil); got != 0 {
+		t.Fatalf("expected empty rankings to agree, got %v", got)
+	}
+}
@@ -2,15 +2,15 @@ package decision
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/restarone/violet-deterministic-api/internal/adapters/gorse"
 	"github.com/restarone/violet-deterministic-api/internal/adapters/gorules"
+	"github.com/restarone/violet-deterministic-api/internal/adapters/pipeline"
+	"github.com/restarone/violet-deterministic-api/internal/canonical"
 )
 
 type Engine struct {
@@ -19,104 +19,300 @@ type Engine struct {
 
 	gorse  gorse.Client
 	policy gorules.Client
+	rules  RulePersistence
+
+	snapshots   SnapshotPersistence
+	catalog     CatalogPersistence
+	experiments ExperimentPersistence
+	exposures   ExposurePersistence
+	activations PolicyPersistence
+	registry    *pipeline.Registry
+
+	ruleCache    *sync.Map
+	ruleOverride *RuleSet
+	readOnly     bool
+}
+
+// DecisionInputs records the upstream retrieval results a decision consumed so
+// Recompute can re-run the engine without calling Gorse again. The policy
+// resolution, policy evaluation and experiment assignment are recorded too,
+// so a replay keeps its stages, filters and variant even after the
+// activation, policy document or experiment changes, as is the exposure
+// snapshot a frequency cap used.
+type DecisionInputs struct {
+	PolicyStage     *StageTrace           `json:"policy_stage,omitempty"`
+	Policy          *PolicyEvaluation     `json:"policy,omitempty"`
+	GorseIDs        []string              `json:"gorse_ids"`
+	GorseStage      StageTrace            `json:"gorse_stage"`
+	FallbackStages  []StageTrace          `json:"fallback_stages,omitempty"`
+	Experiment      *ExperimentAssignment `json:"experiment,omitempty"`
+	ExperimentStage *StageTrace           `json:"experiment_stage,omitempty"`
+	Exposure        *ExposureSnapshot     `json:"exposure,omitempty"`
+	ExposureError   string                `json:"exposure_error,omitempty"`
+	// HashVersion is the canonical.Hash version the decision hash was made
+	// with. Inputs recorded before versioned hashes leave it empty (v1).
+	HashVersion string `json:"hash_version,omitempty"`
+}
+
+type Option func(*Engine)
+
+// WithRuleSets makes the engine load tenant rule sets keyed by policy_version.
+// Without it every decision uses DefaultRuleSet.
+func WithRuleSets(p RulePersistence) Option {
+	return func(e *Engine) {
+		e.rules = p
+	}
 }
 
-func NewEngine(policyVersion, dataVersion string, gorseClient gorse.Client, policyClient gorules.Client) *Engine {
-	return &Engine{
+func NewEngine(policyVersion, dataVersion string, gorseClient gorse.Client, policyClient gorules.Client, opts ...Option) *Engine {
+	e := &Engine{
 		PolicyVersion: policyVersion,
 		DataVersion:   dataVersion,
 		gorse:         gorseClient,
 		policy:        policyClient,
+		ruleCache:     &sync.Map{},
+		registry:      pipeline.NewRegistry(),
+	}
+	registerBuiltinStages(e.registry)
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// WithVersions returns an engine sharing this engine's adapters and caches but
+// pinned to the given policy and data versions.
+func (e *Engine) WithVersions(policyVersion, dataVersion string) *Engine {
+	cp := *e
+	cp.PolicyVersion = policyVersion
+	cp.DataVersion = dataVersion
+	return &cp
+}
+
+// WithRuleSet returns an engine that scores with rs instead of loading the
+// stored rule set. Used for what-if simulation of unpublished rules.
+func (e *Engine) WithRuleSet(rs RuleSet) *Engine {
+	cp := *e
+	cp.ruleOverride = &rs
+	return &cp
+}
+
+// RuleSet resolves the rule set for tenantID at the engine policy version.
+// The returned outcome is "ok" for a stored rule set, "default" when none is
+// stored, "override" for a WithRuleSet engine and "degraded" when loading
+// failed.
+func (e *Engine) RuleSet(ctx context.Context, tenantID string) (RuleSet, string, error) {
+	if e.ruleOverride != nil {
+		return *e.ruleOverride, "override", nil
+	}
+	if e.rules == nil {
+		return DefaultRuleSet(e.PolicyVersion), "default", nil
+	}
+	cacheKey := tenantID + "|" + e.PolicyVersion
+	if cached, ok := e.ruleCache.Load(cacheKey); ok {
+		return cached.(RuleSet), "ok", nil
 	}
+	raw, found, err := e.rules.GetRuleSet(ctx, tenantID, e.PolicyVersion)
+	if err != nil {
+		return DefaultRuleSet(e.PolicyVersion), "degraded", err
+	}
+	if !found {
+		return DefaultRuleSet(e.PolicyVersion), "default", nil
+	}
+	rs, err := ParseRuleSet(raw)
+	if err != nil {
+		return DefaultRuleSet(e.PolicyVersion), "degraded", err
+	}
+	// Rule sets are immutable per policy_version, so caching never goes stale.
+	e.ruleCache.Store(cacheKey, rs)
+	return rs, "ok", nil
 }
 
 func (e *Engine) Decide(ctx context.Context, req DecisionRequest) DecisionResponse {
-	stages := make([]StageTrace, 0, 3)
-	dependencyStatus := "ok"
+	resp, _ := e.DecideRecorded(ctx, req)
+	return resp
+}
 
-	gorseIDs := make([]string, 0)
-	if e.gorse != nil {
-		ids, err := e.gorse.Recommend(ctx, req.UserID, len(req.CandidateItems))
+// DecideRecorded is Decide plus the retrieval inputs it used, for storage
+// alongside the decision.
+func (e *Engine) DecideRecorded(ctx context.Context, req DecisionRequest) (DecisionResponse, DecisionInputs) {
+	eng, policyStage := e.resolvePolicy(ctx, req)
+	eng, assignment, assignStage := eng.assignExperiment(ctx, req)
+	eng, req, pre := eng.resolveCatalog(ctx, req)
+	rules := eng.loadRules(ctx, req.TenantID)
+	var in DecisionInputs
+	if hasTag(rules.set.Pipeline(req.Surface), "gorse_recommend") {
+		in = eng.retrieve(ctx, req)
+	}
+	in.PolicyStage = policyStage
+	in.Experiment = assignment
+	in.ExperimentStage = assignStage
+	if c, ok := rules.set.FrequencyCap(req.Surface); ok {
+		in.Exposure, in.ExposureError = eng.captureExposure(ctx, req, c)
+	}
+	in.HashVersion = canonical.Current
+	resp, policy := eng.evaluate(ctx, req, in, rules, pre)
+	in.Policy = policy
+	return resp, in
+}
+
+// Recompute re-runs the engine against previously recorded inputs. Given the
+// same request, inputs, versions and rule set it reproduces the original
+// decision hash. Catalog-backed requests re-resolve from the catalog revision
+// pinned in the data_version; policy resolution and experiment assignments
+// come from the inputs, and the engine is expected to be pinned to the policy
+// version the decision recorded. The recorded policy evaluation is reused
+// when the rule set runs under the policy version it was made with; other
+// versions, and inputs recorded before policy outputs were, evaluate live.
+func (e *Engine) Recompute(ctx context.Context, req DecisionRequest, in DecisionInputs) DecisionResponse {
+	eng, req, pre := e.resolveCatalog(ctx, req)
+	resp, _ := eng.evaluate(ctx, req, in, eng.loadRules(ctx, req.TenantID), pre)
+	return resp
+}
+
+type loadedRules struct {
+	set   RuleSet
+	trace StageTrace
+}
+
+func (e *Engine) loadRules(ctx context.Context, tenantID string) loadedRules {
+	rs, outcome, err := e.RuleSet(ctx, tenantID)
+	trace := StageTrace{Stage: "rule_load", Outcome: outcome}
+	if err != nil {
+		trace.ErrMessage = err.Error()
+	}
+	return loadedRules{set: rs, trace: trace}
+}
+
+func (e *Engine) retrieve(ctx context.Context, req DecisionRequest) DecisionInputs {
+	if e.gorse == nil {
+		return DecisionInputs{GorseStage: StageTrace{Stage: "gorse_recommend", Outcome: "skipped"}}
+	}
+	n := len(req.CandidateItems)
+	snapshotted := e.snapshots != nil && req.UserID != ""
+	var pinned *gorseSnapshot
+	if snapshotted {
+		snap, ok, err := e.loadGorseSnapshot(ctx, req)
 		if err != nil {
-			dependencyStatus = "degraded"
-			stages = append(stages, StageTrace{Stage: "gorse_recommend", Outcome: "degraded", ErrMessage: err.Error()})
-		} else {
-			gorseIDs = ids
-			stages = append(stages, StageTrace{Stage: "gorse_recommend", Outcome: "ok"})
+			return DecisionInputs{GorseStage: StageTrace{Stage: "gorse_recommend", Outcome: "degraded", ErrMessage: "snapshot: " + err.Error()}}
+		}
+		if ok && snap.covers(n) {
+			return DecisionInputs{GorseIDs: snap.items(n), GorseStage: StageTrace{Stage: "gorse_recommend", Outcome: "ok"}}
+		}
+		if ok {
+			pinned = &snap
 		}
-	} else {
-		stages = append(stages, StageTrace{Stage: "gorse_recommend", Outcome: "skipped"})
 	}
-
-	blockedTags := map[string]struct{}{}
-	if e.policy != nil {
-		policyIn := map[string]any{
-			"surface":       req.Surface,
-			"context":       req.Context,
-			"candidate_len": len(req.CandidateItems),
+	if e.readOnly {
+		ctx = gorse.WithoutLastGood(ctx)
+	}
+	ids, trace, _ := gorse.RecommendTraced(ctx, e.gorse, req.UserID, n)
+	in := DecisionInputs{GorseIDs: ids}
+	for _, a := range trace {
+		if a.Source == gorse.SourcePrimary {
+			in.GorseStage = StageTrace{Stage: "gorse_recommend", Outcome: a.Outcome, ErrMessage: a.Err}
+			continue
 		}
-		out, err := e.policy.Evaluate(ctx, req.TenantID, policyIn)
+		in.FallbackStages = append(in.FallbackStages, StageTrace{Stage: "gorse_fallback_" + a.Source, Outcome: a.Outcome, ErrMessage: a.Err})
+	}
+	// Only personalized results are snapshotted; fallback lists are not the
+	// retrieval input a data_version should be pinned to.
+	if snapshotted && !e.readOnly && in.GorseStage.Outcome == "ok" {
+		stored, err := e.storeGorseSnapshot(ctx, req, pinned, n, ids)
 		if err != nil {
-			dependencyStatus = "degraded"
-			stages = append(stages, StageTrace{Stage: "policy_eval", Outcome: "degraded", ErrMessage: err.Error()})
-		} else {
-			if denyRaw, ok := out["blocked_tags"]; ok {
-				if deny, ok := denyRaw.([]string); ok {
-					for _, t := range deny {
-						blockedTags[t] = struct{}{}
-					}
-				}
-			}
-			stages = append(stages, StageTrace{Stage: "policy_eval", Outcome: "ok"})
+			in.GorseStage = StageTrace{Stage: "gorse_recommend", Outcome: "degraded", ErrMessage: "snapshot: " + err.Error()}
+			return in
 		}
-	} else {
-		stages = append(stages, StageTrace{Stage: "policy_eval", Outcome: "skipped"})
+		in.GorseIDs = stored.items(n)
 	}
+	return in
+}
 
-	gorseRank := map[string]int{}
-	for i, itemID := range gorseIDs {
-		gorseRank[itemID] = i
+// evaluate runs the pipeline over in and returns the decision along with the
+// policy evaluation it used, for recording with the inputs.
+func (e *Engine) evaluate(ctx context.Context, req DecisionRequest, in DecisionInputs, rules loadedRules, pre []StageTrace) (DecisionResponse, *PolicyEvaluation) {
+	stages := []StageTrace{}
+	if in.PolicyStage != nil {
+		stages = append(stages, *in.PolicyStage)
 	}
+	if in.ExperimentStage != nil {
+		stages = append(stages, *in.ExperimentStage)
+	}
+	stages = append(append(stages, pre...), rules.trace)
+	ruleSetHash := rules.set.HashWith(in.hashVersion())
 
-	scored := make([]RankedItem, 0, len(req.CandidateItems))
-	plan := req.Context["plan"]
-	for _, c := range req.CandidateItems {
-		if c.Blocked || hasBlockedTag(c.Tags, blockedTags) {
-			continue
-		}
-		score := c.BaseScore
-		if plan == "enterprise" && hasTag(c.Tags, "enterprise") {
-			score += 10
-		}
-		if rank, ok := gorseRank[c.ItemID]; ok {
-			score += float64(len(gorseIDs)-rank) * 0.01
+	stageNames := rules.set.Pipeline(req.Surface)
+	resolved, err := e.registry.Resolve(stageNames)
+	if err != nil {
+		// A stored rule set can name a stage this build does not register;
+		// fall back to the default pipeline rather than failing the decision.
+		stages = append(stages, StageTrace{Stage: "pipeline_resolve", Outcome: "degraded", ErrMessage: err.Error()})
+		stageNames = DefaultPipeline
+		resolved, _ = e.registry.Resolve(stageNames)
+	}
+	if _, ok := rules.set.FrequencyCap(req.Surface); ok && !hasTag(stageNames, "frequency_cap") {
+		stageNames, resolved = insertAfterRank(stageNames, resolved, pipeline.Named{Name: "frequency_cap", Stage: frequencyCapStage})
+	}
+	if req.Output != nil && !hasTag(stageNames, "output") {
+		stageNames = append(append([]string(nil), stageNames...), "output")
+		resolved = append(resolved, pipeline.Named{Name: "output", Stage: outputStage})
+	}
+
+	initial := withState(evalState{Request: req, RuleSet: rules.set, Inputs: in, policy: e.policy})
+	payload, traces, _ := pipeline.RunNamed(ctx, initial, resolved...)
+	st, _ := stateOf(payload)
+	for _, t := range traces {
+		trace := StageTrace{Stage: t.Stage, Outcome: t.Outcome, ErrMessage: t.Message}
+		if t.Stage == "policy_eval" {
+			trace.Evaluator = st.PolicyEvaluator
 		}
-		scored = append(scored, RankedItem{ItemID: c.ItemID, Score: score})
+		stages = append(stages, trace)
 	}
 
-	sort.Slice(scored, func(i, j int) bool {
-		if scored[i].Score == scored[j].Score {
-			return scored[i].ItemID < scored[j].ItemID
+	dependencyStatus := "ok"
+	for _, t := range stages {
+		if degradedOutcome(t.Outcome) {
+			dependencyStatus = "degraded"
+			break
 		}
-		return scored[i].Score > scored[j].Score
-	})
-	stages = append(stages, StageTrace{Stage: "rank", Outcome: "ok"})
+	}
 
-	h := hashDecision(req, e.PolicyVersion, e.DataVersion, gorseIDs, stages)
-	decisionID := "dec_" + h[:16]
-	traceID := "trc_" + h[16:28]
+	h := hashDecision(in.hashVersion(), canonicalDecision{
+		Request:        req,
+		PolicyVersion:  e.PolicyVersion,
+		DataVersion:    e.DataVersion,
+		RuleSetHash:    ruleSetHash,
+		Pipeline:       stageNames,
+		GorseCandidate: st.GorseIDs,
+		Stages:         stages,
+		Experiment:     in.Experiment,
+		Exposure:       in.Exposure.canonical(),
+	})
+	digest := canonical.Digest(h)
+	decisionID := "dec_" + digest[:16]
+	traceID := "trc_" + digest[16:28]
 
-	return DecisionResponse{
+	items := st.Items
+	if items == nil {
+		items = []RankedItem{}
+	}
+	resp := DecisionResponse{
 		DecisionID:       decisionID,
 		DecisionHash:     h,
 		PolicyVersion:    e.PolicyVersion,
 		DataVersion:      e.DataVersion,
+		RuleSetHash:      ruleSetHash,
 		GeneratedAt:      time.Now().UTC(),
 		TraceID:          traceID,
 		DependencyStatus: dependencyStatus,
-		Items:            scored,
+		Items:            items,
+		Removed:          st.Removed,
+		Page:             st.Page,
+		Experiment:       in.Experiment,
+		Exposure:         in.Exposure,
 		Stages:           stages,
 	}
+	return resp, st.Policy
 }
 
 type canonicalPair struct {
@@ -128,28 +324,93 @@ type canonicalDecision struct {
 	Request        DecisionRequest `json:"request"`
 	PolicyVersion  string          `json:"policy_version"`
 	DataVersion    string          `json:"data_version"`
+	RuleSetHash    string          `json:"rule_set_hash"`
+	Pipeline       []string        `json:"pipeline"`
 	GorseCandidate []string        `json:"gorse_candidate_ids"`
 	Stages         []StageTrace    `json:"stages"`
+	// Experiment is omitted when empty so decisions outside experiments keep
+	// the hashes they had before experiments existed.
+	Experiment *ExperimentAssignment `json:"experiment,omitempty"`
+	// Exposure is the ledger snapshot a frequency cap ranked against; omitted
+	// for surfaces without a cap.
+	Exposure *canonicalExposure `json:"exposure,omitempty"`
 }
 
-func hashDecision(req DecisionRequest, policyVersion, dataVersion string, gorseIDs []string, stages []StageTrace) string {
-	normalized := DecisionRequest{
+// CanonicalRequest returns the normalized form of req that participates in the
+// decision hash. It is what gets stored for recompute replays.
+func CanonicalRequest(req DecisionRequest) DecisionRequest {
+	return DecisionRequest{
 		TenantID:       req.TenantID,
 		UserID:         req.UserID,
 		Surface:        req.Surface,
 		Context:        normalizeContext(req.Context),
 		CandidateItems: normalizeCandidates(req.CandidateItems),
+		Catalog:        normalizeCatalog(req.Catalog),
+		Output:         normalizeOutput(req.Output),
 	}
-	payload := canonicalDecision{
-		Request:        normalized,
-		PolicyVersion:  policyVersion,
-		DataVersion:    dataVersion,
-		GorseCandidate: append([]string(nil), gorseIDs...),
-		Stages:         append([]StageTrace(nil), stages...),
+}
+
+func normalizeCatalog(c *CatalogSelector) *CatalogSelector {
+	if c == nil {
+		return nil
 	}
-	b, _ := json.Marshal(payload)
-	h := sha256.Sum256(b)
-	return hex.EncodeToString(h[:])
+	ids := normalizeTags(c.ItemIDs)
+	out := &CatalogSelector{Segment: c.Segment}
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			out.ItemIDs = append(out.ItemIDs, id)
+		}
+	}
+	return out
+}
+
+func normalizeOutput(o *OutputOptions) *OutputOptions {
+	if o == nil {
+		return nil
+	}
+	if o.Limit == 0 && o.Offset == 0 && len(o.MaxPerTag) == 0 && o.MaxPerTagWindow == 0 && o.InterleaveBy == "" {
+		return nil
+	}
+	cp := *o
+	if len(cp.MaxPerTag) == 0 {
+		cp.MaxPerTag = nil
+	}
+	return &cp
+}
+
+// hashDecision hashes the canonical decision payload with the given
+// canonical.Hash version. v1 hashes are bare hex over encoding/json output;
+// v2 hashes are "v2:"-prefixed and computed over the RFC 8785 form, so other
+// languages can reproduce them.
+func hashDecision(version string, d canonicalDecision) string {
+	d.Request = CanonicalRequest(d.Request)
+	d.Pipeline = append([]string(nil), d.Pipeline...)
+	d.GorseCandidate = append([]string(nil), d.GorseCandidate...)
+	d.Stages = hashableStages(d.Stages)
+	h, err := canonical.Hash(version, d)
+	if err != nil {
+		// Inputs naming a version this build does not know are hashed with
+		// the current version; the replay diff then reports the mismatch.
+		h, _ = canonical.Hash(canonical.Current, d)
+	}
+	return h
+}
+
+// hashableStages copies stages without the fields kept out of the hash.
+func hashableStages(stages []StageTrace) []StageTrace {
+	out := make([]StageTrace, len(stages))
+	for i, t := range stages {
+		t.Evaluator = ""
+		out[i] = t
+	}
+	return out
+}
+
+func (in DecisionInputs) hashVersion() string {
+	if in.HashVersion == "" {
+		return canonical.V1
+	}
+	return in.HashVersion
 }
 
 func normalizeContext(ctx map[string]string) map[string]string {
@@ -203,11 +464,43 @@ func hasTag(tags []string, value string) bool {
 	return false
 }
 
-func hasBlockedTag(tags []string, blocked map[string]struct{}) bool {
+func blockedTag(tags []string, blocked map[string]struct{}) (string, bool) {
 	for _, t := range tags {
 		if _, ok := blocked[t]; ok {
-			return true
+			return t, true
 		}
 	}
-	return false
+	return "", false
+}
+
+// removalReason reports why a candidate is filtered out before ranking, or ""
+// when it is kept.
+func removalReason(c CandidateItem, blockedTags, blockedItems map[string]struct{}) (string, string) {
+	if c.Blocked {
+		return "blocked", ""
+	}
+	if tag, ok := blockedTag(normalizeTags(c.Tags), blockedTags); ok {
+		return "blocked_tag", tag
+	}
+	if _, ok := blockedItems[c.ItemID]; ok {
+		return "policy", ""
+	}
+	return "", ""
+}
+
+// stringList accepts the []string or []any shapes a policy output may carry.
+func stringList(v any) []string {
+	switch xs := v.(type) {
+	case []string:
+		return xs
+	case []any:
+		out := make([]string, 0, len(xs))
+		for _, x := range xs {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
 }
@@ -3,6 +3,8 @@ package decision
 import (
 	"context"
 	"testing"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorse"
 )
 
 type stubGorse struct {
@@ -87,3 +89,39 @@ func TestPolicyBlockedTag(t *testing.T) {
 		t.Fatalf("expected blocked item filtered, got %#v", resp.Items)
 	}
 }
+
+type tracedGorse struct {
+	stubGorse
+	trace []gorse.Attempt
+}
+
+func (g tracedGorse) RecommendTraced(context.Context, string, int) ([]string, []gorse.Attempt, error) {
+	return g.ids, g.trace, nil
+}
+
+func TestFallbackRecordedAsOwnStage(t *testing.T) {
+	upstream := tracedGorse{
+		stubGorse: stubGorse{ids: []string{"b"}},
+		trace: []gorse.Attempt{
+			{Source: gorse.SourcePrimary, Outcome: "circuit_open"},
+			{Source: "popular", Outcome: "ok"},
+		},
+	}
+	engine := NewEngine("policy-v1", "data-v1", upstream, stubPolicy{})
+	resp := engine.Decide(context.Background(), replayRequestFixture())
+
+	if resp.DependencyStatus != "degraded" {
+		t.Fatalf("expected degraded status, got %s", resp.DependencyStatus)
+	}
+	want := []StageTrace{
+		{Stage: "gorse_recommend", Outcome: "circuit_open"},
+		{Stage: "gorse_fallback_popular", Outcome: "ok"},
+	}
+	if resp.Stages[1] != want[0] || resp.Stages[2] != want[1] {
+		t.Fatalf("stages = %+v", resp.Stages)
+	}
+	again := engine.Decide(context.Background(), replayRequestFixture())
+	if again.DecisionHash != resp.DecisionHash {
+		t.Fatalf("expected deterministic hash on fallback path")
+	}
+}
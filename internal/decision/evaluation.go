@@ -0,0 +1,228 @@
+package decision
+
+import (
+	"math"
+	"sort"
+)
+
+// FeedbackGain is the graded relevance of a feedback event in offline
+// evaluation. An item's relevance within a decision is the largest gain
+// among its events; impressions alone are not relevant.
+func FeedbackGain(eventType string) float64 {
+	switch eventType {
+	case "click":
+		return 1
+	case "conversion":
+		return 2
+	default:
+		return 0
+	}
+}
+
+// NDCGAtK scores the top k items against graded relevance using the
+// exponential gain 2^rel - 1. The ideal ranking orders every relevant item by
+// relevance, so relevant items the ranking dropped count against it. It is 0
+// when nothing is relevant.
+func NDCGAtK(items []RankedItem, relevance map[string]float64, k int) float64 {
+	var dcg float64
+	for i, item := range items {
+		if i >= k {
+			break
+		}
+		dcg += gain(relevance[item.ItemID]) / math.Log2(float64(i+2))
+	}
+	ideal := make([]float64, 0, len(relevance))
+	for _, rel := range relevance {
+		if rel > 0 {
+			ideal = append(ideal, rel)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(ideal)))
+	var idcg float64
+	for i, rel := range ideal {
+		if i >= k {
+			break
+		}
+		idcg += gain(rel) / math.Log2(float64(i+2))
+	}
+	if idcg == 0 {
+		return 0
+	}
+	return dcg / idcg
+}
+
+// HitAtK reports whether any of the top k items is relevant.
+func HitAtK(items []RankedItem, relevance map[string]float64, k int) bool {
+	for i, item := range items {
+		if i >= k {
+			break
+		}
+		if relevance[item.ItemID] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func gain(rel float64) float64 {
+	return math.Pow(2, rel) - 1
+}
+
+// RankingMetrics are means over the decisions that received relevant
+// feedback.
+type RankingMetrics struct {
+	NDCG    float64 `json:"ndcg_at_k"`
+	HitRate float64 `json:"hit_rate_at_k"`
+}
+
+// ExposureDelta is how often an item appeared in the top k under the baseline
+// and candidate rankings.
+type ExposureDelta struct {
+	ItemID    string `json:"item_id"`
+	Baseline  int    `json:"baseline"`
+	Candidate int    `json:"candidate"`
+	Delta     int    `json:"delta"`
+}
+
+// OfflineReport summarises an offline comparison of two rankings over the
+// same decisions. ExposureShift is the total variation distance between the
+// baseline and candidate top-k exposure distributions: 0 when every item is
+// shown equally often, 1 when they share no items.
+type OfflineReport struct {
+	K                     int             `json:"k"`
+	Decisions             int             `json:"decisions"`
+	DecisionsWithFeedback int             `json:"decisions_with_feedback"`
+	Baseline              RankingMetrics  `json:"baseline"`
+	Candidate             RankingMetrics  `json:"candidate"`
+	NDCGDelta             float64         `json:"ndcg_delta"`
+	HitRateDelta          float64         `json:"hit_rate_delta"`
+	ExposureShift         float64         `json:"exposure_shift"`
+	ExposureDeltas        []ExposureDelta `json:"exposure_deltas"`
+}
+
+// OfflineEvaluator accumulates baseline and candidate rankings of historical
+// decisions together with the feedback those decisions received. Feedback was
+// collected on what was served, so items the candidate surfaces that were
+// never shown count as not relevant.
+type OfflineEvaluator struct {
+	k                  int
+	decisions          int
+	withFeedback       int
+	baseline           RankingMetrics
+	candidate          RankingMetrics
+	baselineExposure   map[string]int
+	candidateExposure  map[string]int
+	baselineExposures  int
+	candidateExposures int
+}
+
+func NewOfflineEvaluator(k int) *OfflineEvaluator {
+	if k <= 0 {
+		k = 10
+	}
+	return &OfflineEvaluator{
+		k:                 k,
+		baselineExposure:  map[string]int{},
+		candidateExposure: map[string]int{},
+	}
+}
+
+// Add records one decision.
+func (e *OfflineEvaluator) Add(baseline, candidate []RankedItem, relevance map[string]float64) {
+	e.decisions++
+	e.baselineExposures += addExposure(e.baselineExposure, baseline, e.k)
+	e.candidateExposures += addExposure(e.candidateExposure, candidate, e.k)
+
+	relevant := false
+	for _, rel := range relevance {
+		if rel > 0 {
+			relevant = true
+			break
+		}
+	}
+	if !relevant {
+		return
+	}
+	e.withFeedback++
+	e.baseline.NDCG += NDCGAtK(baseline, relevance, e.k)
+	e.candidate.NDCG += NDCGAtK(candidate, relevance, e.k)
+	if HitAtK(baseline, relevance, e.k) {
+		e.baseline.HitRate++
+	}
+	if HitAtK(candidate, relevance, e.k) {
+		e.candidate.HitRate++
+	}
+}
+
+func addExposure(counts map[string]int, items []RankedItem, k int) int {
+	n := 0
+	for i, item := range items {
+		if i >= k {
+			break
+		}
+		counts[item.ItemID]++
+		n++
+	}
+	return n
+}
+
+// Report returns the accumulated metrics with the maxDeltas items whose
+// exposure changed most, largest change first.
+func (e *OfflineEvaluator) Report(maxDeltas int) OfflineReport {
+	report := OfflineReport{
+		K:                     e.k,
+		Decisions:             e.decisions,
+		DecisionsWithFeedback: e.withFeedback,
+		ExposureDeltas:        []ExposureDelta{},
+	}
+	if e.withFeedback > 0 {
+		n := float64(e.withFeedback)
+		report.Baseline = RankingMetrics{NDCG: e.baseline.NDCG / n, HitRate: e.baseline.HitRate / n}
+		report.Candidate = RankingMetrics{NDCG: e.candidate.NDCG / n, HitRate: e.candidate.HitRate / n}
+		report.NDCGDelta = report.Candidate.NDCG - report.Baseline.NDCG
+		report.HitRateDelta = report.Candidate.HitRate - report.Baseline.HitRate
+	}
+
+	items := map[string]struct{}{}
+	for id := range e.baselineExposure {
+		items[id] = struct{}{}
+	}
+	for id := range e.candidateExposure {
+		items[id] = struct{}{}
+	}
+	var shift float64
+	for id := range items {
+		b, c := e.baselineExposure[id], e.candidateExposure[id]
+		shift += math.Abs(share(c, e.candidateExposures) - share(b, e.baselineExposures))
+		if b != c {
+			report.ExposureDeltas = append(report.ExposureDeltas, ExposureDelta{ItemID: id, Baseline: b, Candidate: c, Delta: c - b})
+		}
+	}
+	report.ExposureShift = shift / 2
+
+	sort.Slice(report.ExposureDeltas, func(i, j int) bool {
+		a, b := report.ExposureDeltas[i], report.ExposureDeltas[j]
+		if abs(a.Delta) != abs(b.Delta) {
+			return abs(a.Delta) > abs(b.Delta)
+		}
+		return a.ItemID < b.ItemID
+	})
+	if maxDeltas >= 0 && len(report.ExposureDeltas) > maxDeltas {
+		report.ExposureDeltas = report.ExposureDeltas[:maxDeltas]
+	}
+	return report
+}
+
+func share(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
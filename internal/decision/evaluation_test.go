@@ -0,0 +1,79 @@
+package decision
+
+import (
+	"math"
+	"testing"
+)
+
+func ranked(ids ...string) []RankedItem {
+	out := make([]RankedItem, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, RankedItem{ItemID: id})
+	}
+	return out
+}
+
+func TestNDCGAtK(t *testing.T) {
+	rel := map[string]float64{"a": 2, "b": 1}
+	if got := NDCGAtK(ranked("a", "b", "c"), rel, 3); math.Abs(got-1) > 1e-12 {
+		t.Fatalf("ideal ranking should score 1, got %v", got)
+	}
+	// DCG = 1/log2(2) + 3/log2(3); IDCG = 3 + 1/log2(3).
+	want := (1 + 3/math.Log2(3)) / (3 + 1/math.Log2(3))
+	if got := NDCGAtK(ranked("b", "a"), rel, 3); math.Abs(got-want) > 1e-12 {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// A relevant item cut below k still counts in the ideal ranking.
+	if got := NDCGAtK(ranked("c", "a"), rel, 1); got != 0 {
+		t.Fatalf("expected 0 with no relevant item in top 1, got %v", got)
+	}
+	if got := NDCGAtK(ranked("a"), map[string]float64{"a": 0}, 3); got != 0 {
+		t.Fatalf("expected 0 without relevant feedback, got %v", got)
+	}
+}
+
+func TestHitAtK(t *testing.T) {
+	rel := map[string]float64{"c": FeedbackGain("click"), "d": FeedbackGain("impression")}
+	if HitAtK(ranked("a", "b", "c"), rel, 2) {
+		t.Fatalf("c is outside the top 2")
+	}
+	if !HitAtK(ranked("a", "b", "c"), rel, 3) {
+		t.Fatalf("expected a hit on c")
+	}
+	if HitAtK(ranked("d"), rel, 3) {
+		t.Fatalf("impressions are not relevant")
+	}
+}
+
+func TestOfflineEvaluatorReport(t *testing.T) {
+	e := NewOfflineEvaluator(2)
+	e.Add(ranked("a", "b", "c"), ranked("c", "a", "b"), map[string]float64{"c": 1})
+	e.Add(ranked("a", "b"), ranked("a", "b"), nil)
+	r := e.Report(10)
+
+	if r.Decisions != 2 || r.DecisionsWithFeedback != 1 {
+		t.Fatalf("unexpected counts %+v", r)
+	}
+	if r.Baseline.HitRate != 0 || r.Candidate.HitRate != 1 || r.HitRateDelta != 1 {
+		t.Fatalf("unexpected hit rates %+v", r)
+	}
+	if r.Baseline.NDCG != 0 || r.Candidate.NDCG != 1 {
+		t.Fatalf("unexpected ndcg %+v", r)
+	}
+	// Baseline top-2 exposure a:2 b:2, candidate a:2 b:1 c:1.
+	if math.Abs(r.ExposureShift-0.25) > 1e-12 {
+		t.Fatalf("unexpected exposure shift %v", r.ExposureShift)
+	}
+	want := []ExposureDelta{{ItemID: "b", Baseline: 2, Candidate: 1, Delta: -1}, {ItemID: "c", Baseline: 0, Candidate: 1, Delta: 1}}
+	if len(r.ExposureDeltas) != len(want) {
+		t.Fatalf("unexpected deltas %+v", r.ExposureDeltas)
+	}
+	for i := range want {
+		if r.ExposureDeltas[i] != want[i] {
+			t.Fatalf("delta %d: got %+v, want %+v", i, r.ExposureDeltas[i], want[i])
+		}
+	}
+	if got := e.Report(1).ExposureDeltas; len(got) != 1 {
+		t.Fatalf("expected deltas truncated to 1, got %d", len(got))
+	}
+}
@@ -0,0 +1,139 @@
+package decision
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Experiment splits a surface's traffic between variants, each scored under
+// its own policy_version. A variant with an empty PolicyVersion is the
+// control and uses the engine's policy version.
+type Experiment struct {
+	ExperimentID string    `json:"experiment_id"`
+	Surface      string    `json:"surface"`
+	Variants     []Variant `json:"variants"`
+}
+
+// Variant is one arm of an experiment. Weight is its share of traffic
+// relative to the other variants.
+type Variant struct {
+	Name          string `json:"name"`
+	PolicyVersion string `json:"policy_version,omitempty"`
+	Weight        int    `json:"weight"`
+}
+
+// ExperimentAssignment records which variant a decision was made under.
+type ExperimentAssignment struct {
+	ExperimentID string `json:"experiment_id"`
+	Variant      string `json:"variant"`
+}
+
+// ExperimentPersistence looks up the experiment running on a surface.
+// ActiveExperiment returns the JSON-encoded Experiment.
+type ExperimentPersistence interface {
+	ActiveExperiment(ctx context.Context, tenantID, surface string) ([]byte, bool, error)
+}
+
+// WithExperiments assigns users to the variants of the active experiment on
+// the request surface.
+func WithExperiments(p ExperimentPersistence) Option {
+	return func(e *Engine) {
+		e.experiments = p
+	}
+}
+
+// WithoutExperiments returns an engine that ignores running experiments, for
+// what-if runs pinned to an explicit policy version.
+func (e *Engine) WithoutExperiments() *Engine {
+	cp := *e
+	cp.experiments = nil
+	return &cp
+}
+
+func ParseExperiment(raw []byte) (Experiment, error) {
+	var x Experiment
+	if err := json.Unmarshal(raw, &x); err != nil {
+		return Experiment{}, err
+	}
+	if err := x.Validate(); err != nil {
+		return Experiment{}, err
+	}
+	return x, nil
+}
+
+func (x Experiment) Validate() error {
+	if strings.TrimSpace(x.ExperimentID) == "" {
+		return fmt.Errorf("experiment_id required")
+	}
+	if strings.TrimSpace(x.Surface) == "" {
+		return fmt.Errorf("surface required")
+	}
+	if len(x.Variants) < 2 {
+		return fmt.Errorf("at least two variants required")
+	}
+	seen := map[string]struct{}{}
+	for i, v := range x.Variants {
+		if strings.TrimSpace(v.Name) == "" {
+			return fmt.Errorf("variants[%d].name required", i)
+		}
+		if _, dup := seen[v.Name]; dup {
+			return fmt.Errorf("duplicate variant %q", v.Name)
+		}
+		seen[v.Name] = struct{}{}
+		if v.Weight <= 0 {
+			return fmt.Errorf("variants[%d].weight must be > 0", i)
+		}
+	}
+	return nil
+}
+
+// Assign picks the variant for userID. The bucket is a hash of the
+// experiment ID and user ID, so a user keeps their variant for the life of
+// the experiment and across replays. Variants are walked in declaration
+// order, so reordering them reshuffles users.
+func (x Experiment) Assign(userID string) Variant {
+	total := 0
+	for _, v := range x.Variants {
+		total += v.Weight
+	}
+	sum := sha256.Sum256([]byte(x.ExperimentID + "|" + userID))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, v := range x.Variants {
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return x.Variants[len(x.Variants)-1]
+}
+
+// assignExperiment resolves the active experiment for the request and
+// returns the engine pinned to the assigned variant's policy version.
+// Anonymous requests are never enrolled: without a user_id there is nothing
+// stable to bucket on.
+func (e *Engine) assignExperiment(ctx context.Context, req DecisionRequest) (*Engine, *ExperimentAssignment, *StageTrace) {
+	if e.experiments == nil || req.UserID == "" {
+		return e, nil, nil
+	}
+	raw, found, err := e.experiments.ActiveExperiment(ctx, req.TenantID, req.Surface)
+	if err != nil {
+		return e, nil, &StageTrace{Stage: "experiment_assign", Outcome: "degraded", ErrMessage: err.Error()}
+	}
+	if !found {
+		return e, nil, nil
+	}
+	x, err := ParseExperiment(raw)
+	if err != nil {
+		return e, nil, &StageTrace{Stage: "experiment_assign", Outcome: "degraded", ErrMessage: err.Error()}
+	}
+	v := x.Assign(req.UserID)
+	eng := e
+	if v.PolicyVersion != "" {
+		eng = e.WithVersions(v.PolicyVersion, e.DataVersion)
+	}
+	return eng, &ExperimentAssignment{ExperimentID: x.ExperimentID, Variant: v.Name}, &StageTrace{Stage: "experiment_assign", Outcome: "ok"}
+}
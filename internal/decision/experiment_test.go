@@ -0,0 +1,119 @@
+package decision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+type memExperiments map[string]Experiment
+
+func (m memExperiments) ActiveExperiment(_ context.Context, tenantID, surface string) ([]byte, bool, error) {
+	x, ok := m[tenantID+"|"+surface]
+	if !ok {
+		return nil, false, nil
+	}
+	raw, err := json.Marshal(x)
+	return raw, true, err
+}
+
+func abExperiment() Experiment {
+	return Experiment{
+		ExperimentID: "exp_home",
+		Surface:      "home",
+		Variants: []Variant{
+			{Name: "control", Weight: 1},
+			{Name: "treatment", PolicyVersion: "policy-v2", Weight: 1},
+		},
+	}
+}
+
+func TestExperimentAssignmentIsStableAndSplitsTraffic(t *testing.T) {
+	x := abExperiment()
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		v := x.Assign(user)
+		if again := x.Assign(user); again.Name != v.Name {
+			t.Fatalf("assignment for %s changed: %s then %s", user, v.Name, again.Name)
+		}
+		counts[v.Name]++
+	}
+	if counts["control"] < 900 || counts["treatment"] < 900 {
+		t.Fatalf("expected roughly even split, got %v", counts)
+	}
+
+	other := abExperiment()
+	other.ExperimentID = "exp_other"
+	moved := 0
+	for i := 0; i < 200; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		if x.Assign(user).Name != other.Assign(user).Name {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Fatalf("expected buckets to depend on the experiment id")
+	}
+}
+
+func TestExperimentVariantPinsPolicyAndSurvivesReplay(t *testing.T) {
+	rules := memRules{
+		"t|policy-v2": []byte(`{"policy_version":"policy-v2","rules":[{"id":"promo","tags_any":["promo"],"boost":100}]}`),
+	}
+	x := abExperiment()
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}, WithRuleSets(rules), WithExperiments(memExperiments{"t|home": x}))
+
+	req := replayRequestFixture()
+	for i := 0; x.Assign(req.UserID).Name != "treatment"; i++ {
+		req.UserID = fmt.Sprintf("u%d", i)
+	}
+	resp, inputs := engine.DecideRecorded(context.Background(), req)
+	if resp.Experiment == nil || resp.Experiment.ExperimentID != "exp_home" || resp.Experiment.Variant != "treatment" {
+		t.Fatalf("expected treatment assignment, got %#v", resp.Experiment)
+	}
+	if resp.PolicyVersion != "policy-v2" || resp.Items[0].ItemID != "c" {
+		t.Fatalf("expected treatment policy to rank promo first, got %s %#v", resp.PolicyVersion, resp.Items)
+	}
+	if resp.Stages[0].Stage != "experiment_assign" || resp.Stages[0].Outcome != "ok" {
+		t.Fatalf("expected experiment_assign stage first, got %#v", resp.Stages)
+	}
+
+	// Replays run on an engine pinned to the stored versions, after the
+	// experiment may have stopped.
+	stopped := NewEngine("policy-v1", "data-v1", nil, stubPolicy{}, WithRuleSets(rules))
+	replayed := stopped.WithVersions(resp.PolicyVersion, resp.DataVersion).Recompute(context.Background(), CanonicalRequest(req), inputs)
+	if replayed.DecisionHash != resp.DecisionHash || replayed.Experiment.Variant != "treatment" {
+		t.Fatalf("replay diverged: %s vs %s (%#v)", replayed.DecisionHash, resp.DecisionHash, replayed.Experiment)
+	}
+}
+
+func TestExperimentSkipsAnonymousAndOtherSurfaces(t *testing.T) {
+	plain := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{})
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}, WithExperiments(memExperiments{"t|home": abExperiment()}))
+
+	req := replayRequestFixture()
+	req.Surface = "search"
+	if resp := engine.Decide(context.Background(), req); resp.Experiment != nil || resp.DecisionHash != plain.Decide(context.Background(), req).DecisionHash {
+		t.Fatalf("expected no assignment off the experiment surface, got %#v", resp.Experiment)
+	}
+	req = replayRequestFixture()
+	req.UserID = ""
+	if resp := engine.Decide(context.Background(), req); resp.Experiment != nil {
+		t.Fatalf("expected anonymous request to stay out of the experiment, got %#v", resp.Experiment)
+	}
+}
+
+func TestExperimentValidate(t *testing.T) {
+	x := abExperiment()
+	x.Variants[1].Name = "control"
+	if err := x.Validate(); err == nil {
+		t.Fatalf("expected duplicate variant name to be rejected")
+	}
+	x = abExperiment()
+	x.Variants[0].Weight = 0
+	if err := x.Validate(); err == nil {
+		t.Fatalf("expected zero weight to be rejected")
+	}
+}
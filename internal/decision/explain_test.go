@@ -0,0 +1,95 @@
+package decision
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func explainRequestFixture() DecisionRequest {
+	return DecisionRequest{
+		TenantID: "t",
+		UserID:   "u",
+		Surface:  "home",
+		Context:  map[string]string{"plan": "enterprise"},
+		CandidateItems: []CandidateItem{
+			{ItemID: "a", BaseScore: 1, Tags: []string{"enterprise"}},
+			{ItemID: "b", BaseScore: 2},
+			{ItemID: "c", BaseScore: 3, Blocked: true},
+			{ItemID: "d", BaseScore: 4, Tags: []string{"promo"}},
+		},
+	}
+}
+
+func TestExplainBreaksDownScores(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{ids: []string{"b", "a"}}, stubPolicy{blocked: []string{"promo"}})
+	req := explainRequestFixture()
+	req.Explain = true
+	resp := engine.Decide(context.Background(), req)
+
+	if len(resp.Items) != 2 {
+		t.Fatalf("expected 2 ranked items, got %d", len(resp.Items))
+	}
+	for _, item := range resp.Items {
+		ex := item.Explanation
+		if ex == nil {
+			t.Fatalf("expected explanation for %s", item.ItemID)
+		}
+		total := ex.BaseScore
+		for _, c := range ex.Contributions {
+			total += c.Delta
+		}
+		if math.Abs(total-item.Score) > 1e-9 {
+			t.Fatalf("%s contributions sum to %v, score %v", item.ItemID, total, item.Score)
+		}
+		if ex.GorseRank == nil {
+			t.Fatalf("expected gorse rank for %s", item.ItemID)
+		}
+	}
+	top := resp.Items[0]
+	if top.ItemID != "a" || top.Explanation.Contributions[0].RuleID != "enterprise_plan_bonus" || top.Explanation.Contributions[0].Delta != 10 {
+		t.Fatalf("unexpected top explanation: %+v", top)
+	}
+
+	want := []RemovedItem{
+		{ItemID: "c", Reason: "blocked"},
+		{ItemID: "d", Reason: "blocked_tag", Tag: "promo"},
+	}
+	if !reflect.DeepEqual(resp.Removed, want) {
+		t.Fatalf("removed = %+v, want %+v", resp.Removed, want)
+	}
+}
+
+func TestExplainExcludedFromHash(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{ids: []string{"b", "a"}}, stubPolicy{blocked: []string{"promo"}})
+	plain := engine.Decide(context.Background(), explainRequestFixture())
+	req := explainRequestFixture()
+	req.Explain = true
+	explained := engine.Decide(context.Background(), req)
+
+	if plain.DecisionHash != explained.DecisionHash {
+		t.Fatalf("explain changed decision hash")
+	}
+	if plain.Removed != nil || plain.Items[0].Explanation != nil {
+		t.Fatalf("expected no explanation without explain mode")
+	}
+}
+
+func TestExplainStableAcrossCandidateOrder(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{blocked: []string{"promo"}})
+	req := explainRequestFixture()
+	req.Explain = true
+	first := engine.Decide(context.Background(), req)
+
+	reversed := explainRequestFixture()
+	reversed.Explain = true
+	for i, j := 0, len(reversed.CandidateItems)-1; i < j; i, j = i+1, j-1 {
+		reversed.CandidateItems[i], reversed.CandidateItems[j] = reversed.CandidateItems[j], reversed.CandidateItems[i]
+	}
+	second := engine.Decide(context.Background(), reversed)
+
+	if !reflect.DeepEqual(first.Items, second.Items) || !reflect.DeepEqual(first.Removed, second.Removed) {
+		t.Fatalf("explanations differ across candidate order")
+	}
+}
@@ -0,0 +1,164 @@
+package decision
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/pipeline"
+)
+
+// FrequencyCap limits how often a user is shown the same item on a surface.
+// Items the user was exposed to MaxExposures times or more within the window
+// are demoted to the end of the list (keeping their relative order) or, with
+// Action "drop", removed. With ImpressionsOnly only exposures confirmed by an
+// impression count; otherwise every decision that served the item does.
+type FrequencyCap struct {
+	MaxExposures    int    `json:"max_exposures"`
+	WindowSeconds   int    `json:"window_seconds"`
+	Action          string `json:"action,omitempty"`
+	ImpressionsOnly bool   `json:"impressions_only,omitempty"`
+}
+
+func (c FrequencyCap) Validate() error {
+	if c.MaxExposures < 1 {
+		return fmt.Errorf("max_exposures must be >= 1")
+	}
+	if c.WindowSeconds < 1 {
+		return fmt.Errorf("window_seconds must be >= 1")
+	}
+	switch c.Action {
+	case "", "demote", "drop":
+	default:
+		return fmt.Errorf("unsupported action %q", c.Action)
+	}
+	return nil
+}
+
+// ExposureSnapshot is the exposure ledger state a frequency-capped decision
+// was made against: per-item counts for the request candidates, sorted by
+// item_id. It is recorded in the decision inputs so Recompute reproduces the
+// capped ranking, and the counts and window are part of the decision hash.
+type ExposureSnapshot struct {
+	WindowSeconds   int             `json:"window_seconds"`
+	ImpressionsOnly bool            `json:"impressions_only,omitempty"`
+	Counts          []ExposureCount `json:"counts"`
+	AsOf            time.Time       `json:"as_of"`
+}
+
+type ExposureCount struct {
+	ItemID string `json:"item_id"`
+	Count  int    `json:"count"`
+}
+
+// canonicalExposure is the hashed part of an ExposureSnapshot. AsOf is left
+// out so identical ledger state yields identical hashes.
+type canonicalExposure struct {
+	WindowSeconds   int             `json:"window_seconds"`
+	ImpressionsOnly bool            `json:"impressions_only,omitempty"`
+	Counts          []ExposureCount `json:"counts"`
+}
+
+func (s *ExposureSnapshot) canonical() *canonicalExposure {
+	if s == nil {
+		return nil
+	}
+	return &canonicalExposure{
+		WindowSeconds:   s.WindowSeconds,
+		ImpressionsOnly: s.ImpressionsOnly,
+		Counts:          append([]ExposureCount{}, s.Counts...),
+	}
+}
+
+// ExposurePersistence reads the per-user exposure ledger. CountExposures
+// returns counts for the given items since the given time; unexposed items
+// may be omitted.
+type ExposurePersistence interface {
+	CountExposures(ctx context.Context, tenantID, userID string, itemIDs []string, since time.Time, impressionsOnly bool) (map[string]int, error)
+}
+
+// WithExposures lets rule sets with frequency caps read the exposure ledger.
+func WithExposures(p ExposurePersistence) Option {
+	return func(e *Engine) {
+		e.exposures = p
+	}
+}
+
+// captureExposure snapshots the ledger for the request candidates. It returns
+// nil when there is nothing to cap against: no ledger or an anonymous
+// request.
+func (e *Engine) captureExposure(ctx context.Context, req DecisionRequest, c FrequencyCap) (*ExposureSnapshot, string) {
+	if e.exposures == nil || req.UserID == "" {
+		return nil, ""
+	}
+	ids := make([]string, 0, len(req.CandidateItems))
+	for _, item := range req.CandidateItems {
+		ids = append(ids, item.ItemID)
+	}
+	sort.Strings(ids)
+	asOf := time.Now().UTC()
+	counts, err := e.exposures.CountExposures(ctx, req.TenantID, req.UserID, ids, asOf.Add(-time.Duration(c.WindowSeconds)*time.Second), c.ImpressionsOnly)
+	if err != nil {
+		return nil, err.Error()
+	}
+	snap := &ExposureSnapshot{WindowSeconds: c.WindowSeconds, ImpressionsOnly: c.ImpressionsOnly, Counts: []ExposureCount{}, AsOf: asOf}
+	for _, id := range ids {
+		if n := counts[id]; n > 0 {
+			snap.Counts = append(snap.Counts, ExposureCount{ItemID: id, Count: n})
+		}
+	}
+	return snap, ""
+}
+
+// frequencyCapStage applies the surface's FrequencyCap using the recorded
+// exposure snapshot. The engine inserts it after rank whenever the rule set
+// caps the request surface.
+func frequencyCapStage(_ context.Context, payload map[string]any) (map[string]any, error) {
+	st, err := stateOf(payload)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := st.RuleSet.FrequencyCap(st.Request.Surface)
+	if !ok {
+		return withState(st), pipeline.Outcome("skipped", "")
+	}
+	if st.Inputs.ExposureError != "" {
+		return withState(st), pipeline.Outcome("degraded", st.Inputs.ExposureError)
+	}
+	snap := st.Inputs.Exposure
+	if snap == nil {
+		return withState(st), pipeline.Outcome("skipped", "")
+	}
+	seen := make(map[string]int, len(snap.Counts))
+	for _, ec := range snap.Counts {
+		seen[ec.ItemID] = ec.Count
+	}
+
+	kept := make([]RankedItem, 0, len(st.Items))
+	var capped []RankedItem
+	for _, item := range st.Items {
+		if seen[item.ItemID] >= c.MaxExposures {
+			capped = append(capped, item)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	if c.Action == "drop" {
+		if st.Request.Explain {
+			for _, item := range capped {
+				st.Removed = append(st.Removed, RemovedItem{ItemID: item.ItemID, Reason: "frequency_cap"})
+			}
+			sort.Slice(st.Removed, func(i, j int) bool {
+				if st.Removed[i].ItemID == st.Removed[j].ItemID {
+					return st.Removed[i].Reason < st.Removed[j].Reason
+				}
+				return st.Removed[i].ItemID < st.Removed[j].ItemID
+			})
+		}
+		st.Items = kept
+		return withState(st), nil
+	}
+	st.Items = append(kept, capped...)
+	return withState(st), nil
+}
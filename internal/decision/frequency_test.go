@@ -0,0 +1,107 @@
+package decision
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type memExposures map[string]int
+
+func (m memExposures) CountExposures(_ context.Context, _, _ string, itemIDs []string, _ time.Time, _ bool) (map[string]int, error) {
+	out := map[string]int{}
+	for _, id := range itemIDs {
+		if n, ok := m[id]; ok {
+			out[id] = n
+		}
+	}
+	return out, nil
+}
+
+func cappedRuleSet(action string) RuleSet {
+	rs := DefaultRuleSet("policy-v1")
+	rs.FrequencyCaps = map[string]FrequencyCap{"home": {MaxExposures: 2, WindowSeconds: 3600, Action: action}}
+	return rs
+}
+
+func stageOutcome(resp DecisionResponse, stage string) string {
+	for _, s := range resp.Stages {
+		if s.Stage == stage {
+			return s.Outcome
+		}
+	}
+	return ""
+}
+
+func TestFrequencyCapDemotesOverexposedItems(t *testing.T) {
+	ledger := memExposures{"b": 2, "c": 1}
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}, WithExposures(ledger)).WithRuleSet(cappedRuleSet(""))
+	resp, in := engine.DecideRecorded(context.Background(), replayRequestFixture())
+
+	if got := itemIDs(resp.Items); len(got) != 3 || got[2] != "b" {
+		t.Fatalf("expected b demoted to last, got %v", got)
+	}
+	if stageOutcome(resp, "frequency_cap") != "ok" {
+		t.Fatalf("expected frequency_cap stage, got %+v", resp.Stages)
+	}
+	if resp.Exposure == nil || len(resp.Exposure.Counts) != 2 || resp.Exposure.Counts[0].ItemID != "b" {
+		t.Fatalf("expected exposure snapshot in decision, got %+v", resp.Exposure)
+	}
+
+	// The ledger moves on, but recompute uses the recorded snapshot.
+	ledger["a"] = 5
+	if again := engine.Recompute(context.Background(), CanonicalRequest(replayRequestFixture()), in); again.DecisionHash != resp.DecisionHash {
+		t.Fatalf("recompute hash %s, want %s", again.DecisionHash, resp.DecisionHash)
+	}
+	changed, _ := engine.DecideRecorded(context.Background(), replayRequestFixture())
+	if changed.DecisionHash == resp.DecisionHash {
+		t.Fatalf("expected a different exposure snapshot to change the hash")
+	}
+}
+
+func TestFrequencyCapDropRecordsRemoval(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}, WithExposures(memExposures{"a": 4})).WithRuleSet(cappedRuleSet("drop"))
+	req := replayRequestFixture()
+	req.Explain = true
+	resp := engine.Decide(context.Background(), req)
+	for _, item := range resp.Items {
+		if item.ItemID == "a" {
+			t.Fatalf("expected a dropped, got %v", itemIDs(resp.Items))
+		}
+	}
+	if len(resp.Removed) != 1 || resp.Removed[0] != (RemovedItem{ItemID: "a", Reason: "frequency_cap"}) {
+		t.Fatalf("unexpected removed %+v", resp.Removed)
+	}
+}
+
+func TestFrequencyCapSkipsAnonymousAndUncappedSurfaces(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}, WithExposures(memExposures{"b": 9})).WithRuleSet(cappedRuleSet(""))
+	req := replayRequestFixture()
+	req.UserID = ""
+	resp := engine.Decide(context.Background(), req)
+	if stageOutcome(resp, "frequency_cap") != "skipped" || resp.Exposure != nil {
+		t.Fatalf("expected skipped cap without a user, got %+v", resp.Stages)
+	}
+
+	req = replayRequestFixture()
+	req.Surface = "search"
+	resp = engine.Decide(context.Background(), req)
+	if stageOutcome(resp, "frequency_cap") != "" {
+		t.Fatalf("expected no cap stage on an uncapped surface, got %+v", resp.Stages)
+	}
+}
+
+func TestFrequencyCapValidation(t *testing.T) {
+	rs := cappedRuleSet("hide")
+	if err := rs.Validate(); err == nil {
+		t.Fatalf("expected unsupported action to be rejected")
+	}
+	rs = cappedRuleSet("drop")
+	rs.FrequencyCaps["home"] = FrequencyCap{MaxExposures: 0, WindowSeconds: 60}
+	if err := rs.Validate(); err == nil {
+		t.Fatalf("expected max_exposures to be required")
+	}
+	if DefaultRuleSet("p").Hash() == cappedRuleSet("").Hash() {
+		t.Fatalf("expected frequency caps to change the rule set hash")
+	}
+}
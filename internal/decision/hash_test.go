@@ -0,0 +1,71 @@
+package decision
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/restarone/violet-deterministic-api/internal/canonical"
+)
+
+// decision_hash_vectors.json lets clients check they rebuild decision_hash
+// from the canonical decision payload.
+type decisionVector struct {
+	Name         string          `json:"name"`
+	Preimage     json.RawMessage `json:"preimage"`
+	Canonical    string          `json:"canonical"`
+	DecisionHash string          `json:"decision_hash"`
+}
+
+func TestDecisionHashGoldenVectors(t *testing.T) {
+	raw, err := os.ReadFile("testdata/decision_hash_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []decisionVector
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vectors {
+		var d canonicalDecision
+		if err := json.Unmarshal(v.Preimage, &d); err != nil {
+			t.Fatalf("%s: %v", v.Name, err)
+		}
+		if got := hashDecision(canonical.V2, d); got != v.DecisionHash {
+			t.Fatalf("%s: got %s, want %s", v.Name, got, v.DecisionHash)
+		}
+		got, err := canonical.Marshal(d)
+		if err != nil || string(got) != v.Canonical {
+			t.Fatalf("%s: canonical form\n got: %s\nwant: %s", v.Name, got, v.Canonical)
+		}
+	}
+}
+
+func TestNewDecisionsUseCurrentHashVersion(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{ids: []string{"c"}}, stubPolicy{})
+	resp, in := engine.DecideRecorded(context.Background(), replayRequestFixture())
+	if canonical.HashVersion(resp.DecisionHash) != canonical.Current || in.HashVersion != canonical.Current {
+		t.Fatalf("expected %s hash, got %s (inputs %q)", canonical.Current, resp.DecisionHash, in.HashVersion)
+	}
+	if resp.DecisionID != "dec_"+canonical.Digest(resp.DecisionHash)[:16] {
+		t.Fatalf("decision id not derived from digest: %s", resp.DecisionID)
+	}
+}
+
+func TestRecomputeKeepsLegacyHashVersion(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{ids: []string{"c"}}, stubPolicy{})
+	req := CanonicalRequest(replayRequestFixture())
+	_, in := engine.DecideRecorded(context.Background(), req)
+
+	// Inputs stored before hash versions existed carry no hash_version.
+	in.HashVersion = ""
+	legacy := engine.Recompute(context.Background(), req, in)
+	if strings.Contains(legacy.DecisionHash, ":") || len(legacy.DecisionHash) != 64 {
+		t.Fatalf("expected bare v1 hash, got %s", legacy.DecisionHash)
+	}
+	if again := engine.Recompute(context.Background(), req, in); again.DecisionHash != legacy.DecisionHash {
+		t.Fatalf("legacy recompute not stable")
+	}
+}
@@ -0,0 +1,164 @@
+package decision
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OutputOptions shape the ranked list after scoring. They are part of the
+// canonical request, so they change the decision hash.
+//
+// Application order: category interleaving, then per-tag caps, then
+// offset/limit.
+type OutputOptions struct {
+	Limit  int `json:"limit,omitempty"`
+	Offset int `json:"offset,omitempty"`
+	// MaxPerTag caps how many items carrying a tag may appear within the first
+	// MaxPerTagWindow positions (the whole list when 0). Items over the cap are
+	// moved down to just after the window, keeping their relative order.
+	MaxPerTag       map[string]int `json:"max_per_tag,omitempty"`
+	MaxPerTagWindow int            `json:"max_per_tag_window,omitempty"`
+	// InterleaveBy is a tag prefix such as "category:". Items are grouped by
+	// their first tag with that prefix and emitted round-robin, groups ordered
+	// by their best-ranked item.
+	InterleaveBy string `json:"interleave_by,omitempty"`
+}
+
+// PageInfo describes the slice of the shaped list returned in Items.
+type PageInfo struct {
+	Total      int  `json:"total"`
+	Offset     int  `json:"offset"`
+	Limit      int  `json:"limit,omitempty"`
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+func (o OutputOptions) Validate() error {
+	if o.Limit < 0 {
+		return fmt.Errorf("output.limit must be >= 0")
+	}
+	if o.Offset < 0 {
+		return fmt.Errorf("output.offset must be >= 0")
+	}
+	if o.MaxPerTagWindow < 0 {
+		return fmt.Errorf("output.max_per_tag_window must be >= 0")
+	}
+	for tag, n := range o.MaxPerTag {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("output.max_per_tag keys must be non-empty")
+		}
+		if n < 0 {
+			return fmt.Errorf("output.max_per_tag[%s] must be >= 0", tag)
+		}
+	}
+	return nil
+}
+
+// outputStage applies the request OutputOptions to the ranked items. The
+// engine appends it to the pipeline whenever a request sets options.
+func outputStage(_ context.Context, payload map[string]any) (map[string]any, error) {
+	st, err := stateOf(payload)
+	if err != nil {
+		return nil, err
+	}
+	opts := st.Request.Output
+	if opts == nil {
+		return withState(st), nil
+	}
+	tags := make(map[string][]string, len(st.Request.CandidateItems))
+	for _, c := range st.Request.CandidateItems {
+		tags[c.ItemID] = normalizeTags(c.Tags)
+	}
+
+	items := append([]RankedItem(nil), st.Items...)
+	if opts.InterleaveBy != "" {
+		items = interleaveByTagPrefix(items, tags, opts.InterleaveBy)
+	}
+	if len(opts.MaxPerTag) > 0 {
+		items = capPerTag(items, tags, opts.MaxPerTag, opts.MaxPerTagWindow)
+	}
+
+	page := &PageInfo{Total: len(items), Offset: opts.Offset, Limit: opts.Limit}
+	start := opts.Offset
+	if start > len(items) {
+		start = len(items)
+	}
+	end := len(items)
+	if opts.Limit > 0 && start+opts.Limit < end {
+		end = start + opts.Limit
+		next := end
+		page.NextOffset = &next
+	}
+	st.Items = items[start:end]
+	st.Page = page
+	return withState(st), nil
+}
+
+func interleaveByTagPrefix(items []RankedItem, tags map[string][]string, prefix string) []RankedItem {
+	groups := map[string][]RankedItem{}
+	var order []string
+	for _, item := range items {
+		key := ""
+		for _, t := range tags[item.ItemID] {
+			if strings.HasPrefix(t, prefix) {
+				key = t
+				break
+			}
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], item)
+	}
+	out := make([]RankedItem, 0, len(items))
+	for round := 0; len(out) < len(items); round++ {
+		for _, key := range order {
+			if round < len(groups[key]) {
+				out = append(out, groups[key][round])
+			}
+		}
+	}
+	return out
+}
+
+func capPerTag(items []RankedItem, tags map[string][]string, caps map[string]int, window int) []RankedItem {
+	if window <= 0 || window > len(items) {
+		window = len(items)
+	}
+	capped := make([]string, 0, len(caps))
+	for tag := range caps {
+		capped = append(capped, tag)
+	}
+	sort.Strings(capped)
+
+	counts := map[string]int{}
+	out := make([]RankedItem, 0, len(items))
+	var deferred []RankedItem
+	for _, item := range items {
+		if len(out) >= window {
+			out = append(out, deferred...)
+			deferred = nil
+			out = append(out, item)
+			continue
+		}
+		over := false
+		for _, tag := range capped {
+			if hasTag(tags[item.ItemID], tag) && counts[tag] >= caps[tag] {
+				over = true
+				break
+			}
+		}
+		if over {
+			deferred = append(deferred, item)
+			continue
+		}
+		for _, tag := range capped {
+			if hasTag(tags[item.ItemID], tag) {
+				counts[tag]++
+			}
+		}
+		out = append(out, item)
+	}
+	return append(out, deferred...)
+}
@@ -0,0 +1,97 @@
+package decision
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func outputRequestFixture(opts *OutputOptions) DecisionRequest {
+	return DecisionRequest{
+		TenantID: "t",
+		UserID:   "u",
+		Surface:  "home",
+		CandidateItems: []CandidateItem{
+			{ItemID: "a", BaseScore: 10, Tags: []string{"category:shoes", "promo"}},
+			{ItemID: "b", BaseScore: 9, Tags: []string{"category:shoes", "promo"}},
+			{ItemID: "c", BaseScore: 8, Tags: []string{"category:shoes", "promo"}},
+			{ItemID: "d", BaseScore: 7, Tags: []string{"category:hats"}},
+			{ItemID: "e", BaseScore: 6, Tags: []string{"category:hats"}},
+			{ItemID: "f", BaseScore: 5},
+		},
+		Output: opts,
+	}
+}
+
+func itemIDs(items []RankedItem) []string {
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.ItemID)
+	}
+	return out
+}
+
+func TestOutputOptionsShapeRankedList(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{})
+	cases := []struct {
+		name string
+		opts *OutputOptions
+		want []string
+	}{
+		{"none", nil, []string{"a", "b", "c", "d", "e", "f"}},
+		{"page", &OutputOptions{Offset: 1, Limit: 2}, []string{"b", "c"}},
+		{"cap_window", &OutputOptions{MaxPerTag: map[string]int{"promo": 2}, MaxPerTagWindow: 3}, []string{"a", "b", "d", "c", "e", "f"}},
+		{"cap_all", &OutputOptions{MaxPerTag: map[string]int{"promo": 1}}, []string{"a", "d", "e", "f", "b", "c"}},
+		{"interleave", &OutputOptions{InterleaveBy: "category:"}, []string{"a", "d", "f", "b", "e", "c"}},
+	}
+	for _, tc := range cases {
+		resp := engine.Decide(context.Background(), outputRequestFixture(tc.opts))
+		if got := itemIDs(resp.Items); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: items = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestOutputPageInfoAndStage(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{})
+	resp := engine.Decide(context.Background(), outputRequestFixture(&OutputOptions{Offset: 2, Limit: 2}))
+	if resp.Page == nil || resp.Page.Total != 6 || resp.Page.NextOffset == nil || *resp.Page.NextOffset != 4 {
+		t.Fatalf("page = %+v", resp.Page)
+	}
+	if last := resp.Stages[len(resp.Stages)-1]; last.Stage != "output" || last.Outcome != "ok" {
+		t.Fatalf("expected trailing output stage, got %+v", last)
+	}
+
+	tail := engine.Decide(context.Background(), outputRequestFixture(&OutputOptions{Offset: 4, Limit: 2}))
+	if tail.Page.NextOffset != nil || len(tail.Items) != 2 {
+		t.Fatalf("expected final page without next_offset, got %+v", tail.Page)
+	}
+}
+
+func TestOutputOptionsInHash(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{})
+	plain := engine.Decide(context.Background(), outputRequestFixture(nil))
+	empty := engine.Decide(context.Background(), outputRequestFixture(&OutputOptions{}))
+	paged := engine.Decide(context.Background(), outputRequestFixture(&OutputOptions{Limit: 3}))
+
+	if plain.DecisionHash == paged.DecisionHash {
+		t.Fatalf("expected output options to change the hash")
+	}
+	if empty.Page == nil || len(empty.Items) != 6 {
+		t.Fatalf("expected empty options to return full page")
+	}
+}
+
+func TestOutputOptionsValidate(t *testing.T) {
+	bad := []OutputOptions{
+		{Limit: -1},
+		{Offset: -1},
+		{MaxPerTag: map[string]int{"": 1}},
+		{MaxPerTag: map[string]int{"promo": -1}},
+	}
+	for _, o := range bad {
+		if err := (DecisionRequest{Output: &o}).Validate(); err == nil {
+			t.Fatalf("expected %+v to be invalid", o)
+		}
+	}
+}
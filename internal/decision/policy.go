@@ -0,0 +1,56 @@
+package decision
+
+import (
+	"context"
+	"time"
+)
+
+// MutationSurface is the activation surface app mutation checks resolve
+// their policy version on.
+const MutationSurface = "mutations"
+
+// PolicyPersistence resolves a tenant's activated policy version. A pointer
+// for the exact surface wins over the tenant-wide one (surface ""); found is
+// false when neither has an activation in effect at the given time.
+type PolicyPersistence interface {
+	ActivePolicyVersion(ctx context.Context, tenantID, surface string, at time.Time) (string, bool, error)
+}
+
+// WithPolicyActivations makes each decision run under the policy version the
+// tenant activated for the request surface. Without an activation the
+// engine's own PolicyVersion applies.
+func WithPolicyActivations(p PolicyPersistence) Option {
+	return func(e *Engine) {
+		e.activations = p
+	}
+}
+
+// ActivePolicyVersion returns the policy version activated for tenantID on
+// surface, falling back to the engine's PolicyVersion.
+func (e *Engine) ActivePolicyVersion(ctx context.Context, tenantID, surface string) (string, error) {
+	if e.activations == nil {
+		return e.PolicyVersion, nil
+	}
+	version, found, err := e.activations.ActivePolicyVersion(ctx, tenantID, surface, time.Now().UTC())
+	if err != nil || !found {
+		return e.PolicyVersion, err
+	}
+	return version, nil
+}
+
+// resolvePolicy pins the engine to the tenant's active policy version. The
+// returned stage is recorded in the decision inputs so replays keep it; it is
+// nil when no activation applies, leaving such decisions hashed as before.
+func (e *Engine) resolvePolicy(ctx context.Context, req DecisionRequest) (*Engine, *StageTrace) {
+	if e.activations == nil {
+		return e, nil
+	}
+	version, found, err := e.activations.ActivePolicyVersion(ctx, req.TenantID, req.Surface, time.Now().UTC())
+	if err != nil {
+		return e, &StageTrace{Stage: "policy_resolve", Outcome: "degraded", ErrMessage: err.Error()}
+	}
+	if !found {
+		return e, nil
+	}
+	return e.WithVersions(version, e.DataVersion), &StageTrace{Stage: "policy_resolve", Outcome: "ok"}
+}
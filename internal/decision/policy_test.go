@@ -0,0 +1,86 @@
+package decision
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type memActivations map[string]string
+
+func (m memActivations) ActivePolicyVersion(_ context.Context, tenantID, surface string, _ time.Time) (string, bool, error) {
+	if v, ok := m[tenantID+"|"+surface]; ok {
+		return v, true, nil
+	}
+	v, ok := m[tenantID+"|"]
+	return v, ok, nil
+}
+
+type failingActivations struct{}
+
+func (failingActivations) ActivePolicyVersion(context.Context, string, string, time.Time) (string, bool, error) {
+	return "", false, errors.New("activations unavailable")
+}
+
+// recordingPolicy blocks the promo tag only under policy-v2, so the policy
+// version the engine passes through is visible in the ranking.
+type recordingPolicy struct{ versions *[]string }
+
+func (p recordingPolicy) Evaluate(_ context.Context, _ string, input map[string]any) (map[string]any, error) {
+	v, _ := input["policy_version"].(string)
+	*p.versions = append(*p.versions, v)
+	if v == "policy-v2" {
+		return map[string]any{"blocked_tags": []string{"promo"}}, nil
+	}
+	return map[string]any{}, nil
+}
+
+func TestActivatedPolicyVersionIsUsedAndReplayed(t *testing.T) {
+	var seen []string
+	rules := memRules{
+		"t|policy-v2": []byte(`{"policy_version":"policy-v2","rules":[{"id":"ent","tags_any":["enterprise"],"boost":50}]}`),
+	}
+	activations := memActivations{"t|home": "policy-v2", "t|": "policy-v3"}
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, recordingPolicy{&seen}, WithRuleSets(rules), WithPolicyActivations(activations))
+
+	resp, in := engine.DecideRecorded(context.Background(), replayRequestFixture())
+	if resp.PolicyVersion != "policy-v2" || stageOutcome(resp, "policy_resolve") != "ok" {
+		t.Fatalf("expected home to run policy-v2, got %s %+v", resp.PolicyVersion, resp.Stages)
+	}
+	if got := itemIDs(resp.Items); len(got) != 2 || got[0] != "a" {
+		t.Fatalf("expected policy-v2 rules and policy model, got %v", got)
+	}
+	if len(seen) != 1 || seen[0] != "policy-v2" {
+		t.Fatalf("policy client saw versions %v", seen)
+	}
+
+	// Rolling the pointer back does not change how the decision replays.
+	delete(activations, "t|home")
+	replayed := engine.WithVersions(resp.PolicyVersion, resp.DataVersion).Recompute(context.Background(), CanonicalRequest(replayRequestFixture()), in)
+	if replayed.DecisionHash != resp.DecisionHash {
+		t.Fatalf("replay hash %s, want %s", replayed.DecisionHash, resp.DecisionHash)
+	}
+
+	req := replayRequestFixture()
+	req.Surface = "search"
+	if other := engine.Decide(context.Background(), req); other.PolicyVersion != "policy-v3" {
+		t.Fatalf("expected tenant-wide activation on search, got %s", other.PolicyVersion)
+	}
+	if v, err := engine.ActivePolicyVersion(context.Background(), "t2", MutationSurface); err != nil || v != "policy-v1" {
+		t.Fatalf("expected engine default for an unactivated tenant, got %q %v", v, err)
+	}
+}
+
+func TestPolicyResolutionWithoutActivationKeepsHash(t *testing.T) {
+	plain := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}).Decide(context.Background(), replayRequestFixture())
+	resolved := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}, WithPolicyActivations(memActivations{})).Decide(context.Background(), replayRequestFixture())
+	if plain.DecisionHash != resolved.DecisionHash {
+		t.Fatalf("expected no activation to leave the hash unchanged")
+	}
+
+	degraded := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}, WithPolicyActivations(failingActivations{})).Decide(context.Background(), replayRequestFixture())
+	if degraded.PolicyVersion != "policy-v1" || degraded.DependencyStatus != "degraded" || stageOutcome(degraded, "policy_resolve") != "degraded" {
+		t.Fatalf("expected degraded fallback to the engine version, got %s %+v", degraded.PolicyVersion, degraded.Stages)
+	}
+}
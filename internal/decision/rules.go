@@ -0,0 +1,293 @@
+package decision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/restarone/violet-deterministic-api/internal/canonical"
+)
+
+const defaultGorseRankWeight = 0.01
+
+// RuleSet is an immutable, versioned set of scoring rules. Rule sets are keyed
+// by (tenant_id, policy_version); once stored they are never edited, so a
+// policy_version always maps to exactly one rule set hash.
+type RuleSet struct {
+	PolicyVersion   string  `json:"policy_version"`
+	GorseRankWeight float64 `json:"gorse_rank_weight"`
+	Rules           []Rule  `json:"rules"`
+	// Pipelines maps a surface to its ordered stage list, which must run
+	// policy_eval before rank. The "default" entry covers surfaces without
+	// their own list; DefaultPipeline applies when neither is set.
+	Pipelines map[string][]string `json:"pipelines,omitempty"`
+	// FrequencyCaps maps a surface to its per-user frequency cap, with the
+	// same "default" fallback as Pipelines.
+	FrequencyCaps map[string]FrequencyCap `json:"frequency_caps,omitempty"`
+}
+
+// Rule adjusts the score of every candidate that matches all of its context
+// predicates and carries at least one of TagsAny (when set). Rules apply in
+// declaration order: boost is added first, then the multiplier, then caps.
+// An omitted multiplier leaves the score unchanged; zero zeroes it.
+type Rule struct {
+	ID         string      `json:"id"`
+	When       []Predicate `json:"when,omitempty"`
+	TagsAny    []string    `json:"tags_any,omitempty"`
+	Boost      float64     `json:"boost,omitempty"`
+	Multiplier *float64    `json:"multiplier,omitempty"`
+	MinScore   *float64    `json:"min_score,omitempty"`
+	MaxScore   *float64    `json:"max_score,omitempty"`
+}
+
+// Predicate matches a single request context key.
+// Supported ops: eq and neq (exactly one value), in and not_in (one or more
+// values), exists, missing.
+type Predicate struct {
+	Key    string   `json:"key"`
+	Op     string   `json:"op"`
+	Values []string `json:"values,omitempty"`
+}
+
+// RulePersistence loads stored rule set documents. Implementations return the
+// raw JSON document written at publish time.
+type RulePersistence interface {
+	GetRuleSet(ctx context.Context, tenantID, policyVersion string) ([]byte, bool, error)
+}
+
+// DefaultRuleSet reproduces the scoring behaviour the engine shipped with:
+// enterprise-tagged items get +10 on enterprise plans and Gorse rank adds 0.01
+// per position.
+func DefaultRuleSet(policyVersion string) RuleSet {
+	return RuleSet{
+		PolicyVersion:   policyVersion,
+		GorseRankWeight: defaultGorseRankWeight,
+		Rules: []Rule{
+			{
+				ID:      "enterprise_plan_bonus",
+				When:    []Predicate{{Key: "plan", Op: "eq", Values: []string{"enterprise"}}},
+				TagsAny: []string{"enterprise"},
+				Boost:   10,
+			},
+		},
+	}
+}
+
+// ParseRuleSet decodes and validates a rule set document.
+func ParseRuleSet(raw []byte) (RuleSet, error) {
+	var rs RuleSet
+	if err := json.Unmarshal(raw, &rs); err != nil {
+		return RuleSet{}, err
+	}
+	if err := rs.Validate(); err != nil {
+		return RuleSet{}, err
+	}
+	return rs, nil
+}
+
+func (rs RuleSet) Validate() error {
+	if strings.TrimSpace(rs.PolicyVersion) == "" {
+		return fmt.Errorf("policy_version required")
+	}
+	if rs.GorseRankWeight < 0 {
+		return fmt.Errorf("gorse_rank_weight must be >= 0")
+	}
+	for surface, stages := range rs.Pipelines {
+		if strings.TrimSpace(surface) == "" {
+			return fmt.Errorf("pipelines surface key required")
+		}
+		rankAt := slices.Index(stages, "rank")
+		if rankAt < 0 {
+			return fmt.Errorf("pipelines[%s] must include rank", surface)
+		}
+		// Without policy_eval ahead of rank the decision would report its
+		// policy version while skipping the policy's filters.
+		if policyAt := slices.Index(stages, "policy_eval"); policyAt < 0 || policyAt > rankAt {
+			return fmt.Errorf("pipelines[%s] must run policy_eval before rank", surface)
+		}
+	}
+	for surface, c := range rs.FrequencyCaps {
+		if strings.TrimSpace(surface) == "" {
+			return fmt.Errorf("frequency_caps surface key required")
+		}
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("frequency_caps[%s]: %w", surface, err)
+		}
+	}
+	seen := map[string]struct{}{}
+	for i, rule := range rs.Rules {
+		id := strings.TrimSpace(rule.ID)
+		if id == "" {
+			return fmt.Errorf("rules[%d].id required", i)
+		}
+		if _, ok := seen[id]; ok {
+			return fmt.Errorf("rules[%d].id duplicate %q", i, id)
+		}
+		seen[id] = struct{}{}
+		if rule.Multiplier != nil && *rule.Multiplier < 0 {
+			return fmt.Errorf("rules[%d].multiplier must be >= 0", i)
+		}
+		if rule.MinScore != nil && rule.MaxScore != nil && *rule.MinScore > *rule.MaxScore {
+			return fmt.Errorf("rules[%d].min_score exceeds max_score", i)
+		}
+		for j, p := range rule.When {
+			if strings.TrimSpace(p.Key) == "" {
+				return fmt.Errorf("rules[%d].when[%d].key required", i, j)
+			}
+			switch p.Op {
+			case "eq", "neq":
+				if len(p.Values) != 1 {
+					return fmt.Errorf("rules[%d].when[%d] op %s requires exactly one value", i, j, p.Op)
+				}
+			case "in", "not_in":
+				if len(p.Values) == 0 {
+					return fmt.Errorf("rules[%d].when[%d] op %s requires values", i, j, p.Op)
+				}
+			case "exists", "missing":
+			default:
+				return fmt.Errorf("rules[%d].when[%d] unsupported op %q", i, j, p.Op)
+			}
+		}
+	}
+	return nil
+}
+
+// Hash returns the content hash of the rule set under canonical.Current.
+func (rs RuleSet) Hash() string {
+	return rs.HashWith(canonical.Current)
+}
+
+// HashWith returns the content hash of the rule set under a canonical.Hash
+// version, so decisions hashed under an older version recompute the rule set
+// hash they recorded. Predicate values and tag lists are order-insensitive;
+// rule order is significant.
+func (rs RuleSet) HashWith(version string) string {
+	normalized := RuleSet{
+		PolicyVersion:   rs.PolicyVersion,
+		GorseRankWeight: rs.GorseRankWeight,
+		Rules:           make([]Rule, 0, len(rs.Rules)),
+		Pipelines:       rs.Pipelines,
+		FrequencyCaps:   rs.FrequencyCaps,
+	}
+	for _, rule := range rs.Rules {
+		r := rule
+		r.TagsAny = normalizeTags(rule.TagsAny)
+		r.When = make([]Predicate, 0, len(rule.When))
+		for _, p := range rule.When {
+			r.When = append(r.When, Predicate{Key: p.Key, Op: p.Op, Values: normalizeTags(p.Values)})
+		}
+		sort.SliceStable(r.When, func(i, j int) bool {
+			if r.When[i].Key == r.When[j].Key {
+				return r.When[i].Op < r.When[j].Op
+			}
+			return r.When[i].Key < r.When[j].Key
+		})
+		normalized.Rules = append(normalized.Rules, r)
+	}
+	h, _ := canonical.Hash(version, normalized)
+	return h
+}
+
+// Pipeline returns the stage list for surface.
+func (rs RuleSet) Pipeline(surface string) []string {
+	if stages, ok := rs.Pipelines[surface]; ok {
+		return stages
+	}
+	if stages, ok := rs.Pipelines["default"]; ok {
+		return stages
+	}
+	return DefaultPipeline
+}
+
+// FrequencyCap returns the frequency cap for surface, if any.
+func (rs RuleSet) FrequencyCap(surface string) (FrequencyCap, bool) {
+	if c, ok := rs.FrequencyCaps[surface]; ok {
+		return c, true
+	}
+	c, ok := rs.FrequencyCaps["default"]
+	return c, ok
+}
+
+// Score applies every matching rule to the candidate base score.
+func (rs RuleSet) Score(reqCtx map[string]string, c CandidateItem) float64 {
+	score, _ := rs.score(reqCtx, c, false)
+	return score
+}
+
+// Explain is Score plus the score change each matching rule made, in rule
+// order.
+func (rs RuleSet) Explain(reqCtx map[string]string, c CandidateItem) (float64, []Contribution) {
+	return rs.score(reqCtx, c, true)
+}
+
+func (rs RuleSet) score(reqCtx map[string]string, c CandidateItem, explain bool) (float64, []Contribution) {
+	score := c.BaseScore
+	var contributions []Contribution
+	for _, rule := range rs.Rules {
+		if !rule.matches(reqCtx, c.Tags) {
+			continue
+		}
+		next := rule.apply(score)
+		if explain {
+			contributions = append(contributions, Contribution{Source: "rule", RuleID: rule.ID, Delta: next - score})
+		}
+		score = next
+	}
+	return score, contributions
+}
+
+func (r Rule) matches(reqCtx map[string]string, tags []string) bool {
+	for _, p := range r.When {
+		if !p.matches(reqCtx) {
+			return false
+		}
+	}
+	if len(r.TagsAny) == 0 {
+		return true
+	}
+	for _, t := range r.TagsAny {
+		if hasTag(tags, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) apply(score float64) float64 {
+	score += r.Boost
+	if r.Multiplier != nil {
+		score *= *r.Multiplier
+	}
+	if r.MinScore != nil && score < *r.MinScore {
+		score = *r.MinScore
+	}
+	if r.MaxScore != nil && score > *r.MaxScore {
+		score = *r.MaxScore
+	}
+	return score
+}
+
+func (p Predicate) matches(reqCtx map[string]string) bool {
+	v, ok := reqCtx[p.Key]
+	switch p.Op {
+	case "exists":
+		return ok
+	case "missing":
+		return !ok
+	// Validate holds eq and neq to exactly one value, so membership is
+	// equality; it also keeps an unvalidated predicate from indexing an
+	// empty list.
+	case "eq":
+		return ok && slices.Contains(p.Values, v)
+	case "neq":
+		return !ok || !slices.Contains(p.Values, v)
+	case "in":
+		return ok && hasTag(p.Values, v)
+	case "not_in":
+		return !ok || !hasTag(p.Values, v)
+	}
+	return false
+}
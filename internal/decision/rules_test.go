@@ -0,0 +1,182 @@
+package decision
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/restarone/violet-deterministic-api/internal/canonical"
+)
+
+type memRules map[string][]byte
+
+func (m memRules) GetRuleSet(_ context.Context, tenantID, policyVersion string) ([]byte, bool, error) {
+	raw, ok := m[tenantID+"|"+policyVersion]
+	return raw, ok, nil
+}
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestDefaultRuleSetMatchesLegacyScoring(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{ids: []string{"b", "a"}}, stubPolicy{})
+	resp := engine.Decide(context.Background(), DecisionRequest{
+		TenantID: "t",
+		UserID:   "u",
+		Surface:  "s",
+		Context:  map[string]string{"plan": "enterprise"},
+		CandidateItems: []CandidateItem{
+			{ItemID: "a", BaseScore: 1, Tags: []string{"enterprise"}},
+			{ItemID: "b", BaseScore: 1},
+		},
+	})
+	if resp.Items[0].ItemID != "a" || resp.Items[0].Score != 11.01 {
+		t.Fatalf("expected enterprise bonus plus rank bonus on a, got %#v", resp.Items)
+	}
+	if resp.Items[1].Score != 1.02 {
+		t.Fatalf("expected rank bonus only on b, got %#v", resp.Items[1])
+	}
+	if resp.RuleSetHash != DefaultRuleSet("policy-v1").Hash() {
+		t.Fatalf("expected default rule set hash, got %s", resp.RuleSetHash)
+	}
+}
+
+func TestRuleSetBoostMultiplierAndCaps(t *testing.T) {
+	rs := RuleSet{
+		PolicyVersion: "policy-v2",
+		Rules: []Rule{
+			{ID: "promo_boost", TagsAny: []string{"promo"}, Boost: 5},
+			{ID: "eu_penalty", When: []Predicate{{Key: "region", Op: "in", Values: []string{"eu-west-1", "eu-central-1"}}}, TagsAny: []string{"us_only"}, Multiplier: floatPtr(0.5)},
+			{ID: "cap", MaxScore: floatPtr(12)},
+		},
+	}
+	if err := rs.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	ctx := map[string]string{"region": "eu-west-1"}
+	if got := rs.Score(ctx, CandidateItem{ItemID: "p", BaseScore: 10, Tags: []string{"promo"}}); got != 12 {
+		t.Fatalf("expected capped promo score 12, got %v", got)
+	}
+	if got := rs.Score(ctx, CandidateItem{ItemID: "u", BaseScore: 10, Tags: []string{"us_only"}}); got != 5 {
+		t.Fatalf("expected penalised score 5, got %v", got)
+	}
+	if got := rs.Score(map[string]string{"region": "us-east-1"}, CandidateItem{ItemID: "u", BaseScore: 10, Tags: []string{"us_only"}}); got != 10 {
+		t.Fatalf("expected unmatched predicate to leave score, got %v", got)
+	}
+}
+
+func TestRuleSetZeroMultiplierZeroesScore(t *testing.T) {
+	rs := RuleSet{PolicyVersion: "p", Rules: []Rule{{ID: "hide", TagsAny: []string{"hidden"}, Multiplier: floatPtr(0)}}}
+	if got := rs.Score(nil, CandidateItem{ItemID: "h", BaseScore: 10, Tags: []string{"hidden"}}); got != 0 {
+		t.Fatalf("expected zeroed score, got %v", got)
+	}
+	if got := rs.Score(nil, CandidateItem{ItemID: "v", BaseScore: 10}); got != 10 {
+		t.Fatalf("expected unmatched rule to leave score, got %v", got)
+	}
+}
+
+func TestRuleSetValidateRejectsUnknownOp(t *testing.T) {
+	rs := RuleSet{PolicyVersion: "p", Rules: []Rule{{ID: "r", When: []Predicate{{Key: "plan", Op: "regex", Values: []string{".*"}}}}}}
+	if err := rs.Validate(); err == nil {
+		t.Fatalf("expected unsupported op error")
+	}
+}
+
+func TestRuleSetValidateRequiresOneValueForEq(t *testing.T) {
+	for _, op := range []string{"eq", "neq"} {
+		for _, values := range [][]string{nil, {"pro", "enterprise"}} {
+			rs := RuleSet{PolicyVersion: "p", Rules: []Rule{{ID: "r", When: []Predicate{{Key: "plan", Op: op, Values: values}}}}}
+			if err := rs.Validate(); err == nil {
+				t.Fatalf("expected %s with %d values to be rejected", op, len(values))
+			}
+		}
+		rs := RuleSet{PolicyVersion: "p", Rules: []Rule{{ID: "r", When: []Predicate{{Key: "plan", Op: op, Values: []string{"pro"}}}}}}
+		if err := rs.Validate(); err != nil {
+			t.Fatalf("expected %s with one value to validate, got %v", op, err)
+		}
+	}
+}
+
+func TestStoredRuleSetDrivesScoreAndHash(t *testing.T) {
+	rs := RuleSet{
+		PolicyVersion:   "policy-v1",
+		GorseRankWeight: 0,
+		Rules:           []Rule{{ID: "promo", TagsAny: []string{"promo"}, Boost: 50}},
+	}
+	raw, _ := json.Marshal(rs)
+	req := DecisionRequest{
+		TenantID: "t",
+		UserID:   "u",
+		Surface:  "s",
+		CandidateItems: []CandidateItem{
+			{ItemID: "a", BaseScore: 10},
+			{ItemID: "b", BaseScore: 1, Tags: []string{"promo"}},
+		},
+	}
+
+	stored := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}, WithRuleSets(memRules{"t|policy-v1": raw}))
+	fallback := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{})
+
+	r1 := stored.Decide(context.Background(), req)
+	r2 := fallback.Decide(context.Background(), req)
+	if r1.Items[0].ItemID != "b" {
+		t.Fatalf("expected stored promo rule to rank b first, got %#v", r1.Items)
+	}
+	if r1.RuleSetHash != rs.Hash() {
+		t.Fatalf("expected stored rule set hash %s, got %s", rs.Hash(), r1.RuleSetHash)
+	}
+	if r1.DecisionHash == r2.DecisionHash {
+		t.Fatalf("expected rule set to participate in decision hash")
+	}
+	if r1.Stages[0].Stage != "rule_load" || r1.Stages[0].Outcome != "ok" {
+		t.Fatalf("expected rule_load ok stage, got %#v", r1.Stages[0])
+	}
+	if r2.Stages[0].Outcome != "default" {
+		t.Fatalf("expected rule_load default stage, got %#v", r2.Stages[0])
+	}
+}
+
+func TestRuleSetHashIgnoresTagOrder(t *testing.T) {
+	a := RuleSet{PolicyVersion: "p", Rules: []Rule{{ID: "r", TagsAny: []string{"x", "y"}, When: []Predicate{{Key: "k", Op: "in", Values: []string{"2", "1"}}}}}}
+	b := RuleSet{PolicyVersion: "p", Rules: []Rule{{ID: "r", TagsAny: []string{"y", "x"}, When: []Predicate{{Key: "k", Op: "in", Values: []string{"1", "2"}}}}}}
+	if a.Hash() != b.Hash() {
+		t.Fatalf("expected order-insensitive rule set hash")
+	}
+}
+
+func TestRuleSetHashIsCanonicalAndVersioned(t *testing.T) {
+	rs := RuleSet{PolicyVersion: "p", Rules: []Rule{{ID: "r", Boost: 1}}}
+	if h := rs.Hash(); canonical.HashVersion(h) != canonical.Current || h != rs.HashWith(canonical.Current) {
+		t.Fatalf("expected a %s hash, got %s", canonical.Current, h)
+	}
+	legacy := rs.HashWith(canonical.V1)
+	if want, _ := canonical.Hash(canonical.V1, rs); legacy != want || canonical.HashVersion(legacy) != canonical.V1 {
+		t.Fatalf("expected the legacy encoding/json hash, got %s", legacy)
+	}
+}
+
+func TestWithRuleSetOverridesWithoutMutatingBase(t *testing.T) {
+	base := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{})
+	req := DecisionRequest{
+		TenantID: "t",
+		UserID:   "u",
+		Surface:  "s",
+		CandidateItems: []CandidateItem{
+			{ItemID: "a", BaseScore: 2},
+			{ItemID: "b", BaseScore: 1, Tags: []string{"promo"}},
+		},
+	}
+	candidate := RuleSet{PolicyVersion: "policy-v2", Rules: []Rule{{ID: "promo", TagsAny: []string{"promo"}, Boost: 5}}}
+
+	current, inputs := base.DecideRecorded(context.Background(), req)
+	simulated := base.WithVersions("policy-v2", "data-v1").WithRuleSet(candidate).Recompute(context.Background(), req, inputs)
+
+	if current.Items[0].ItemID != "a" || simulated.Items[0].ItemID != "b" {
+		t.Fatalf("expected promo override to reorder, current=%#v simulated=%#v", current.Items, simulated.Items)
+	}
+	if simulated.RuleSetHash != candidate.Hash() || simulated.Stages[0].Outcome != "override" {
+		t.Fatalf("expected override rule set in trace, got %s %#v", simulated.RuleSetHash, simulated.Stages[0])
+	}
+	if again := base.Decide(context.Background(), req); again.DecisionHash != current.DecisionHash {
+		t.Fatalf("expected base engine unaffected by simulation")
+	}
+}
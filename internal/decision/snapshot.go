@@ -0,0 +1,137 @@
+package decision
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// SnapshotPersistence stores Gorse responses keyed by (tenant, user,
+// data_version). PutGorseSnapshot keeps the first snapshot written for a key
+// and returns the stored document. ReplaceGorseSnapshot swaps the stored
+// document for payload only while it still equals prev, and returns whichever
+// document is stored afterwards.
+type SnapshotPersistence interface {
+	GetGorseSnapshot(ctx context.Context, tenantID, userID, dataVersion string) ([]byte, bool, error)
+	PutGorseSnapshot(ctx context.Context, tenantID, userID, dataVersion string, payload []byte) ([]byte, error)
+	ReplaceGorseSnapshot(ctx context.Context, tenantID, userID, dataVersion string, prev, payload []byte) ([]byte, error)
+}
+
+// gorseSnapshot is a stored Gorse response. N is the number of items it was
+// requested for; snapshots written before N was recorded read it as the
+// length of ItemIDs.
+type gorseSnapshot struct {
+	N       int      `json:"n,omitempty"`
+	ItemIDs []string `json:"item_ids"`
+
+	raw []byte
+}
+
+// covers reports whether the snapshot answers a request for n items.
+func (s gorseSnapshot) covers(n int) bool {
+	return s.N >= n
+}
+
+// items returns the first n pinned items, the answer Gorse gave for n.
+func (s gorseSnapshot) items(n int) []string {
+	if n < len(s.ItemIDs) {
+		return s.ItemIDs[:n]
+	}
+	return s.ItemIDs
+}
+
+// WithGorseSnapshots pins Gorse retrieval per data_version: the first
+// response for a (tenant, user, data_version) is stored and every later
+// decision under that data_version reuses it, even if Gorse has retrained.
+// A request for more items than the snapshot holds fetches again and extends
+// the snapshot, keeping the items already pinned first.
+func WithGorseSnapshots(p SnapshotPersistence) Option {
+	return func(e *Engine) {
+		e.snapshots = p
+	}
+}
+
+// ReadOnly returns an engine that reads Gorse snapshots but never writes
+// them, nor feeds the retrieval client's last_good cache, for what-if and
+// shadow runs that must not pin retrieval.
+func (e *Engine) ReadOnly() *Engine {
+	cp := *e
+	cp.readOnly = true
+	return &cp
+}
+
+// PinnedRetrieval returns the Gorse items snapshotted for req under the
+// engine data_version, if a snapshot covering the request exists. It never
+// calls Gorse or writes a snapshot.
+func (e *Engine) PinnedRetrieval(ctx context.Context, req DecisionRequest) ([]string, bool, error) {
+	if e.snapshots == nil || req.UserID == "" {
+		return nil, false, nil
+	}
+	eng, req, _ := e.resolveCatalog(ctx, req)
+	n := len(req.CandidateItems)
+	snap, ok, err := eng.loadGorseSnapshot(ctx, req)
+	if err != nil || !ok || !snap.covers(n) {
+		return nil, false, err
+	}
+	return snap.items(n), true, nil
+}
+
+func (e *Engine) loadGorseSnapshot(ctx context.Context, req DecisionRequest) (gorseSnapshot, bool, error) {
+	raw, ok, err := e.snapshots.GetGorseSnapshot(ctx, req.TenantID, req.UserID, e.DataVersion)
+	if err != nil || !ok {
+		return gorseSnapshot{}, false, err
+	}
+	snap, err := decodeGorseSnapshot(raw)
+	return snap, err == nil, err
+}
+
+// storeGorseSnapshot pins ids as the answer for n items. When prev is set,
+// the fetched ids extend it rather than replace it, so decisions already
+// made under this data_version keep their retrieval input.
+func (e *Engine) storeGorseSnapshot(ctx context.Context, req DecisionRequest, prev *gorseSnapshot, n int, ids []string) (gorseSnapshot, error) {
+	next := gorseSnapshot{N: n, ItemIDs: append([]string{}, ids...)}
+	if prev != nil {
+		next.ItemIDs = extendPinned(prev.ItemIDs, ids)
+	}
+	raw, err := json.Marshal(next)
+	if err != nil {
+		return gorseSnapshot{}, err
+	}
+	var stored []byte
+	if prev == nil {
+		stored, err = e.snapshots.PutGorseSnapshot(ctx, req.TenantID, req.UserID, e.DataVersion, raw)
+	} else {
+		stored, err = e.snapshots.ReplaceGorseSnapshot(ctx, req.TenantID, req.UserID, e.DataVersion, prev.raw, raw)
+	}
+	if err != nil {
+		return gorseSnapshot{}, err
+	}
+	return decodeGorseSnapshot(stored)
+}
+
+func decodeGorseSnapshot(raw []byte) (gorseSnapshot, error) {
+	var snap gorseSnapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return gorseSnapshot{}, err
+	}
+	if snap.N == 0 {
+		snap.N = len(snap.ItemIDs)
+	}
+	snap.raw = raw
+	return snap, nil
+}
+
+// extendPinned appends the fetched ids not already pinned.
+func extendPinned(pinned, fetched []string) []string {
+	out := append([]string{}, pinned...)
+	seen := make(map[string]bool, len(pinned))
+	for _, id := range pinned {
+		seen[id] = true
+	}
+	for _, id := range fetched {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
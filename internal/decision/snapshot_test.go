@@ -0,0 +1,158 @@
+package decision
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorse"
+)
+
+type memSnapshots struct {
+	docs map[string][]byte
+}
+
+func (m *memSnapshots) GetGorseSnapshot(_ context.Context, tenantID, userID, dataVersion string) ([]byte, bool, error) {
+	raw, ok := m.docs[tenantID+"|"+userID+"|"+dataVersion]
+	return raw, ok, nil
+}
+
+func (m *memSnapshots) PutGorseSnapshot(_ context.Context, tenantID, userID, dataVersion string, payload []byte) ([]byte, error) {
+	key := tenantID + "|" + userID + "|" + dataVersion
+	if existing, ok := m.docs[key]; ok {
+		return existing, nil
+	}
+	m.docs[key] = payload
+	return payload, nil
+}
+
+func (m *memSnapshots) ReplaceGorseSnapshot(_ context.Context, tenantID, userID, dataVersion string, prev, payload []byte) ([]byte, error) {
+	key := tenantID + "|" + userID + "|" + dataVersion
+	if string(m.docs[key]) == string(prev) {
+		m.docs[key] = payload
+	}
+	return m.docs[key], nil
+}
+
+type sequenceGorse struct {
+	calls   int
+	results [][]string
+}
+
+func (s *sequenceGorse) Recommend(context.Context, string, int) ([]string, error) {
+	out := s.results[s.calls%len(s.results)]
+	s.calls++
+	return out, nil
+}
+
+func TestGorseSnapshotPinsRetrievalPerDataVersion(t *testing.T) {
+	snaps := &memSnapshots{docs: map[string][]byte{}}
+	upstream := &sequenceGorse{results: [][]string{{"b", "a"}, {"a", "b"}}}
+	engine := NewEngine("policy-v1", "data-v1", upstream, stubPolicy{}, WithGorseSnapshots(snaps))
+	req := replayRequestFixture()
+
+	first, firstIn := engine.DecideRecorded(context.Background(), req)
+	second, secondIn := engine.DecideRecorded(context.Background(), req)
+
+	if upstream.calls != 1 {
+		t.Fatalf("expected one upstream call, got %d", upstream.calls)
+	}
+	if !reflect.DeepEqual(firstIn.GorseIDs, []string{"b", "a"}) || !reflect.DeepEqual(secondIn.GorseIDs, firstIn.GorseIDs) {
+		t.Fatalf("snapshot not reused: %v then %v", firstIn.GorseIDs, secondIn.GorseIDs)
+	}
+	if first.DecisionHash != second.DecisionHash {
+		t.Fatalf("expected identical hash under the same data_version")
+	}
+
+	_, nextIn := engine.WithVersions("policy-v1", "data-v2").DecideRecorded(context.Background(), req)
+	if upstream.calls != 2 || !reflect.DeepEqual(nextIn.GorseIDs, []string{"a", "b"}) {
+		t.Fatalf("expected fresh retrieval for new data_version, got %v", nextIn.GorseIDs)
+	}
+}
+
+func TestGorseSnapshotRefetchesForLargerRequests(t *testing.T) {
+	snaps := &memSnapshots{docs: map[string][]byte{}}
+	upstream := &sequenceGorse{results: [][]string{{"b", "a"}, {"a", "c", "b"}}}
+	engine := NewEngine("policy-v1", "data-v1", upstream, stubPolicy{}, WithGorseSnapshots(snaps))
+	full := replayRequestFixture()
+	small := full
+	small.CandidateItems = full.CandidateItems[:2]
+
+	_, smallIn := engine.DecideRecorded(context.Background(), small)
+	_, fullIn := engine.DecideRecorded(context.Background(), full)
+	if upstream.calls != 2 {
+		t.Fatalf("expected a refetch for the larger request, got %d calls", upstream.calls)
+	}
+	if !reflect.DeepEqual(smallIn.GorseIDs, []string{"b", "a"}) || !reflect.DeepEqual(fullIn.GorseIDs, []string{"b", "a", "c"}) {
+		t.Fatalf("expected the pinned items kept first, got %v then %v", smallIn.GorseIDs, fullIn.GorseIDs)
+	}
+
+	_, againIn := engine.DecideRecorded(context.Background(), small)
+	if upstream.calls != 2 || !reflect.DeepEqual(againIn.GorseIDs, smallIn.GorseIDs) {
+		t.Fatalf("expected the smaller request served from the snapshot, got %v after %d calls", againIn.GorseIDs, upstream.calls)
+	}
+}
+
+func TestReadOnlyEngineDoesNotWriteSnapshots(t *testing.T) {
+	snaps := &memSnapshots{docs: map[string][]byte{}}
+	upstream := &sequenceGorse{results: [][]string{{"b", "a"}}}
+	engine := NewEngine("policy-v1", "data-v1", upstream, stubPolicy{}, WithGorseSnapshots(snaps))
+	req := replayRequestFixture()
+
+	if _, in := engine.ReadOnly().DecideRecorded(context.Background(), req); !reflect.DeepEqual(in.GorseIDs, []string{"b", "a"}) {
+		t.Fatalf("expected live retrieval, got %v", in.GorseIDs)
+	}
+	if len(snaps.docs) != 0 {
+		t.Fatalf("expected no snapshot written, got %d", len(snaps.docs))
+	}
+	if _, found, err := engine.PinnedRetrieval(context.Background(), req); found || err != nil {
+		t.Fatalf("expected no pinned retrieval, got found=%v err=%v", found, err)
+	}
+
+	engine.DecideRecorded(context.Background(), req)
+	ids, found, err := engine.ReadOnly().PinnedRetrieval(context.Background(), req)
+	if err != nil || !found || !reflect.DeepEqual(ids, []string{"b", "a"}) {
+		t.Fatalf("expected the pinned items, got %v found=%v err=%v", ids, found, err)
+	}
+}
+
+type toggleGorse struct {
+	down bool
+}
+
+func (g *toggleGorse) Recommend(context.Context, string, int) ([]string, error) {
+	if g.down {
+		return nil, errors.New("gorse down")
+	}
+	return []string{"b", "a"}, nil
+}
+
+func TestReadOnlyEngineLeavesLastGoodCacheUnchanged(t *testing.T) {
+	snaps := &memSnapshots{docs: map[string][]byte{}}
+	upstream := &toggleGorse{}
+	client, err := gorse.NewResilientClient(upstream, gorse.ResilientConfig{MaxAttempts: 1, Fallbacks: []string{"last_good"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine("policy-v1", "data-v1", client, stubPolicy{}, WithGorseSnapshots(snaps))
+	req := replayRequestFixture()
+
+	if _, in := engine.ReadOnly().DecideRecorded(context.Background(), req); !reflect.DeepEqual(in.GorseIDs, []string{"b", "a"}) {
+		t.Fatalf("expected live retrieval, got %v", in.GorseIDs)
+	}
+	if len(snaps.docs) != 0 {
+		t.Fatalf("expected no snapshot written, got %d", len(snaps.docs))
+	}
+	upstream.down = true
+	if _, trace, _ := client.RecommendTraced(context.Background(), req.UserID, 3); trace[len(trace)-1].Outcome != "empty" {
+		t.Fatalf("expected an empty last_good cache after a read-only run, got %+v", trace)
+	}
+
+	upstream.down = false
+	engine.DecideRecorded(context.Background(), req)
+	upstream.down = true
+	if ids, _, err := client.RecommendTraced(context.Background(), req.UserID, 3); err != nil || !reflect.DeepEqual(ids, []string{"b", "a"}) {
+		t.Fatalf("expected a live run to fill the last_good cache, got %v err=%v", ids, err)
+	}
+}
@@ -0,0 +1,257 @@
+package decision
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorules"
+	"github.com/restarone/violet-deterministic-api/internal/adapters/pipeline"
+)
+
+// DefaultPipeline is the stage list used when a rule set configures none for
+// the request surface.
+var DefaultPipeline = []string{"gorse_recommend", "policy_eval", "rank"}
+
+const stateKey = "decision_state"
+
+// evalState is the decision being built as it moves through the pipeline.
+// Stages read it from the payload and return an updated copy.
+type evalState struct {
+	Request DecisionRequest
+	RuleSet RuleSet
+	Inputs  DecisionInputs
+
+	GorseIDs     []string
+	BlockedTags  map[string]struct{}
+	BlockedItems map[string]struct{}
+	Items        []RankedItem
+	Removed      []RemovedItem
+	Page         *PageInfo
+
+	// PolicyEvaluator is the evaluator that answered policy_eval.
+	PolicyEvaluator string
+	// Policy is the policy evaluation policy_eval applied.
+	Policy *PolicyEvaluation
+
+	policy gorules.Client
+}
+
+func stateOf(payload map[string]any) (evalState, error) {
+	st, ok := payload[stateKey].(evalState)
+	if !ok {
+		return evalState{}, fmt.Errorf("payload missing %s", stateKey)
+	}
+	return st, nil
+}
+
+func withState(st evalState) map[string]any {
+	return map[string]any{stateKey: st}
+}
+
+// WithStage registers a custom stage that rule sets can name in their
+// pipelines. Stages read and return the payload unchanged apart from the
+// decision state, and must be deterministic given that state.
+func WithStage(name string, stage pipeline.Stage) Option {
+	return func(e *Engine) {
+		e.registry.Register(name, stage)
+	}
+}
+
+func registerBuiltinStages(r *pipeline.Registry) {
+	r.Register("gorse_recommend", gorseStage)
+	r.Register("policy_eval", policyStage)
+	r.Register("rank", rankStage)
+	r.Register("frequency_cap", frequencyCapStage)
+	r.Register("output", outputStage)
+}
+
+// ValidatePipelines checks every stage list in rs resolves against the
+// engine's registered stages.
+func (e *Engine) ValidatePipelines(rs RuleSet) error {
+	surfaces := make([]string, 0, len(rs.Pipelines))
+	for surface := range rs.Pipelines {
+		surfaces = append(surfaces, surface)
+	}
+	sort.Strings(surfaces)
+	for _, surface := range surfaces {
+		if _, err := e.registry.Resolve(rs.Pipelines[surface]); err != nil {
+			return fmt.Errorf("pipelines[%s]: %w", surface, err)
+		}
+	}
+	return nil
+}
+
+// gorseStage replays the recorded retrieval into the state. Fallback sources
+// are traced as their own stages right after it.
+func gorseStage(_ context.Context, payload map[string]any) (map[string]any, error) {
+	st, err := stateOf(payload)
+	if err != nil {
+		return nil, err
+	}
+	st.GorseIDs = append([]string{}, st.Inputs.GorseIDs...)
+	extra := make([]pipeline.Trace, 0, len(st.Inputs.FallbackStages))
+	for _, fb := range st.Inputs.FallbackStages {
+		extra = append(extra, pipeline.Trace{Stage: fb.Stage, Outcome: fb.Outcome, Message: fb.ErrMessage})
+	}
+	in := st.Inputs.GorseStage
+	if in.Outcome == "ok" && len(extra) == 0 {
+		return withState(st), nil
+	}
+	return withState(st), pipeline.Outcome(in.Outcome, in.ErrMessage, extra...)
+}
+
+// PolicyEvaluation is the policy output a decision's policy_eval stage
+// applied, recorded with the decision inputs so a recompute filters the same
+// way without asking the evaluator again. A failed evaluation is recorded
+// with its outcome and error so the replay degrades the same way.
+type PolicyEvaluation struct {
+	PolicyVersion string   `json:"policy_version"`
+	Outcome       string   `json:"outcome"`
+	ErrMessage    string   `json:"error,omitempty"`
+	Evaluator     string   `json:"evaluator,omitempty"`
+	BlockedTags   []string `json:"blocked_tags,omitempty"`
+	BlockedItems  []string `json:"blocked_items,omitempty"`
+}
+
+func policyStage(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	st, err := stateOf(payload)
+	if err != nil {
+		return nil, err
+	}
+	if rec := st.Inputs.Policy; rec != nil && rec.PolicyVersion == st.RuleSet.PolicyVersion {
+		return applyPolicy(st, *rec)
+	}
+	if st.policy == nil {
+		return withState(st), pipeline.Outcome("skipped", "")
+	}
+	req := st.Request
+	rec := PolicyEvaluation{PolicyVersion: st.RuleSet.PolicyVersion, Outcome: "ok", Evaluator: gorules.EvaluatorLocal}
+	out, err := st.policy.Evaluate(ctx, req.TenantID, map[string]any{
+		"surface":        req.Surface,
+		"context":        req.Context,
+		"candidate_len":  len(req.CandidateItems),
+		"policy_version": st.RuleSet.PolicyVersion,
+	})
+	if err != nil {
+		rec = PolicyEvaluation{PolicyVersion: rec.PolicyVersion, Outcome: "degraded", ErrMessage: err.Error()}
+		return applyPolicy(st, rec)
+	}
+	if ev, ok := out["evaluator"].(string); ok && ev != "" {
+		rec.Evaluator = ev
+	}
+	rec.BlockedTags = stringList(out["blocked_tags"])
+	rec.BlockedItems = stringList(out["blocked_items"])
+	return applyPolicy(st, rec)
+}
+
+// applyPolicy loads a policy evaluation's filters into the state.
+func applyPolicy(st evalState, rec PolicyEvaluation) (map[string]any, error) {
+	st.Policy = &rec
+	if rec.Outcome != "ok" {
+		return withState(st), pipeline.Outcome(rec.Outcome, rec.ErrMessage)
+	}
+	st.PolicyEvaluator = rec.Evaluator
+	st.BlockedTags = map[string]struct{}{}
+	for _, t := range rec.BlockedTags {
+		st.BlockedTags[t] = struct{}{}
+	}
+	st.BlockedItems = map[string]struct{}{}
+	for _, id := range rec.BlockedItems {
+		st.BlockedItems[id] = struct{}{}
+	}
+	return withState(st), nil
+}
+
+func rankStage(_ context.Context, payload map[string]any) (map[string]any, error) {
+	st, err := stateOf(payload)
+	if err != nil {
+		return nil, err
+	}
+	req := st.Request
+	ruleSet := st.RuleSet
+
+	gorseRank := map[string]int{}
+	for i, itemID := range st.GorseIDs {
+		gorseRank[itemID] = i
+	}
+
+	scored := make([]RankedItem, 0, len(req.CandidateItems))
+	var removed []RemovedItem
+	for _, c := range req.CandidateItems {
+		if reason, tag := removalReason(c, st.BlockedTags, st.BlockedItems); reason != "" {
+			if req.Explain {
+				removed = append(removed, RemovedItem{ItemID: c.ItemID, Reason: reason, Tag: tag})
+			}
+			continue
+		}
+		if !req.Explain {
+			score := ruleSet.Score(req.Context, c)
+			if rank, ok := gorseRank[c.ItemID]; ok {
+				score += float64(len(st.GorseIDs)-rank) * ruleSet.GorseRankWeight
+			}
+			scored = append(scored, RankedItem{ItemID: c.ItemID, Score: score})
+			continue
+		}
+		score, contributions := ruleSet.Explain(req.Context, c)
+		ex := &ItemExplanation{
+			BaseScore:     c.BaseScore,
+			Contributions: contributions,
+			Filters:       []string{"blocked", "blocked_tag", "policy"},
+		}
+		if rank, ok := gorseRank[c.ItemID]; ok {
+			delta := float64(len(st.GorseIDs)-rank) * ruleSet.GorseRankWeight
+			score += delta
+			r := rank
+			ex.GorseRank = &r
+			ex.Contributions = append(ex.Contributions, Contribution{Source: "gorse_rank", Delta: delta})
+		}
+		if ex.Contributions == nil {
+			ex.Contributions = []Contribution{}
+		}
+		scored = append(scored, RankedItem{ItemID: c.ItemID, Score: score, Explanation: ex})
+	}
+	// Removal order follows item_id so explanations do not depend on the order
+	// candidates were submitted in.
+	sort.Slice(removed, func(i, j int) bool {
+		if removed[i].ItemID == removed[j].ItemID {
+			return removed[i].Reason < removed[j].Reason
+		}
+		return removed[i].ItemID < removed[j].ItemID
+	})
+
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].Score == scored[j].Score {
+			return scored[i].ItemID < scored[j].ItemID
+		}
+		return scored[i].Score > scored[j].Score
+	})
+	st.Items = scored
+	st.Removed = removed
+	return withState(st), nil
+}
+
+// insertAfterRank adds stage right after "rank", or at the end when the
+// pipeline has no rank stage.
+func insertAfterRank(names []string, resolved []pipeline.Named, stage pipeline.Named) ([]string, []pipeline.Named) {
+	at := len(names)
+	for i, name := range names {
+		if name == "rank" {
+			at = i + 1
+			break
+		}
+	}
+	outNames := make([]string, 0, len(names)+1)
+	outNames = append(append(append(outNames, names[:at]...), stage.Name), names[at:]...)
+	outResolved := make([]pipeline.Named, 0, len(resolved)+1)
+	outResolved = append(append(append(outResolved, resolved[:at]...), stage), resolved[at:]...)
+	return outNames, outResolved
+}
+
+func degradedOutcome(outcome string) bool {
+	switch outcome {
+	case "ok", "skipped", "default", "override":
+		return false
+	}
+	return true
+}
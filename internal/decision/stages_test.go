@@ -0,0 +1,139 @@
+package decision
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/pipeline"
+)
+
+func stageNames(stages []StageTrace) []string {
+	out := make([]string, 0, len(stages))
+	for _, s := range stages {
+		out = append(out, s.Stage)
+	}
+	return out
+}
+
+func TestSurfacePipelineFromRuleSet(t *testing.T) {
+	rs := DefaultRuleSet("policy-v1")
+	rs.Pipelines = map[string][]string{"search": {"policy_eval", "rank"}}
+	upstream := &sequenceGorse{results: [][]string{{"a"}}}
+	engine := NewEngine("policy-v1", "data-v1", upstream, stubPolicy{}).WithRuleSet(rs)
+
+	req := replayRequestFixture()
+	req.Surface = "search"
+	resp, in := engine.DecideRecorded(context.Background(), req)
+
+	if upstream.calls != 0 || in.GorseStage.Stage != "" {
+		t.Fatalf("expected no retrieval for a pipeline without gorse_recommend")
+	}
+	if got := stageNames(resp.Stages); len(got) != 3 || got[1] != "policy_eval" || got[2] != "rank" {
+		t.Fatalf("stages = %v", got)
+	}
+
+	home := engine.Decide(context.Background(), replayRequestFixture())
+	if got := stageNames(home.Stages); len(got) != 4 || got[1] != "gorse_recommend" {
+		t.Fatalf("expected default pipeline for other surfaces, got %v", got)
+	}
+}
+
+func TestCustomStageAndPipelineHash(t *testing.T) {
+	// keepTop trims the ranked list to its first item.
+	keepTop := func(_ context.Context, payload map[string]any) (map[string]any, error) {
+		st, err := stateOf(payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(st.Items) > 1 {
+			st.Items = st.Items[:1]
+		}
+		return withState(st), nil
+	}
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}, WithStage("keep_top", pipeline.Stage(keepTop)))
+
+	base := DefaultRuleSet("policy-v1")
+	custom := DefaultRuleSet("policy-v1")
+	custom.Pipelines = map[string][]string{"default": {"gorse_recommend", "policy_eval", "rank", "keep_top"}}
+	if err := engine.ValidatePipelines(custom); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	plain := engine.WithRuleSet(base).Decide(context.Background(), replayRequestFixture())
+	trimmed := engine.WithRuleSet(custom).Decide(context.Background(), replayRequestFixture())
+	if len(trimmed.Items) != 1 || trimmed.Items[0] != plain.Items[0] {
+		t.Fatalf("custom stage not applied: %+v", trimmed.Items)
+	}
+	if trimmed.Stages[len(trimmed.Stages)-1].Stage != "keep_top" {
+		t.Fatalf("expected keep_top trace, got %v", stageNames(trimmed.Stages))
+	}
+	if plain.DecisionHash == trimmed.DecisionHash {
+		t.Fatalf("expected stage list to change the decision hash")
+	}
+}
+
+func TestUnknownStageFallsBackToDefaultPipeline(t *testing.T) {
+	engine := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{})
+	rs := DefaultRuleSet("policy-v1")
+	rs.Pipelines = map[string][]string{"default": {"rank", "diversity"}}
+	if err := engine.ValidatePipelines(rs); err == nil {
+		t.Fatalf("expected unknown stage to fail validation")
+	}
+
+	resp := engine.WithRuleSet(rs).Decide(context.Background(), replayRequestFixture())
+	if resp.DependencyStatus != "degraded" || resp.Stages[1].Stage != "pipeline_resolve" {
+		t.Fatalf("expected degraded pipeline_resolve trace, got %v", stageNames(resp.Stages))
+	}
+	if len(resp.Items) == 0 {
+		t.Fatalf("expected default pipeline to still rank")
+	}
+}
+
+func TestRuleSetPipelineValidation(t *testing.T) {
+	rs := DefaultRuleSet("policy-v1")
+	rs.Pipelines = map[string][]string{"home": {"gorse_recommend", "policy_eval"}}
+	if err := rs.Validate(); err == nil {
+		t.Fatalf("expected pipeline without rank to be rejected")
+	}
+	for _, stages := range [][]string{{"gorse_recommend", "rank"}, {"gorse_recommend", "rank", "policy_eval"}} {
+		rs.Pipelines = map[string][]string{"home": stages}
+		if err := rs.Validate(); err == nil || !strings.Contains(err.Error(), "policy_eval before rank") {
+			t.Fatalf("expected %v to be rejected for skipping policy filters, got %v", stages, err)
+		}
+	}
+	rs.Pipelines = map[string][]string{"home": {"policy_eval", "rank"}}
+	if err := rs.Validate(); err != nil {
+		t.Fatalf("expected policy_eval before rank to validate, got %v", err)
+	}
+}
+
+type evaluatorPolicy string
+
+func (p evaluatorPolicy) Evaluate(context.Context, string, map[string]any) (map[string]any, error) {
+	return map[string]any{"allowed": true, "evaluator": string(p)}, nil
+}
+
+func TestPolicyStageRecordsEvaluatorOutsideHash(t *testing.T) {
+	remote := NewEngine("policy-v1", "data-v1", stubGorse{}, evaluatorPolicy("remote")).Decide(context.Background(), replayRequestFixture())
+	fallback := NewEngine("policy-v1", "data-v1", stubGorse{}, evaluatorPolicy("local_fallback")).Decide(context.Background(), replayRequestFixture())
+	local := NewEngine("policy-v1", "data-v1", stubGorse{}, stubPolicy{}).Decide(context.Background(), replayRequestFixture())
+
+	evaluator := func(resp DecisionResponse) string {
+		for _, s := range resp.Stages {
+			if s.Stage == "policy_eval" {
+				return s.Evaluator
+			}
+		}
+		return ""
+	}
+	if evaluator(remote) != "remote" || evaluator(fallback) != "local_fallback" || evaluator(local) != "local" {
+		t.Fatalf("evaluators = %q %q %q", evaluator(remote), evaluator(fallback), evaluator(local))
+	}
+	if remote.DecisionHash != fallback.DecisionHash || remote.DecisionHash != local.DecisionHash {
+		t.Fatalf("expected the evaluator to stay out of the hash")
+	}
+	if d := CompareDecisions(remote, fallback); !d.StagesMatch {
+		t.Fatalf("expected stages to match across evaluators")
+	}
+}
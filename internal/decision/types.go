@@ -1,6 +1,10 @@
 package decision
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type CandidateItem struct {
 	ItemID    string   `json:"item_id"`
@@ -15,35 +19,131 @@ type DecisionRequest struct {
 	Surface        string            `json:"surface"`
 	Context        map[string]string `json:"context,omitempty"`
 	CandidateItems []CandidateItem   `json:"candidate_items"`
+	// Catalog sources candidates from the tenant catalog; it is exclusive with
+	// CandidateItems.
+	Catalog *CatalogSelector `json:"catalog,omitempty"`
+	// Output limits, pages and diversifies the ranked list; see OutputOptions.
+	Output *OutputOptions `json:"output,omitempty"`
+	// Explain asks for per-item score breakdowns. It does not take part in the
+	// decision hash.
+	Explain bool `json:"explain,omitempty"`
+}
+
+func (r DecisionRequest) Validate() error {
+	if r.Catalog != nil {
+		if len(r.CandidateItems) > 0 {
+			return fmt.Errorf("catalog and candidate_items are mutually exclusive")
+		}
+		if err := r.Catalog.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.Output != nil {
+		return r.Output.Validate()
+	}
+	return nil
 }
 
 type RankedItem struct {
-	ItemID string  `json:"item_id"`
-	Score  float64 `json:"score"`
+	ItemID      string           `json:"item_id"`
+	Score       float64          `json:"score"`
+	Explanation *ItemExplanation `json:"explanation,omitempty"`
+}
+
+// ItemExplanation breaks a ranked item's final score into the base score and
+// the ordered contributions applied on top of it. Filters lists the filters
+// the item was checked against and passed.
+type ItemExplanation struct {
+	BaseScore     float64        `json:"base_score"`
+	Contributions []Contribution `json:"contributions"`
+	GorseRank     *int           `json:"gorse_rank,omitempty"`
+	Filters       []string       `json:"filters"`
+}
+
+// Contribution is the score change from one source. Source is "rule" (with
+// RuleID) or "gorse_rank".
+type Contribution struct {
+	Source string  `json:"source"`
+	RuleID string  `json:"rule_id,omitempty"`
+	Delta  float64 `json:"delta"`
+}
+
+// RemovedItem is a candidate filtered out of the decision. Reason is
+// "blocked" for the candidate flag, "blocked_tag" for a policy-denied tag
+// (Tag names it), "policy" for an item the policy denied by ID or
+// "frequency_cap" for an item dropped by the surface frequency cap.
+type RemovedItem struct {
+	ItemID string `json:"item_id"`
+	Reason string `json:"reason"`
+	Tag    string `json:"tag,omitempty"`
 }
 
 type DecisionResponse struct {
-	DecisionID       string       `json:"decision_id"`
-	DecisionHash     string       `json:"decision_hash"`
-	PolicyVersion    string       `json:"policy_version"`
-	DataVersion      string       `json:"data_version"`
-	GeneratedAt      time.Time    `json:"generated_at"`
-	TraceID          string       `json:"trace_id"`
-	DependencyStatus string       `json:"dependency_status"`
-	Items            []RankedItem `json:"items"`
-	Stages           []StageTrace `json:"stages"`
+	DecisionID       string        `json:"decision_id"`
+	DecisionHash     string        `json:"decision_hash"`
+	PolicyVersion    string        `json:"policy_version"`
+	DataVersion      string        `json:"data_version"`
+	RuleSetHash      string        `json:"rule_set_hash"`
+	GeneratedAt      time.Time     `json:"generated_at"`
+	TraceID          string        `json:"trace_id"`
+	DependencyStatus string        `json:"dependency_status"`
+	Items            []RankedItem  `json:"items"`
+	Removed          []RemovedItem `json:"removed,omitempty"`
+	Page             *PageInfo     `json:"page,omitempty"`
+	// Experiment names the experiment and variant the decision was made under.
+	Experiment *ExperimentAssignment `json:"experiment,omitempty"`
+	// Exposure is the exposure snapshot a frequency-capped decision used.
+	Exposure *ExposureSnapshot `json:"exposure,omitempty"`
+	Stages   []StageTrace      `json:"stages"`
+	// Signature is added after hashing by the service that issued the
+	// decision; it is not part of the decision hash.
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+// Signature proves which service issued a decision. Value is the base64url
+// signature made with the key named by KeyID.
+type Signature struct {
+	KeyID string `json:"key_id"`
+	Alg   string `json:"alg"`
+	Value string `json:"value"`
 }
 
+// StageTrace records one stage of a decision. Evaluator names which policy
+// evaluator answered a policy_eval stage (local, remote or local_fallback);
+// like explain output it is operational detail and kept out of the hash.
 type StageTrace struct {
 	Stage      string `json:"stage"`
 	Outcome    string `json:"outcome"`
 	ErrMessage string `json:"err_message,omitempty"`
+	Evaluator  string `json:"evaluator,omitempty"`
 }
 
-// FeedbackEvent is intentionally minimal for scaffold stage.
+// FeedbackEvent records how a user reacted to one item of a decision.
+// Surface tags the event for per-surface analytics; OccurredAt defaults to
+// receipt time.
 type FeedbackEvent struct {
-	DecisionID string `json:"decision_id"`
-	ItemID     string `json:"item_id"`
-	EventType  string `json:"event_type"`
-	ActorID    string `json:"actor_id"`
+	DecisionID string    `json:"decision_id"`
+	ItemID     string    `json:"item_id"`
+	EventType  string    `json:"event_type"`
+	ActorID    string    `json:"actor_id"`
+	Surface    string    `json:"surface,omitempty"`
+	OccurredAt time.Time `json:"occurred_at,omitempty"`
+}
+
+var FeedbackEventTypes = []string{"impression", "click", "conversion"}
+
+func (e FeedbackEvent) Validate() error {
+	if strings.TrimSpace(e.DecisionID) == "" {
+		return fmt.Errorf("decision_id required")
+	}
+	if strings.TrimSpace(e.ItemID) == "" {
+		return fmt.Errorf("item_id required")
+	}
+	if strings.TrimSpace(e.ActorID) == "" {
+		return fmt.Errorf("actor_id required")
+	}
+	if !hasTag(FeedbackEventTypes, e.EventType) {
+		return fmt.Errorf("event_type must be one of %s", strings.Join(FeedbackEventTypes, ", "))
+	}
+	return nil
 }
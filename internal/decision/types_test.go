@@ -0,0 +1,20 @@
+package decision
+
+import "testing"
+
+func TestFeedbackEventValidate(t *testing.T) {
+	ok := FeedbackEvent{DecisionID: "dec_1", ItemID: "a", EventType: "click", ActorID: "u"}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	bad := ok
+	bad.EventType = "like"
+	if err := bad.Validate(); err == nil {
+		t.Fatalf("expected unsupported event_type error")
+	}
+	bad = ok
+	bad.ItemID = " "
+	if err := bad.Validate(); err == nil {
+		t.Fatalf("expected item_id required error")
+	}
+}
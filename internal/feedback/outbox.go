@@ -0,0 +1,197 @@
+package feedback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorse"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+// Outbox is the durable queue the worker drains. storage.Store implements it.
+type Outbox interface {
+	ClaimFeedbackOutbox(ctx context.Context, limit int, lease time.Duration) ([]storage.OutboxEntry, error)
+	MarkFeedbackDelivered(ctx context.Context, eventID string) error
+	MarkFeedbackRetry(ctx context.Context, eventID string, attempts int, next time.Time, lastError string) error
+	MarkFeedbackDead(ctx context.Context, eventID string, attempts int, lastError string) error
+}
+
+type Config struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	Lease        time.Duration
+}
+
+// Worker forwards queued feedback to Gorse. Failed batches are retried with
+// jittered exponential backoff; entries that exhaust MaxAttempts or hit a
+// non-retryable upstream error are dead-lettered. A batch rejected with a
+// non-retryable error is resent entry by entry so one bad row does not take
+// the rest with it.
+type Worker struct {
+	outbox Outbox
+	sink   gorse.FeedbackWriter
+	cfg    Config
+	now    func() time.Time
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+
+	deliveredTotal atomic.Int64
+	deadTotal      atomic.Int64
+}
+
+func NewWorker(outbox Outbox, sink gorse.FeedbackWriter, cfg Config) *Worker {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Minute
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 30 * time.Second
+	}
+	return &Worker{
+		outbox: outbox,
+		sink:   sink,
+		cfg:    cfg,
+		now:    time.Now,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (w *Worker) Start(ctx context.Context) {
+	t := time.NewTicker(w.cfg.PollInterval)
+	go func() {
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				// Keep draining while full batches come back so a backlog
+				// clears faster than one batch per tick.
+				for {
+					n, err := w.DrainOnce(ctx)
+					if err != nil || n < w.cfg.BatchSize || ctx.Err() != nil {
+						break
+					}
+				}
+			}
+		}
+	}()
+}
+
+// DrainOnce claims and delivers one batch. It returns the number of entries
+// claimed.
+func (w *Worker) DrainOnce(ctx context.Context) (int, error) {
+	entries, err := w.outbox.ClaimFeedbackOutbox(ctx, w.cfg.BatchSize, w.cfg.Lease)
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	batch := make([]gorse.Feedback, 0, len(entries))
+	sendable := make([]storage.OutboxEntry, 0, len(entries))
+	for _, e := range entries {
+		var fb gorse.Feedback
+		if err := json.Unmarshal(e.Payload, &fb); err != nil {
+			if err := w.outbox.MarkFeedbackDead(ctx, e.EventID, e.Attempts+1, "invalid_payload: "+err.Error()); err != nil {
+				return len(entries), err
+			}
+			w.deadTotal.Add(1)
+			continue
+		}
+		batch = append(batch, fb)
+		sendable = append(sendable, e)
+	}
+	if len(batch) == 0 {
+		return len(entries), nil
+	}
+
+	sendErr := w.sink.InsertFeedback(ctx, batch)
+	if sendErr != nil && len(batch) > 1 && !errors.Is(sendErr, gorse.ErrNotConfigured) && !gorse.Retryable(sendErr) {
+		// Gorse rejected the batch as a whole; resend entries one by one so
+		// only the ones it rejects on their own are dead-lettered.
+		for i, e := range sendable {
+			if err := w.settle(ctx, e, w.sink.InsertFeedback(ctx, batch[i:i+1])); err != nil {
+				return len(entries), err
+			}
+		}
+		return len(entries), nil
+	}
+	for _, e := range sendable {
+		if err := w.settle(ctx, e, sendErr); err != nil {
+			return len(entries), err
+		}
+	}
+	return len(entries), nil
+}
+
+// settle records the outcome of sending e. Entries sent while Gorse is not
+// configured stay pending without spending an attempt.
+func (w *Worker) settle(ctx context.Context, e storage.OutboxEntry, sendErr error) error {
+	if sendErr == nil {
+		if err := w.outbox.MarkFeedbackDelivered(ctx, e.EventID); err != nil {
+			return err
+		}
+		w.deliveredTotal.Add(1)
+		return nil
+	}
+	if errors.Is(sendErr, gorse.ErrNotConfigured) {
+		return w.outbox.MarkFeedbackRetry(ctx, e.EventID, e.Attempts, w.now().Add(w.cfg.MaxBackoff), sendErr.Error())
+	}
+	attempts := e.Attempts + 1
+	if !gorse.Retryable(sendErr) || attempts >= w.cfg.MaxAttempts {
+		if err := w.outbox.MarkFeedbackDead(ctx, e.EventID, attempts, sendErr.Error()); err != nil {
+			return err
+		}
+		w.deadTotal.Add(1)
+		return nil
+	}
+	next := w.now().Add(w.backoff(attempts))
+	return w.outbox.MarkFeedbackRetry(ctx, e.EventID, attempts, next, sendErr.Error())
+}
+
+// backoff returns base*2^(attempts-1) capped at MaxBackoff, jittered into
+// [d/2, d] so retries from one failed batch spread out.
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.cfg.BaseBackoff
+	for i := 1; i < attempts && d < w.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.cfg.MaxBackoff {
+		d = w.cfg.MaxBackoff
+	}
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	w.mu.Lock()
+	j := w.rnd.Int63n(half + 1)
+	w.mu.Unlock()
+	return time.Duration(half + j)
+}
+
+func (w *Worker) DeliveredTotal() int64 {
+	return w.deliveredTotal.Load()
+}
+
+func (w *Worker) DeadTotal() int64 {
+	return w.deadTotal.Load()
+}
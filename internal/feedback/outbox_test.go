@@ -0,0 +1,239 @@
+package feedback
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorse"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+type memOutbox struct {
+	mu      sync.Mutex
+	entries map[string]*memEntry
+}
+
+type memEntry struct {
+	storage.OutboxEntry
+	status  string
+	next    time.Time
+	lastErr string
+}
+
+func newMemOutbox(ids ...string) *memOutbox {
+	m := &memOutbox{entries: map[string]*memEntry{}}
+	for _, id := range ids {
+		payload, _ := json.Marshal(gorse.Feedback{FeedbackType: "click", UserID: "u1", ItemID: id, Timestamp: "2026-01-01T00:00:00Z"})
+		m.entries[id] = &memEntry{OutboxEntry: storage.OutboxEntry{EventID: id, TenantID: "t", Payload: payload}, status: "pending"}
+	}
+	return m
+}
+
+func (m *memOutbox) ClaimFeedbackOutbox(_ context.Context, limit int, _ time.Duration) ([]storage.OutboxEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []storage.OutboxEntry{}
+	for _, e := range m.entries {
+		if e.status == "pending" && len(out) < limit {
+			out = append(out, e.OutboxEntry)
+		}
+	}
+	return out, nil
+}
+
+func (m *memOutbox) MarkFeedbackDelivered(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[id].status = "delivered"
+	m.entries[id].Attempts++
+	return nil
+}
+
+func (m *memOutbox) MarkFeedbackRetry(_ context.Context, id string, attempts int, next time.Time, lastErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[id].Attempts = attempts
+	m.entries[id].next = next
+	m.entries[id].lastErr = lastErr
+	return nil
+}
+
+func (m *memOutbox) MarkFeedbackDead(_ context.Context, id string, attempts int, lastErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[id].status = "dead"
+	m.entries[id].Attempts = attempts
+	m.entries[id].lastErr = lastErr
+	return nil
+}
+
+func fakeGorse(t *testing.T, statuses ...int) (*httptest.Server, *[]gorse.Feedback) {
+	t.Helper()
+	var (
+		mu       sync.Mutex
+		calls    int
+		received []gorse.Feedback
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/feedback" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-API-Key") != "k" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		status := http.StatusOK
+		if calls < len(statuses) {
+			status = statuses[calls]
+		}
+		calls++
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		var batch []gorse.Feedback
+		_ = json.NewDecoder(r.Body).Decode(&batch)
+		received = append(received, batch...)
+		_ = json.NewEncoder(w).Encode(map[string]any{"RowAffected": len(batch)})
+	}))
+	t.Cleanup(server.Close)
+	return server, &received
+}
+
+func TestWorkerDeliversToGorse(t *testing.T) {
+	server, received := fakeGorse(t)
+	outbox := newMemOutbox("e1", "e2")
+	w := NewWorker(outbox, gorse.NewHTTPClient(server.URL, "k"), Config{})
+
+	n, err := w.DrainOnce(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 claimed without error, got n=%d err=%v", n, err)
+	}
+	if len(*received) != 2 {
+		t.Fatalf("expected 2 feedback rows at gorse, got %d", len(*received))
+	}
+	for id, e := range outbox.entries {
+		if e.status != "delivered" {
+			t.Fatalf("expected %s delivered, got %s", id, e.status)
+		}
+	}
+	if w.DeliveredTotal() != 2 {
+		t.Fatalf("expected delivered total 2, got %d", w.DeliveredTotal())
+	}
+}
+
+func TestWorkerRetriesThenDeadLetters(t *testing.T) {
+	server, received := fakeGorse(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	outbox := newMemOutbox("e1")
+	w := NewWorker(outbox, gorse.NewHTTPClient(server.URL, "k"), Config{MaxAttempts: 3, BaseBackoff: time.Second, MaxBackoff: 4 * time.Second})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	if _, err := w.DrainOnce(context.Background()); err != nil {
+		t.Fatalf("drain error: %v", err)
+	}
+	e := outbox.entries["e1"]
+	if e.status != "pending" || e.Attempts != 1 || e.lastErr != "gorse_status_503" {
+		t.Fatalf("expected pending retry after first failure, got %#v", e)
+	}
+	if delay := e.next.Sub(now); delay < 500*time.Millisecond || delay > time.Second {
+		t.Fatalf("expected jittered backoff within [0.5s,1s], got %s", delay)
+	}
+
+	_, _ = w.DrainOnce(context.Background())
+	_, _ = w.DrainOnce(context.Background())
+	if e.status != "dead" || e.Attempts != 3 {
+		t.Fatalf("expected dead-lettered after 3 attempts, got %#v", e)
+	}
+	if len(*received) != 0 {
+		t.Fatalf("expected nothing accepted upstream, got %d", len(*received))
+	}
+	if w.DeadTotal() != 1 {
+		t.Fatalf("expected dead total 1, got %d", w.DeadTotal())
+	}
+}
+
+func TestWorkerRecoversAfterOutage(t *testing.T) {
+	server, received := fakeGorse(t, http.StatusBadGateway)
+	outbox := newMemOutbox("e1")
+	w := NewWorker(outbox, gorse.NewHTTPClient(server.URL, "k"), Config{})
+
+	_, _ = w.DrainOnce(context.Background())
+	_, _ = w.DrainOnce(context.Background())
+	if outbox.entries["e1"].status != "delivered" || len(*received) != 1 {
+		t.Fatalf("expected delivery after outage, got %#v received=%d", outbox.entries["e1"], len(*received))
+	}
+}
+
+func TestWorkerDeadLettersNonRetryable(t *testing.T) {
+	server, _ := fakeGorse(t, http.StatusBadRequest)
+	outbox := newMemOutbox("e1")
+	w := NewWorker(outbox, gorse.NewHTTPClient(server.URL, "k"), Config{MaxAttempts: 10})
+
+	_, _ = w.DrainOnce(context.Background())
+	if e := outbox.entries["e1"]; e.status != "dead" || e.Attempts != 1 {
+		t.Fatalf("expected immediate dead letter on 400, got %#v", e)
+	}
+}
+
+// rejectingSink fails any batch containing a rejected item with a 400.
+type rejectingSink struct {
+	reject   string
+	accepted []gorse.Feedback
+}
+
+func (s *rejectingSink) InsertFeedback(_ context.Context, batch []gorse.Feedback) error {
+	for _, fb := range batch {
+		if fb.ItemID == s.reject {
+			return &gorse.StatusError{Code: http.StatusBadRequest}
+		}
+	}
+	s.accepted = append(s.accepted, batch...)
+	return nil
+}
+
+func TestWorkerDeadLettersOnlyRejectedEntry(t *testing.T) {
+	sink := &rejectingSink{reject: "e2"}
+	outbox := newMemOutbox("e1", "e2", "e3")
+	w := NewWorker(outbox, sink, Config{})
+
+	_, _ = w.DrainOnce(context.Background())
+	for id, want := range map[string]string{"e1": "delivered", "e2": "dead", "e3": "delivered"} {
+		if got := outbox.entries[id].status; got != want {
+			t.Fatalf("expected %s %s, got %s", id, want, got)
+		}
+	}
+	if len(sink.accepted) != 2 || w.DeliveredTotal() != 2 || w.DeadTotal() != 1 {
+		t.Fatalf("expected 2 accepted and 1 dead, got accepted=%d delivered=%d dead=%d", len(sink.accepted), w.DeliveredTotal(), w.DeadTotal())
+	}
+}
+
+func TestWorkerLeavesPendingWithoutGorse(t *testing.T) {
+	outbox := newMemOutbox("e1")
+	w := NewWorker(outbox, gorse.NewHTTPClient("", ""), Config{MaxAttempts: 1})
+
+	_, _ = w.DrainOnce(context.Background())
+	if e := outbox.entries["e1"]; e.status != "pending" || e.Attempts != 0 || e.lastErr != "gorse_not_configured" {
+		t.Fatalf("expected entry left pending without spending an attempt, got %#v", e)
+	}
+	if w.DeliveredTotal() != 0 {
+		t.Fatalf("expected nothing counted as delivered, got %d", w.DeliveredTotal())
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	w := NewWorker(newMemOutbox(), gorse.NoopClient{}, Config{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second})
+	for attempts := 1; attempts < 20; attempts++ {
+		if d := w.backoff(attempts); d > 10*time.Second {
+			t.Fatalf("backoff exceeded cap at attempt %d: %s", attempts, d)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	httpstd "net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+const maxCatalogBulk = 1000
+
+type catalogItemRequest struct {
+	ItemID    string   `json:"item_id"`
+	BaseScore float64  `json:"base_score"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+type bulkCatalogRequest struct {
+	Items []catalogItemRequest `json:"items"`
+}
+
+type catalogTagRequest struct {
+	Parent      string `json:"parent,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (s *Server) handleGetCatalog(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	rev, err := s.store.CatalogRevision(r.Context(), claims.TenantID)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "catalog_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, s.catalogVersionView(claims.TenantID, rev, nil))
+}
+
+func (s *Server) handleListCatalogItems(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	rev, ok := s.catalogRevisionParam(w, r, claims.TenantID)
+	if !ok {
+		return
+	}
+	limit := 100
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 500 {
+			writeError(w, httpstd.StatusBadRequest, "invalid_limit", map[string]any{"max": 500})
+			return
+		}
+		limit = n
+	}
+	after := strings.TrimSpace(r.URL.Query().Get("after"))
+	segment := strings.TrimSpace(r.URL.Query().Get("segment"))
+
+	items, err := s.store.CatalogItems(r.Context(), claims.TenantID, rev)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "catalog_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	var members map[string]struct{}
+	if segment != "" {
+		tags, err := s.store.CatalogTags(r.Context(), claims.TenantID, rev)
+		if err != nil {
+			writeError(w, httpstd.StatusInternalServerError, "catalog_read_failed", map[string]any{"details": err.Error()})
+			return
+		}
+		members = storage.SegmentTags(tags, segment)
+	}
+
+	page := make([]storage.CatalogItem, 0, limit)
+	next := ""
+	for _, it := range items {
+		if it.ItemID <= after || (members != nil && !anyTagIn(it.Tags, members)) {
+			continue
+		}
+		if len(page) == limit {
+			next = page[len(page)-1].ItemID
+			break
+		}
+		page = append(page, it)
+	}
+	view := s.catalogVersionView(claims.TenantID, rev, nil)
+	view["items"] = page
+	if next != "" {
+		view["next_after"] = next
+	}
+	writeJSONValue(w, httpstd.StatusOK, view)
+}
+
+func (s *Server) handleGetCatalogItem(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	rev, ok := s.catalogRevisionParam(w, r, claims.TenantID)
+	if !ok {
+		return
+	}
+	itemID := r.PathValue("id")
+	items, err := s.store.CatalogItems(r.Context(), claims.TenantID, rev)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "catalog_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	i := sort.Search(len(items), func(i int) bool { return items[i].ItemID >= itemID })
+	if i == len(items) || items[i].ItemID != itemID {
+		writeError(w, httpstd.StatusNotFound, "catalog_item_not_found", nil)
+		return
+	}
+	view := s.catalogVersionView(claims.TenantID, rev, nil)
+	view["item"] = items[i]
+	writeJSONValue(w, httpstd.StatusOK, view)
+}
+
+func (s *Server) handlePutCatalogItem(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	var req catalogItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	req.ItemID = r.PathValue("id")
+	item, err := normalizeCatalogItem(req)
+	if err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_catalog_item", map[string]any{"details": err.Error()})
+		return
+	}
+	s.writeCatalogItems(w, r, claims.TenantID, idemKey, []storage.CatalogItem{item})
+}
+
+func (s *Server) handleBulkCatalogItems(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	var req bulkCatalogRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	if len(req.Items) == 0 {
+		writeError(w, httpstd.StatusBadRequest, "items_required", nil)
+		return
+	}
+	if len(req.Items) > maxCatalogBulk {
+		writeError(w, httpstd.StatusBadRequest, "batch_too_large", map[string]any{"max": maxCatalogBulk})
+		return
+	}
+	items := make([]storage.CatalogItem, 0, len(req.Items))
+	for i, raw := range req.Items {
+		item, err := normalizeCatalogItem(raw)
+		if err != nil {
+			writeError(w, httpstd.StatusBadRequest, "invalid_catalog_item", map[string]any{"index": i, "details": err.Error()})
+			return
+		}
+		items = append(items, item)
+	}
+	s.writeCatalogItems(w, r, claims.TenantID, idemKey, items)
+}
+
+func (s *Server) writeCatalogItems(w httpstd.ResponseWriter, r *httpstd.Request, tenantID, idemKey string, items []storage.CatalogItem) {
+	s.withIdempotency(r.Context(), w, tenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		rev, changed, err := s.store.UpsertCatalogItems(r.Context(), tenantID, items)
+		if err != nil {
+			return 0, nil, err
+		}
+		return httpstd.StatusOK, mustJSON(s.catalogVersionView(tenantID, rev, map[string]any{"changed": changed})), nil
+	})
+}
+
+func (s *Server) handleDeleteCatalogItem(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	itemID := r.PathValue("id")
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		rev, found, err := s.store.DeleteCatalogItem(r.Context(), claims.TenantID, itemID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !found {
+			return httpstd.StatusNotFound, mustJSON(map[string]any{"error": "catalog_item_not_found"}), nil
+		}
+		return httpstd.StatusOK, mustJSON(s.catalogVersionView(claims.TenantID, rev, map[string]any{"deleted": itemID})), nil
+	})
+}
+
+func (s *Server) handleListCatalogTags(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	rev, ok := s.catalogRevisionParam(w, r, claims.TenantID)
+	if !ok {
+		return
+	}
+	tags, err := s.store.CatalogTags(r.Context(), claims.TenantID, rev)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "catalog_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	view := s.catalogVersionView(claims.TenantID, rev, nil)
+	view["tags"] = tags
+	writeJSONValue(w, httpstd.StatusOK, view)
+}
+
+func (s *Server) handlePutCatalogTag(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	var req catalogTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	tag := storage.CatalogTag{
+		Tag:         strings.TrimSpace(r.PathValue("tag")),
+		Parent:      strings.TrimSpace(req.Parent),
+		Description: strings.TrimSpace(req.Description),
+	}
+	if tag.Tag == "" || tag.Tag == tag.Parent {
+		writeError(w, httpstd.StatusBadRequest, "invalid_catalog_tag", nil)
+		return
+	}
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		rev, changed, err := s.store.UpsertCatalogTag(r.Context(), claims.TenantID, tag)
+		if errors.Is(err, storage.ErrCatalogTagCycle) {
+			return httpstd.StatusConflict, mustJSON(map[string]any{"error": "catalog_tag_cycle"}), nil
+		}
+		if errors.Is(err, storage.ErrCatalogParentAbsent) {
+			return httpstd.StatusUnprocessableEntity, mustJSON(map[string]any{"error": "catalog_parent_not_found", "parent": tag.Parent}), nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		return httpstd.StatusOK, mustJSON(s.catalogVersionView(claims.TenantID, rev, map[string]any{"changed": changed})), nil
+	})
+}
+
+func (s *Server) handleDeleteCatalogTag(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	tag := r.PathValue("tag")
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		rev, found, err := s.store.DeleteCatalogTag(r.Context(), claims.TenantID, tag)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !found {
+			return httpstd.StatusNotFound, mustJSON(map[string]any{"error": "catalog_tag_not_found"}), nil
+		}
+		return httpstd.StatusOK, mustJSON(s.catalogVersionView(claims.TenantID, rev, map[string]any{"deleted": tag})), nil
+	})
+}
+
+// catalogRevisionParam reads the optional `revision` query parameter,
+// defaulting to the tenant's current revision.
+func (s *Server) catalogRevisionParam(w httpstd.ResponseWriter, r *httpstd.Request, tenantID string) (int64, bool) {
+	current, err := s.store.CatalogRevision(r.Context(), tenantID)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "catalog_read_failed", map[string]any{"details": err.Error()})
+		return 0, false
+	}
+	raw := strings.TrimSpace(r.URL.Query().Get("revision"))
+	if raw == "" {
+		return current, true
+	}
+	rev, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || rev < 0 || rev > current {
+		writeError(w, httpstd.StatusBadRequest, "invalid_revision", map[string]any{"current": current})
+		return 0, false
+	}
+	return rev, true
+}
+
+func (s *Server) catalogVersionView(tenantID string, rev int64, extra map[string]any) map[string]any {
+	view := map[string]any{
+		"tenant_id":    tenantID,
+		"revision":     rev,
+		"data_version": decision.CatalogDataVersion(s.cfg.DataVersion, rev),
+	}
+	for k, v := range extra {
+		view[k] = v
+	}
+	return view
+}
+
+func normalizeCatalogItem(req catalogItemRequest) (storage.CatalogItem, error) {
+	item := storage.CatalogItem{ItemID: strings.TrimSpace(req.ItemID), BaseScore: req.BaseScore}
+	if item.ItemID == "" {
+		return storage.CatalogItem{}, errors.New("item_id required")
+	}
+	seen := map[string]struct{}{}
+	for _, t := range req.Tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			return storage.CatalogItem{}, errors.New("tags must be non-empty")
+		}
+		if _, dup := seen[t]; dup {
+			continue
+		}
+		seen[t] = struct{}{}
+		item.Tags = append(item.Tags, t)
+	}
+	sort.Strings(item.Tags)
+	return item, nil
+}
+
+func anyTagIn(tags []string, set map[string]struct{}) bool {
+	for _, t := range tags {
+		if _, ok := set[t]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,472 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	httpstd "net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+	"github.com/restarone/violet-deterministic-api/internal/signing"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+var errRecomputeInputsMissing = errors.New("decision was stored without canonical request and inputs")
+
+const (
+	defaultDecisionListWindow = 30 * 24 * time.Hour
+	maxDecisionListLimit      = 200
+)
+
+func (s *Server) handleDecisions(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	var req decision.DecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	if req.TenantID == "" {
+		req.TenantID = claims.TenantID
+	}
+	if req.TenantID != claims.TenantID {
+		writeError(w, httpstd.StatusForbidden, "tenant_mismatch", nil)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_decision_request", map[string]any{"details": err.Error()})
+		return
+	}
+
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		resp, inputs := s.engine.DecideRecorded(r.Context(), req)
+		payload, err := s.saveDecision(r.Context(), req, resp, inputs)
+		if err != nil {
+			return 0, nil, err
+		}
+		return httpstd.StatusOK, payload, nil
+	})
+}
+
+// saveDecision signs the response when signing keys are configured, persists
+// its bytes together with the canonical request and retrieval inputs, and
+// returns the stored response bytes.
+func (s *Server) saveDecision(ctx context.Context, req decision.DecisionRequest, resp decision.DecisionResponse, inputs decision.DecisionInputs) ([]byte, error) {
+	if s.signer != nil {
+		s.signer.SignDecision(&resp)
+	}
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := json.Marshal(decision.CanonicalRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	rawInputs, err := json.Marshal(inputs)
+	if err != nil {
+		return nil, err
+	}
+	itemIDs := make([]string, 0, len(resp.Items))
+	for _, item := range resp.Items {
+		itemIDs = append(itemIDs, item.ItemID)
+	}
+	rec := storage.DecisionRecord{
+		DecisionID:       resp.DecisionID,
+		TenantID:         req.TenantID,
+		DecisionHash:     resp.DecisionHash,
+		PolicyVersion:    resp.PolicyVersion,
+		DataVersion:      resp.DataVersion,
+		GeneratedAt:      resp.GeneratedAt,
+		Payload:          payload,
+		Request:          canonical,
+		Inputs:           rawInputs,
+		Surface:          req.Surface,
+		UserID:           req.UserID,
+		DependencyStatus: resp.DependencyStatus,
+		ItemIDs:          itemIDs,
+	}
+	if resp.Experiment != nil {
+		rec.ExperimentID = resp.Experiment.ExperimentID
+		rec.Variant = resp.Experiment.Variant
+	}
+	if err := s.store.SaveDecision(ctx, rec); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// handleListDecisions lists stored decisions newest first. Pages are keyed on
+// (generated_at, decision_id): pass the returned next_cursor as `cursor` with
+// the same filters to continue.
+func (s *Server) handleListDecisions(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := parseTimeWindow(r, defaultDecisionListWindow)
+	if err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_time_window", map[string]any{"details": err.Error()})
+		return
+	}
+	q := r.URL.Query()
+	limit := 50
+	if raw := strings.TrimSpace(q.Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxDecisionListLimit {
+			writeError(w, httpstd.StatusBadRequest, "invalid_limit", map[string]any{"max": maxDecisionListLimit})
+			return
+		}
+		limit = n
+	}
+	filter := storage.DecisionFilter{
+		From:             from,
+		To:               to,
+		Surface:          strings.TrimSpace(q.Get("surface")),
+		UserID:           strings.TrimSpace(q.Get("user_id")),
+		PolicyVersion:    strings.TrimSpace(q.Get("policy_version")),
+		DataVersion:      strings.TrimSpace(q.Get("data_version")),
+		DependencyStatus: strings.TrimSpace(q.Get("dependency_status")),
+		ItemID:           strings.TrimSpace(q.Get("item_id")),
+	}
+	if filter.DependencyStatus != "" && filter.DependencyStatus != "ok" && filter.DependencyStatus != "degraded" {
+		writeError(w, httpstd.StatusBadRequest, "invalid_dependency_status", map[string]any{"supported": []string{"ok", "degraded"}})
+		return
+	}
+	if raw := strings.TrimSpace(q.Get("cursor")); raw != "" {
+		at, id, err := decodeDecisionCursor(raw)
+		if err != nil {
+			writeError(w, httpstd.StatusBadRequest, "invalid_cursor", nil)
+			return
+		}
+		filter.AfterGeneratedAt, filter.AfterID = at, id
+	}
+
+	rows, err := s.store.ListDecisions(r.Context(), claims.TenantID, filter, limit+1)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "decision_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	view := map[string]any{
+		"tenant_id": claims.TenantID,
+		"from":      from,
+		"to":        to,
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		view["next_cursor"] = encodeDecisionCursor(last.GeneratedAt, last.DecisionID)
+	}
+	view["decisions"] = rows
+	writeJSONValue(w, httpstd.StatusOK, view)
+}
+
+func encodeDecisionCursor(at time.Time, decisionID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(at.UTC().Format(time.RFC3339Nano) + "|" + decisionID))
+}
+
+func decodeDecisionCursor(raw string) (time.Time, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	ts, id, ok := strings.Cut(string(b), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", fmt.Errorf("malformed cursor")
+	}
+	at, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return at, id, nil
+}
+
+type replayRequest struct {
+	DecisionID string `json:"decision_id"`
+	Mode       string `json:"mode,omitempty"`
+}
+
+func (s *Server) handleReplay(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+
+	var body replayRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.DecisionID == "" {
+		writeError(w, httpstd.StatusBadRequest, "invalid_request", nil)
+		return
+	}
+	mode := strings.TrimSpace(body.Mode)
+	if mode == "" {
+		mode = "stored"
+	}
+	if mode != "stored" && mode != "recompute" {
+		writeError(w, httpstd.StatusBadRequest, "invalid_mode", map[string]any{"supported": []string{"stored", "recompute"}})
+		return
+	}
+
+	if mode == "stored" {
+		payload, found, err := s.store.GetDecisionPayload(r.Context(), body.DecisionID, claims.TenantID)
+		if err != nil {
+			writeError(w, httpstd.StatusInternalServerError, "replay_read_failed", map[string]any{"details": err.Error()})
+			return
+		}
+		if !found {
+			writeError(w, httpstd.StatusNotFound, "decision_not_found", nil)
+			return
+		}
+		writeJSON(w, httpstd.StatusOK, payload)
+		return
+	}
+
+	rec, found, err := s.store.GetDecisionRecord(r.Context(), body.DecisionID, claims.TenantID)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "replay_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	if !found {
+		writeError(w, httpstd.StatusNotFound, "decision_not_found", nil)
+		return
+	}
+	original, recomputed, err := s.recomputeDecision(r.Context(), rec)
+	if err != nil {
+		writeError(w, httpstd.StatusConflict, "recompute_unavailable", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"decision_id": rec.DecisionID,
+		"mode":        mode,
+		"original":    original,
+		"recomputed":  recomputed,
+		"diff":        decision.CompareDecisions(original, recomputed),
+	})
+}
+
+// recomputeDecision re-runs the engine on a stored decision's canonical
+// request and retrieval inputs, pinned to the versions it was made under.
+func (s *Server) recomputeDecision(ctx context.Context, rec storage.DecisionRecord) (decision.DecisionResponse, decision.DecisionResponse, error) {
+	var original decision.DecisionResponse
+	if err := json.Unmarshal(rec.Payload, &original); err != nil {
+		return decision.DecisionResponse{}, decision.DecisionResponse{}, err
+	}
+	if len(rec.Request) == 0 || len(rec.Inputs) == 0 {
+		return decision.DecisionResponse{}, decision.DecisionResponse{}, errRecomputeInputsMissing
+	}
+	var req decision.DecisionRequest
+	if err := json.Unmarshal(rec.Request, &req); err != nil {
+		return decision.DecisionResponse{}, decision.DecisionResponse{}, err
+	}
+	var inputs decision.DecisionInputs
+	if err := json.Unmarshal(rec.Inputs, &inputs); err != nil {
+		return decision.DecisionResponse{}, decision.DecisionResponse{}, err
+	}
+	recomputed := s.engine.WithVersions(rec.PolicyVersion, rec.DataVersion).Recompute(ctx, req, inputs)
+	// The original signature covers the hash, versions and output digest.
+	// The hash alone does not pin item scores or order, so the signature is
+	// only carried over when the recomputation reproduced both.
+	if recomputed.DecisionHash == original.DecisionHash && signing.OutputDigest(recomputed) == signing.OutputDigest(original) {
+		recomputed.Signature = original.Signature
+	}
+	return original, recomputed, nil
+}
+
+type simulateDecisionRequest struct {
+	Request       decision.DecisionRequest `json:"request"`
+	PolicyVersion string                   `json:"policy_version,omitempty"`
+	DataVersion   string                   `json:"data_version,omitempty"`
+	RuleSet       *decision.RuleSet        `json:"rule_set,omitempty"`
+}
+
+// handleSimulateDecision runs a what-if decision under overridden versions or
+// rules. Both the current and simulated engines score the same Gorse
+// retrieval so the diff isolates the policy change, except that an
+// overridden data_version scores the Gorse snapshot pinned under it when one
+// exists; "retrieval" reports which was used. The simulated run ignores
+// experiments; unless overridden it uses the policy version the current
+// decision was made under. Nothing is persisted, snapshots included.
+func (s *Server) handleSimulateDecision(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+
+	var req simulateDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	if req.Request.TenantID == "" {
+		req.Request.TenantID = claims.TenantID
+	}
+	if req.Request.TenantID != claims.TenantID {
+		writeError(w, httpstd.StatusForbidden, "tenant_mismatch", nil)
+		return
+	}
+	if err := req.Request.Validate(); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_decision_request", map[string]any{"details": err.Error()})
+		return
+	}
+	if req.RuleSet != nil {
+		if err := validateRuleSet(s.engine, *req.RuleSet); err != nil {
+			writeError(w, httpstd.StatusBadRequest, "invalid_rule_set", map[string]any{"details": err.Error()})
+			return
+		}
+	}
+
+	current, inputs := s.engine.ReadOnly().DecideRecorded(r.Context(), req.Request)
+	inputs.Experiment = nil
+	inputs.ExperimentStage = nil
+
+	policyVersion := strings.TrimSpace(req.PolicyVersion)
+	if policyVersion == "" && req.RuleSet != nil {
+		policyVersion = req.RuleSet.PolicyVersion
+	}
+	if policyVersion == "" {
+		policyVersion = current.PolicyVersion
+	}
+	dataVersion := strings.TrimSpace(req.DataVersion)
+	if dataVersion == "" {
+		dataVersion = s.engine.DataVersion
+	}
+
+	simEngine := s.engine.ReadOnly().WithoutExperiments().WithVersions(policyVersion, dataVersion)
+	if req.RuleSet != nil {
+		simEngine = simEngine.WithRuleSet(*req.RuleSet)
+	}
+	retrieval := map[string]any{"data_version": current.DataVersion, "source": "current"}
+	if dataVersion != s.engine.DataVersion {
+		ids, found, err := simEngine.PinnedRetrieval(r.Context(), req.Request)
+		switch {
+		case err != nil:
+			retrieval["note"] = "snapshot read failed, scored the current retrieval: " + err.Error()
+		case found:
+			inputs.GorseIDs = ids
+			inputs.GorseStage = decision.StageTrace{Stage: "gorse_recommend", Outcome: "ok"}
+			inputs.FallbackStages = nil
+			retrieval = map[string]any{"data_version": dataVersion, "source": "snapshot"}
+		default:
+			retrieval["note"] = "no Gorse snapshot for data_version " + dataVersion + ", scored the current retrieval"
+		}
+	}
+	simulated := simEngine.Recompute(r.Context(), req.Request, inputs)
+
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"simulated": simulated,
+		"current":   current,
+		"diff":      decision.CompareDecisions(current, simulated),
+		"retrieval": retrieval,
+		"persisted": false,
+	})
+}
+
+const maxDecisionBatch = 500
+
+type batchDecisionRequest struct {
+	Requests []decision.DecisionRequest `json:"requests"`
+}
+
+type batchDecisionResult struct {
+	Index    int             `json:"index"`
+	Status   string          `json:"status"`
+	Decision json.RawMessage `json:"decision,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Details  string          `json:"details,omitempty"`
+}
+
+// handleBatchDecisions evaluates many decision requests under one
+// Idempotency-Key. Entries run concurrently up to DecisionBatchConcurrency,
+// each decision is stored individually, and results keep input order.
+func (s *Server) handleBatchDecisions(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	var req batchDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	if len(req.Requests) == 0 {
+		writeError(w, httpstd.StatusBadRequest, "requests_required", nil)
+		return
+	}
+	if len(req.Requests) > maxDecisionBatch {
+		writeError(w, httpstd.StatusBadRequest, "batch_too_large", map[string]any{"max": maxDecisionBatch})
+		return
+	}
+
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		results := make([]batchDecisionResult, len(req.Requests))
+		workers := s.cfg.DecisionBatchConcurrency
+		if workers < 1 {
+			workers = 1
+		}
+		sem := make(chan struct{}, workers)
+		var wg sync.WaitGroup
+		for i := range req.Requests {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i] = s.decideBatchEntry(r.Context(), claims.TenantID, i, req.Requests[i])
+			}(i)
+		}
+		wg.Wait()
+
+		failed := 0
+		for _, res := range results {
+			if res.Status != "ok" {
+				failed++
+			}
+		}
+		payload, err := json.Marshal(map[string]any{
+			"tenant_id": claims.TenantID,
+			"total":     len(results),
+			"succeeded": len(results) - failed,
+			"failed":    failed,
+			"results":   results,
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+		return httpstd.StatusOK, payload, nil
+	})
+}
+
+func (s *Server) decideBatchEntry(ctx context.Context, tenantID string, index int, req decision.DecisionRequest) batchDecisionResult {
+	if req.TenantID == "" {
+		req.TenantID = tenantID
+	}
+	if req.TenantID != tenantID {
+		return batchDecisionResult{Index: index, Status: "error", Error: "tenant_mismatch"}
+	}
+	if err := req.Validate(); err != nil {
+		return batchDecisionResult{Index: index, Status: "error", Error: "invalid_decision_request", Details: err.Error()}
+	}
+	resp, inputs := s.engine.DecideRecorded(ctx, req)
+	payload, err := s.saveDecision(ctx, req, resp, inputs)
+	if err != nil {
+		return batchDecisionResult{Index: index, Status: "error", Error: "decision_write_failed", Details: err.Error()}
+	}
+	return batchDecisionResult{Index: index, Status: "ok", Decision: payload}
+}
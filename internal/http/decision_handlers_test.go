@@ -0,0 +1,293 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	httpstd "net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+// memSnapshots records Gorse snapshot writes so read-only paths can be
+// checked without Postgres.
+type memSnapshots struct {
+	docs map[string][]byte
+}
+
+func (m *memSnapshots) GetGorseSnapshot(_ context.Context, tenantID, userID, dataVersion string) ([]byte, bool, error) {
+	raw, ok := m.docs[tenantID+"|"+userID+"|"+dataVersion]
+	return raw, ok, nil
+}
+
+func (m *memSnapshots) PutGorseSnapshot(_ context.Context, tenantID, userID, dataVersion string, payload []byte) ([]byte, error) {
+	m.docs[tenantID+"|"+userID+"|"+dataVersion] = payload
+	return payload, nil
+}
+
+func (m *memSnapshots) ReplaceGorseSnapshot(_ context.Context, tenantID, userID, dataVersion string, _, payload []byte) ([]byte, error) {
+	m.docs[tenantID+"|"+userID+"|"+dataVersion] = payload
+	return payload, nil
+}
+
+func testDecisionRequest() decision.DecisionRequest {
+	return decision.DecisionRequest{
+		UserID:  "u1",
+		Surface: "home",
+		CandidateItems: []decision.CandidateItem{
+			{ItemID: "a", BaseScore: 1},
+			{ItemID: "b", BaseScore: 1},
+		},
+	}
+}
+
+func TestBatchDecisionsRejectsBeforeStoring(t *testing.T) {
+	s := newTestServer(t, "t1", nil)
+	idem := map[string]string{"Idempotency-Key": "batch-1"}
+	oversized := make([]decision.DecisionRequest, maxDecisionBatch+1)
+	for i := range oversized {
+		oversized[i] = testDecisionRequest()
+	}
+	cases := []struct {
+		name    string
+		body    any
+		headers map[string]string
+		want    string
+	}{
+		{"missing idempotency key", batchDecisionRequest{Requests: oversized[:1]}, nil, "missing_idempotency_key"},
+		{"malformed body", "{", idem, "invalid_json"},
+		{"empty batch", batchDecisionRequest{}, idem, "requests_required"},
+		{"over the limit", batchDecisionRequest{Requests: oversized}, idem, "batch_too_large"},
+	}
+	for _, tc := range cases {
+		code, out := serve(t, s.handleBatchDecisions, httpstd.MethodPost, "/v1/decisions:batch", tc.body, tc.headers)
+		if code != httpstd.StatusBadRequest || out["error"] != tc.want {
+			t.Fatalf("%s: got %d %v, want 400 %s", tc.name, code, out, tc.want)
+		}
+	}
+	if _, out := serve(t, s.handleBatchDecisions, httpstd.MethodPost, "/v1/decisions:batch", batchDecisionRequest{Requests: oversized}, idem); out["max"] != float64(maxDecisionBatch) {
+		t.Fatalf("expected the limit reported, got %v", out["max"])
+	}
+}
+
+func TestBatchDecisionsReportsPerItemErrors(t *testing.T) {
+	s, tenant := newStoreServer(t, newTestRetrieval(t, &toggleGorse{}))
+	mismatched := testDecisionRequest()
+	mismatched.TenantID = tenant + "_other"
+	invalid := testDecisionRequest()
+	invalid.Catalog = &decision.CatalogSelector{ItemIDs: []string{"a"}}
+	body := batchDecisionRequest{Requests: []decision.DecisionRequest{testDecisionRequest(), mismatched, invalid, testDecisionRequest()}}
+
+	code, out := serve(t, s.handleBatchDecisions, httpstd.MethodPost, "/v1/decisions:batch", body, map[string]string{"Idempotency-Key": "batch-mixed"})
+	if code != httpstd.StatusOK || out["total"] != float64(4) || out["succeeded"] != float64(2) || out["failed"] != float64(2) {
+		t.Fatalf("unexpected batch summary %d %v", code, out)
+	}
+	results := out["results"].([]any)
+	wantErrors := []string{"", "tenant_mismatch", "invalid_decision_request", ""}
+	for i, raw := range results {
+		res := raw.(map[string]any)
+		if res["index"] != float64(i) {
+			t.Fatalf("expected results in input order, got index %v at %d", res["index"], i)
+		}
+		if want := wantErrors[i]; want == "" {
+			if res["status"] != "ok" || res["decision"] == nil {
+				t.Fatalf("entry %d: expected a stored decision, got %v", i, res)
+			}
+		} else if res["status"] != "error" || res["error"] != want {
+			t.Fatalf("entry %d: expected %s, got %v", i, want, res)
+		}
+	}
+
+	// The same key replays the stored batch instead of deciding again.
+	_, again := serve(t, s.handleBatchDecisions, httpstd.MethodPost, "/v1/decisions:batch", body, map[string]string{"Idempotency-Key": "batch-mixed"})
+	if !reflect.DeepEqual(again, out) {
+		t.Fatalf("expected the idempotent replay to match")
+	}
+}
+
+func TestListDecisionsValidatesQuery(t *testing.T) {
+	s := newTestServer(t, "t1", nil)
+	cases := map[string]string{
+		"/v1/decisions?limit=0":                                                     "invalid_limit",
+		"/v1/decisions?limit=201":                                                   "invalid_limit",
+		"/v1/decisions?limit=ten":                                                   "invalid_limit",
+		"/v1/decisions?dependency_status=broken":                                    "invalid_dependency_status",
+		"/v1/decisions?from=2026-03-02T00:00:00Z&to=2026-03-01T00:00:00Z":           "invalid_time_window",
+		"/v1/decisions?cursor=%25%25":                                               "invalid_cursor",
+		"/v1/decisions?cursor=" + base64.RawURLEncoding.EncodeToString([]byte("x")): "invalid_cursor",
+		"/v1/decisions?cursor=" + base64.RawURLEncoding.EncodeToString([]byte("not-a-time|dec_1")):      "invalid_cursor",
+		"/v1/decisions?cursor=" + base64.RawURLEncoding.EncodeToString([]byte("2026-03-01T10:00:00Z|")): "invalid_cursor",
+	}
+	for target, want := range cases {
+		code, out := serve(t, s.handleListDecisions, httpstd.MethodGet, target, nil, nil)
+		if code != httpstd.StatusBadRequest || out["error"] != want {
+			t.Fatalf("%s: got %d %v, want 400 %s", target, code, out, want)
+		}
+	}
+}
+
+func TestDecisionCursorRoundTrip(t *testing.T) {
+	want := time.Date(2026, 3, 1, 10, 0, 0, 123456789, time.UTC)
+	at, id, err := decodeDecisionCursor(encodeDecisionCursor(want, "dec_abc"))
+	if err != nil || id != "dec_abc" || !at.Equal(want) {
+		t.Fatalf("cursor round trip = %v %q %v", at, id, err)
+	}
+}
+
+func TestListDecisionsPagesAndFilters(t *testing.T) {
+	s, tenant := newStoreServer(t, nil)
+	ctx := context.Background()
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, rec := range []storage.DecisionRecord{
+		{DecisionID: "dec_a", GeneratedAt: at, ItemIDs: []string{"x", "y"}},
+		{DecisionID: "dec_b", GeneratedAt: at, ItemIDs: []string{"y"}},
+		{DecisionID: "dec_c", GeneratedAt: at.Add(-time.Minute), ItemIDs: []string{"x"}},
+	} {
+		rec.DecisionID = tenant + "_" + rec.DecisionID
+		rec.TenantID = tenant
+		rec.Surface = "home"
+		rec.PolicyVersion, rec.DataVersion = "policy-v1", "data-v1"
+		rec.DependencyStatus = "ok"
+		rec.Payload, rec.Request, rec.Inputs = []byte(`{}`), []byte(`{}`), []byte(`{}`)
+		if err := s.store.SaveDecision(ctx, rec); err != nil {
+			t.Fatalf("save %s: %v", rec.DecisionID, err)
+		}
+	}
+	window := url.Values{
+		"from": {at.Add(-time.Hour).Format(time.RFC3339)},
+		"to":   {at.Add(time.Hour).Format(time.RFC3339)},
+	}
+	list := func(extra url.Values) ([]string, string) {
+		t.Helper()
+		q := url.Values{}
+		for k, v := range window {
+			q[k] = v
+		}
+		for k, v := range extra {
+			q[k] = v
+		}
+		code, out := serve(t, s.handleListDecisions, httpstd.MethodGet, "/v1/decisions?"+q.Encode(), nil, nil)
+		if code != httpstd.StatusOK {
+			t.Fatalf("list %v: got %d %v", q, code, out)
+		}
+		var ids []string
+		for _, d := range out["decisions"].([]any) {
+			ids = append(ids, d.(map[string]any)["decision_id"].(string)[len(tenant)+1:])
+		}
+		cursor, _ := out["next_cursor"].(string)
+		return ids, cursor
+	}
+
+	// Equal generated_at ties break on decision_id, descending, and the
+	// cursor resumes strictly after the last row without skipping the tie.
+	var paged []string
+	cursor := ""
+	for page := 0; page < 4; page++ {
+		extra := url.Values{"limit": {"1"}}
+		if cursor != "" {
+			extra.Set("cursor", cursor)
+		}
+		ids, next := list(extra)
+		paged = append(paged, ids...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if want := []string{"dec_b", "dec_a", "dec_c"}; !reflect.DeepEqual(paged, want) {
+		t.Fatalf("paged = %v, want %v", paged, want)
+	}
+
+	if ids, _ := list(url.Values{"item_id": {"x"}}); !reflect.DeepEqual(ids, []string{"dec_a", "dec_c"}) {
+		t.Fatalf("item_id=x = %v", ids)
+	}
+	if ids, _ := list(url.Values{"from": {at.Add(-30 * time.Second).Format(time.RFC3339)}}); !reflect.DeepEqual(ids, []string{"dec_b", "dec_a"}) {
+		t.Fatalf("from filter = %v", ids)
+	}
+	if ids, _ := list(url.Values{"to": {at.Format(time.RFC3339)}}); !reflect.DeepEqual(ids, []string{"dec_c"}) {
+		t.Fatalf("to filter = %v", ids)
+	}
+}
+
+func TestReplayValidatesRequest(t *testing.T) {
+	s := newTestServer(t, "t1", nil)
+	if code, out := serve(t, s.handleReplay, httpstd.MethodPost, "/v1/replay", replayRequest{}, nil); code != httpstd.StatusBadRequest || out["error"] != "invalid_request" {
+		t.Fatalf("expected invalid_request, got %d %v", code, out)
+	}
+	if code, out := serve(t, s.handleReplay, httpstd.MethodPost, "/v1/replay", replayRequest{DecisionID: "dec_1", Mode: "rewind"}, nil); code != httpstd.StatusBadRequest || out["error"] != "invalid_mode" {
+		t.Fatalf("expected invalid_mode, got %d %v", code, out)
+	}
+}
+
+func TestRecomputeKeepsSignatureOnlyForMatchingOutput(t *testing.T) {
+	s := newTestServer(t, "t1", nil)
+	req := testDecisionRequest()
+	req.TenantID = "t1"
+	resp, inputs := s.engine.DecideRecorded(context.Background(), req)
+	if len(resp.Items) < 2 {
+		t.Fatalf("expected at least two items, got %+v", resp.Items)
+	}
+	resp.Signature = &decision.Signature{KeyID: "k1", Alg: "Ed25519", Value: "sig"}
+	record := func(resp decision.DecisionResponse) storage.DecisionRecord {
+		t.Helper()
+		payload, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatalf("marshal payload: %v", err)
+		}
+		canonicalReq, _ := json.Marshal(decision.CanonicalRequest(req))
+		rawInputs, _ := json.Marshal(inputs)
+		return storage.DecisionRecord{Payload: payload, Request: canonicalReq, Inputs: rawInputs, PolicyVersion: resp.PolicyVersion, DataVersion: resp.DataVersion}
+	}
+
+	_, recomputed, err := s.recomputeDecision(context.Background(), record(resp))
+	if err != nil || recomputed.Signature == nil || *recomputed.Signature != *resp.Signature {
+		t.Fatalf("expected matching recomputation to keep the signature, got %+v %v", recomputed.Signature, err)
+	}
+
+	// Same hash, but the stored items were reordered: the signature must not
+	// be vouched for on the recomputed output.
+	diverged := resp
+	diverged.Items = append([]decision.RankedItem{}, resp.Items...)
+	diverged.Items[0], diverged.Items[1] = diverged.Items[1], diverged.Items[0]
+	_, recomputed, err = s.recomputeDecision(context.Background(), record(diverged))
+	if err != nil || recomputed.DecisionHash != diverged.DecisionHash || recomputed.Signature != nil {
+		t.Fatalf("expected diverging items to drop the signature, got %+v %v", recomputed.Signature, err)
+	}
+}
+
+func TestSimulateDecisionIsReadOnly(t *testing.T) {
+	upstream := &toggleGorse{}
+	retrieval := newTestRetrieval(t, upstream)
+	snaps := &memSnapshots{docs: map[string][]byte{}}
+	s := newTestServer(t, "t1", retrieval, decision.WithGorseSnapshots(snaps))
+
+	code, out := serve(t, s.handleSimulateDecision, httpstd.MethodPost, "/v1/decisions/simulate", simulateDecisionRequest{
+		Request:       testDecisionRequest(),
+		PolicyVersion: "policy-v2",
+		DataVersion:   "data-v2",
+	}, nil)
+	if code != httpstd.StatusOK || out["persisted"] != false {
+		t.Fatalf("unexpected simulate response %d %v", code, out)
+	}
+	if len(snaps.docs) != 0 {
+		t.Fatalf("expected no Gorse snapshot written, got %d", len(snaps.docs))
+	}
+	assertNoLastGood(t, upstream, retrieval)
+
+	if code, out := serve(t, s.handleSimulateDecision, httpstd.MethodPost, "/v1/decisions/simulate", simulateDecisionRequest{
+		Request: testDecisionRequest(),
+		RuleSet: &decision.RuleSet{PolicyVersion: "policy-v2", Pipelines: map[string][]string{"home": {"rank", "policy_eval"}}},
+	}, nil); code != httpstd.StatusBadRequest || out["error"] != "invalid_rule_set" {
+		t.Fatalf("expected invalid_rule_set, got %d %v", code, out)
+	}
+	mismatched := testDecisionRequest()
+	mismatched.TenantID = "t2"
+	if code, out := serve(t, s.handleSimulateDecision, httpstd.MethodPost, "/v1/decisions/simulate", simulateDecisionRequest{Request: mismatched}, nil); code != httpstd.StatusForbidden || out["error"] != "tenant_mismatch" {
+		t.Fatalf("expected tenant_mismatch, got %d %v", code, out)
+	}
+}
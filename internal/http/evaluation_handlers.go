@@ -0,0 +1,348 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	httpstd "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+const (
+	defaultEvaluationK            = 10
+	maxEvaluationK                = 100
+	defaultEvaluationMaxDecisions = 1000
+	maxEvaluationDecisions        = 20000
+	evaluationPageSize            = 200
+	evaluationExposureDeltas      = 50
+	evaluationTimeout             = 10 * time.Minute
+	evaluationSweepInterval       = time.Minute
+)
+
+type evaluationRequest struct {
+	PolicyVersion         string            `json:"policy_version,omitempty"`
+	RuleSet               *decision.RuleSet `json:"rule_set,omitempty"`
+	BaselinePolicyVersion string            `json:"baseline_policy_version,omitempty"`
+	Surface               string            `json:"surface,omitempty"`
+	From                  *time.Time        `json:"from,omitempty"`
+	To                    *time.Time        `json:"to,omitempty"`
+	K                     int               `json:"k,omitempty"`
+	MaxDecisions          int               `json:"max_decisions,omitempty"`
+}
+
+// evaluationReport is the stored result of an offline evaluation. Scanned
+// counts the decisions read from the window; decisions stored without their
+// canonical request and inputs cannot be replayed and are Skipped. Truncated
+// means the run stopped at max_decisions.
+type evaluationReport struct {
+	decision.OfflineReport
+	Scanned   int  `json:"scanned"`
+	Skipped   int  `json:"skipped"`
+	Truncated bool `json:"truncated"`
+}
+
+type evaluationView struct {
+	storage.EvaluationRecord
+	Report json.RawMessage `json:"report,omitempty"`
+}
+
+// handleCreateEvaluation starts an offline evaluation job. Stored decisions in
+// the window are replayed from their recorded inputs under the baseline and
+// candidate policies, ranked against the feedback they received, and the
+// report is persisted when the job finishes.
+func (s *Server) handleCreateEvaluation(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	var req evaluationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	req.PolicyVersion = strings.TrimSpace(req.PolicyVersion)
+	req.BaselinePolicyVersion = strings.TrimSpace(req.BaselinePolicyVersion)
+	req.Surface = strings.TrimSpace(req.Surface)
+	if req.RuleSet != nil {
+		if err := validateRuleSet(s.engine, *req.RuleSet); err != nil {
+			writeError(w, httpstd.StatusBadRequest, "invalid_rule_set", map[string]any{"details": err.Error()})
+			return
+		}
+		if req.PolicyVersion == "" {
+			req.PolicyVersion = req.RuleSet.PolicyVersion
+		}
+	}
+	if req.PolicyVersion == "" {
+		writeError(w, httpstd.StatusBadRequest, "policy_version_required", nil)
+		return
+	}
+	if req.BaselinePolicyVersion == "" {
+		active, err := s.engine.ActivePolicyVersion(r.Context(), claims.TenantID, req.Surface)
+		if err != nil {
+			writeError(w, httpstd.StatusInternalServerError, "policy_read_failed", map[string]any{"details": err.Error()})
+			return
+		}
+		req.BaselinePolicyVersion = active
+	}
+	if req.K == 0 {
+		req.K = defaultEvaluationK
+	}
+	if req.K < 0 || req.K > maxEvaluationK {
+		writeError(w, httpstd.StatusBadRequest, "invalid_k", map[string]any{"max": maxEvaluationK})
+		return
+	}
+	if req.MaxDecisions == 0 {
+		req.MaxDecisions = defaultEvaluationMaxDecisions
+	}
+	if req.MaxDecisions < 0 || req.MaxDecisions > maxEvaluationDecisions {
+		writeError(w, httpstd.StatusBadRequest, "invalid_max_decisions", map[string]any{"max": maxEvaluationDecisions})
+		return
+	}
+	to := time.Now().UTC()
+	if req.To != nil {
+		to = req.To.UTC()
+	}
+	from := to.Add(-defaultFeedbackWindow)
+	if req.From != nil {
+		from = req.From.UTC()
+	}
+	if !from.Before(to) {
+		writeError(w, httpstd.StatusBadRequest, "invalid_time_window", map[string]any{"details": "from must be before to"})
+		return
+	}
+	req.From, req.To = &from, &to
+
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		// Without an inline rule set the candidate and baseline are scored
+		// with stored rule sets, so they must exist.
+		versions := []string{req.BaselinePolicyVersion}
+		if req.RuleSet == nil {
+			versions = append(versions, req.PolicyVersion)
+		}
+		for _, version := range versions {
+			if version == s.engine.PolicyVersion {
+				continue
+			}
+			_, found, err := s.store.GetRuleSet(r.Context(), claims.TenantID, version)
+			if err != nil {
+				return 0, nil, err
+			}
+			if !found {
+				return httpstd.StatusUnprocessableEntity, mustJSON(map[string]any{
+					"error":          "rule_set_not_found",
+					"policy_version": version,
+				}), nil
+			}
+		}
+
+		rec := storage.EvaluationRecord{
+			EvaluationID:           stableID("evl", claims.TenantID, idemKey),
+			TenantID:               claims.TenantID,
+			Status:                 "running",
+			Surface:                req.Surface,
+			BaselinePolicyVersion:  req.BaselinePolicyVersion,
+			CandidatePolicyVersion: req.PolicyVersion,
+			From:                   from,
+			To:                     to,
+			K:                      req.K,
+			Request:                mustJSON(req),
+		}
+		created, err := s.store.CreateEvaluation(r.Context(), rec)
+		if err != nil {
+			return 0, nil, err
+		}
+		if created {
+			go s.runEvaluation(rec, req)
+		}
+		stored, _, err := s.store.GetEvaluation(r.Context(), claims.TenantID, rec.EvaluationID)
+		if err != nil {
+			return 0, nil, err
+		}
+		return httpstd.StatusAccepted, mustJSON(evaluationView{EvaluationRecord: stored}), nil
+	})
+}
+
+// runEvaluation executes an evaluation in the background and records its
+// outcome. It is bounded by the server lifetime and evaluationTimeout; an
+// interrupted or panicking run is marked failed.
+func (s *Server) runEvaluation(rec storage.EvaluationRecord, req evaluationRequest) {
+	ctx, cancel := context.WithTimeout(s.cleanupCtx, evaluationTimeout)
+	defer cancel()
+
+	status, msg := "completed", ""
+	var payload []byte
+	defer func() {
+		if p := recover(); p != nil {
+			status, msg, payload = "failed", fmt.Sprintf("panic: %v", p), nil
+		}
+		finishCtx, finishCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer finishCancel()
+		_ = s.store.FinishEvaluation(finishCtx, rec.TenantID, rec.EvaluationID, status, payload, msg)
+	}()
+	report, err := s.evaluatePolicy(ctx, rec, req)
+	if err != nil {
+		status, msg = "failed", err.Error()
+		return
+	}
+	payload = mustJSON(report)
+}
+
+// startEvaluationSweep fails evaluations left running by a process that
+// stopped mid-run. A live run finishes within evaluationTimeout, so one still
+// running past it (plus a sweep interval of grace) has nothing left to finish
+// it. It sweeps at startup and then every evaluationSweepInterval.
+func (s *Server) startEvaluationSweep(ctx context.Context) {
+	sweep := func() {
+		cutoff := time.Now().UTC().Add(-evaluationTimeout - evaluationSweepInterval)
+		_, _ = s.store.FailStaleEvaluations(ctx, cutoff, "evaluation_interrupted")
+	}
+	sweep()
+	t := time.NewTicker(evaluationSweepInterval)
+	go func() {
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				sweep()
+			}
+		}
+	}()
+}
+
+// evaluatePolicy pages through the window newest first. Both engines ignore
+// experiments and are pinned to each decision's data version, so the only
+// difference between the two rankings is the policy.
+func (s *Server) evaluatePolicy(ctx context.Context, rec storage.EvaluationRecord, req evaluationRequest) (evaluationReport, error) {
+	base := s.engine.WithoutExperiments()
+	eval := decision.NewOfflineEvaluator(rec.K)
+	filter := storage.DecisionFilter{From: rec.From, To: rec.To, Surface: rec.Surface}
+	var out evaluationReport
+
+	for out.Scanned < req.MaxDecisions {
+		pageSize := min(evaluationPageSize, req.MaxDecisions-out.Scanned)
+		page, err := s.store.ListDecisionRecords(ctx, rec.TenantID, filter, pageSize)
+		if err != nil {
+			return evaluationReport{}, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		ids := make([]string, 0, len(page))
+		for _, d := range page {
+			ids = append(ids, d.DecisionID)
+		}
+		events, err := s.store.ListFeedbackForDecisions(ctx, rec.TenantID, ids)
+		if err != nil {
+			return evaluationReport{}, err
+		}
+		relevance := map[string]map[string]float64{}
+		for _, ev := range events {
+			gain := decision.FeedbackGain(ev.EventType)
+			if relevance[ev.DecisionID] == nil {
+				relevance[ev.DecisionID] = map[string]float64{}
+			}
+			if gain > relevance[ev.DecisionID][ev.ItemID] {
+				relevance[ev.DecisionID][ev.ItemID] = gain
+			}
+		}
+
+		for _, d := range page {
+			out.Scanned++
+			dreq, inputs, ok := replayableDecision(d)
+			if !ok {
+				out.Skipped++
+				continue
+			}
+			baseline := base.WithVersions(rec.BaselinePolicyVersion, d.DataVersion).Recompute(ctx, dreq, inputs)
+			candidateEngine := base.WithVersions(rec.CandidatePolicyVersion, d.DataVersion)
+			if req.RuleSet != nil {
+				candidateEngine = candidateEngine.WithRuleSet(*req.RuleSet)
+			}
+			candidate := candidateEngine.Recompute(ctx, dreq, inputs)
+			eval.Add(baseline.Items, candidate.Items, relevance[d.DecisionID])
+		}
+		if err := ctx.Err(); err != nil {
+			return evaluationReport{}, err
+		}
+		if len(page) < pageSize {
+			break
+		}
+		last := page[len(page)-1]
+		filter.AfterGeneratedAt, filter.AfterID = last.GeneratedAt, last.DecisionID
+		out.Truncated = out.Scanned >= req.MaxDecisions
+	}
+	out.OfflineReport = eval.Report(evaluationExposureDeltas)
+	return out, nil
+}
+
+// replayableDecision decodes a stored decision's canonical request and
+// inputs, dropping the policy resolution and experiment assignment so the
+// engine's pinned policy version is used.
+func replayableDecision(rec storage.DecisionRecord) (decision.DecisionRequest, decision.DecisionInputs, bool) {
+	var req decision.DecisionRequest
+	var inputs decision.DecisionInputs
+	if len(rec.Request) == 0 || len(rec.Inputs) == 0 {
+		return req, inputs, false
+	}
+	if json.Unmarshal(rec.Request, &req) != nil || json.Unmarshal(rec.Inputs, &inputs) != nil {
+		return req, inputs, false
+	}
+	inputs.PolicyStage = nil
+	inputs.Experiment = nil
+	inputs.ExperimentStage = nil
+	return req, inputs, true
+}
+
+func (s *Server) handleListEvaluations(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	limit := 50
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 200 {
+			writeError(w, httpstd.StatusBadRequest, "invalid_limit", map[string]any{"max": 200})
+			return
+		}
+		limit = n
+	}
+	recs, err := s.store.ListEvaluations(r.Context(), claims.TenantID, limit)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "evaluation_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"tenant_id":   claims.TenantID,
+		"evaluations": recs,
+	})
+}
+
+func (s *Server) handleGetEvaluation(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	rec, found, err := s.store.GetEvaluation(r.Context(), claims.TenantID, r.PathValue("id"))
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "evaluation_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	if !found {
+		writeError(w, httpstd.StatusNotFound, "evaluation_not_found", nil)
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, evaluationView{EvaluationRecord: rec, Report: rec.Report})
+}
@@ -0,0 +1,246 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	httpstd "net/http"
+	"strings"
+
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+type experimentView struct {
+	storage.ExperimentRecord
+	Variants []decision.Variant `json:"variants"`
+}
+
+type variantResultView struct {
+	storage.VariantResult
+	PolicyVersion    string  `json:"policy_version"`
+	Weight           int     `json:"weight"`
+	ClickThroughRate float64 `json:"click_through_rate"`
+	ConversionRate   float64 `json:"conversion_rate"`
+}
+
+func (s *Server) handleCreateExperiment(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	var x decision.Experiment
+	if err := json.NewDecoder(r.Body).Decode(&x); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	x.ExperimentID = strings.TrimSpace(x.ExperimentID)
+	x.Surface = strings.TrimSpace(x.Surface)
+	for i := range x.Variants {
+		x.Variants[i].Name = strings.TrimSpace(x.Variants[i].Name)
+		x.Variants[i].PolicyVersion = strings.TrimSpace(x.Variants[i].PolicyVersion)
+	}
+	if err := x.Validate(); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_experiment", map[string]any{"details": err.Error()})
+		return
+	}
+
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		// A variant pointing at an unpublished rule set would silently score
+		// with the defaults, so require every named policy version to exist.
+		for _, v := range x.Variants {
+			if v.PolicyVersion == "" || v.PolicyVersion == s.engine.PolicyVersion {
+				continue
+			}
+			_, found, err := s.store.GetRuleSet(r.Context(), claims.TenantID, v.PolicyVersion)
+			if err != nil {
+				return 0, nil, err
+			}
+			if !found {
+				return httpstd.StatusUnprocessableEntity, mustJSON(map[string]any{
+					"error":          "rule_set_not_found",
+					"variant":        v.Name,
+					"policy_version": v.PolicyVersion,
+				}), nil
+			}
+		}
+		doc, err := json.Marshal(x)
+		if err != nil {
+			return 0, nil, err
+		}
+		err = s.store.CreateExperiment(r.Context(), storage.ExperimentRecord{
+			TenantID:     claims.TenantID,
+			ExperimentID: x.ExperimentID,
+			Surface:      x.Surface,
+			Payload:      doc,
+		})
+		if errors.Is(err, storage.ErrExperimentExists) || errors.Is(err, storage.ErrSurfaceHasExperiment) {
+			return httpstd.StatusConflict, mustJSON(map[string]any{
+				"error":         err.Error(),
+				"experiment_id": x.ExperimentID,
+				"surface":       x.Surface,
+			}), nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		rec, _, err := s.store.GetExperiment(r.Context(), claims.TenantID, x.ExperimentID)
+		if err != nil {
+			return 0, nil, err
+		}
+		payload, err := json.Marshal(experimentView{ExperimentRecord: rec, Variants: x.Variants})
+		if err != nil {
+			return 0, nil, err
+		}
+		return httpstd.StatusCreated, payload, nil
+	})
+}
+
+func (s *Server) handleListExperiments(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	recs, err := s.store.ListExperiments(r.Context(), claims.TenantID)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "experiment_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	views := make([]experimentView, 0, len(recs))
+	for _, rec := range recs {
+		view, err := newExperimentView(rec)
+		if err != nil {
+			writeError(w, httpstd.StatusInternalServerError, "experiment_decode_failed", map[string]any{"details": err.Error()})
+			return
+		}
+		views = append(views, view)
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"tenant_id":   claims.TenantID,
+		"experiments": views,
+	})
+}
+
+func (s *Server) handleGetExperiment(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	rec, ok := s.loadExperiment(w, r, claims.TenantID)
+	if !ok {
+		return
+	}
+	view, err := newExperimentView(rec)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "experiment_decode_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, view)
+}
+
+func (s *Server) handleStopExperiment(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	experimentID := strings.TrimSpace(r.PathValue("id"))
+
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		rec, found, err := s.store.StopExperiment(r.Context(), claims.TenantID, experimentID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !found {
+			return httpstd.StatusNotFound, mustJSON(map[string]any{"error": "experiment_not_found", "experiment_id": experimentID}), nil
+		}
+		view, err := newExperimentView(rec)
+		if err != nil {
+			return 0, nil, err
+		}
+		payload, err := json.Marshal(view)
+		if err != nil {
+			return 0, nil, err
+		}
+		return httpstd.StatusOK, payload, nil
+	})
+}
+
+// handleExperimentResults reports decisions and feedback per variant. Every
+// declared variant is listed, including ones that have seen no traffic yet.
+func (s *Server) handleExperimentResults(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	rec, ok := s.loadExperiment(w, r, claims.TenantID)
+	if !ok {
+		return
+	}
+	x, err := decision.ParseExperiment(rec.Payload)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "experiment_decode_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	rows, err := s.store.ExperimentResults(r.Context(), claims.TenantID, rec.ExperimentID)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "experiment_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	byVariant := make(map[string]storage.VariantResult, len(rows))
+	for _, row := range rows {
+		byVariant[row.Variant] = row
+	}
+	results := make([]variantResultView, 0, len(x.Variants))
+	for _, v := range x.Variants {
+		row, ok := byVariant[v.Name]
+		if !ok {
+			row = storage.VariantResult{Variant: v.Name}
+		}
+		policyVersion := v.PolicyVersion
+		if policyVersion == "" {
+			policyVersion = s.engine.PolicyVersion
+		}
+		view := variantResultView{VariantResult: row, PolicyVersion: policyVersion, Weight: v.Weight}
+		if row.Impressions > 0 {
+			view.ClickThroughRate = float64(row.Clicks) / float64(row.Impressions)
+			view.ConversionRate = float64(row.Conversions) / float64(row.Impressions)
+		}
+		results = append(results, view)
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"experiment_id": rec.ExperimentID,
+		"surface":       rec.Surface,
+		"status":        rec.Status,
+		"variants":      results,
+	})
+}
+
+func (s *Server) loadExperiment(w httpstd.ResponseWriter, r *httpstd.Request, tenantID string) (storage.ExperimentRecord, bool) {
+	experimentID := strings.TrimSpace(r.PathValue("id"))
+	rec, found, err := s.store.GetExperiment(r.Context(), tenantID, experimentID)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "experiment_read_failed", map[string]any{"details": err.Error()})
+		return storage.ExperimentRecord{}, false
+	}
+	if !found {
+		writeError(w, httpstd.StatusNotFound, "experiment_not_found", nil)
+		return storage.ExperimentRecord{}, false
+	}
+	return rec, true
+}
+
+func newExperimentView(rec storage.ExperimentRecord) (experimentView, error) {
+	x, err := decision.ParseExperiment(rec.Payload)
+	if err != nil {
+		return experimentView{}, err
+	}
+	return experimentView{ExperimentRecord: rec, Variants: x.Variants}, nil
+}
@@ -0,0 +1,319 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	httpstd "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorse"
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+const defaultFeedbackWindow = 7 * 24 * time.Hour
+
+func (s *Server) handleFeedback(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	var evt decision.FeedbackEvent
+	if err := json.NewDecoder(r.Body).Decode(&evt); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	evt.Surface = strings.TrimSpace(evt.Surface)
+	if err := evt.Validate(); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_feedback", map[string]any{"details": err.Error()})
+		return
+	}
+
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		dec, found, err := s.store.GetDecisionRecord(r.Context(), evt.DecisionID, claims.TenantID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !found {
+			return httpstd.StatusNotFound, mustJSON(map[string]any{"error": "decision_not_found", "decision_id": evt.DecisionID}), nil
+		}
+		var stored decision.DecisionResponse
+		if err := json.Unmarshal(dec.Payload, &stored); err != nil {
+			return 0, nil, err
+		}
+		// The surface and Gorse user come from the decision, so feedback is
+		// attributed where the items were actually served.
+		if evt.Surface != "" && evt.Surface != dec.Surface {
+			return httpstd.StatusUnprocessableEntity, mustJSON(map[string]any{
+				"error":       "surface_mismatch",
+				"decision_id": evt.DecisionID,
+				"surface":     dec.Surface,
+			}), nil
+		}
+		if !decisionHasItem(stored, evt.ItemID) {
+			return httpstd.StatusUnprocessableEntity, mustJSON(map[string]any{
+				"error":       "item_not_in_decision",
+				"decision_id": evt.DecisionID,
+				"item_id":     evt.ItemID,
+			}), nil
+		}
+
+		occurredAt := evt.OccurredAt.UTC()
+		if evt.OccurredAt.IsZero() {
+			occurredAt = time.Now().UTC()
+		}
+		rec := storage.FeedbackRecord{
+			EventID:    stableID("fbk", claims.TenantID, evt.DecisionID, evt.ItemID, evt.EventType, evt.ActorID),
+			TenantID:   claims.TenantID,
+			DecisionID: evt.DecisionID,
+			ItemID:     evt.ItemID,
+			EventType:  evt.EventType,
+			ActorID:    evt.ActorID,
+			Surface:    dec.Surface,
+			OccurredAt: occurredAt,
+		}
+		// Gorse learns per user, so feedback on an anonymous decision is
+		// recorded but not forwarded.
+		var outboxPayload []byte
+		forwarding := "skipped"
+		if dec.UserID != "" {
+			outboxPayload, err = json.Marshal(gorse.Feedback{
+				FeedbackType: rec.EventType,
+				UserID:       dec.UserID,
+				ItemID:       rec.ItemID,
+				Timestamp:    rec.OccurredAt.Format(time.RFC3339),
+			})
+			if err != nil {
+				return 0, nil, err
+			}
+			forwarding = "queued"
+		}
+		if err := s.store.SaveFeedback(r.Context(), rec, outboxPayload); err != nil {
+			if errors.Is(err, storage.ErrDuplicateFeedback) {
+				return httpstd.StatusConflict, mustJSON(map[string]any{"error": "duplicate_feedback", "event_id": rec.EventID}), nil
+			}
+			return 0, nil, err
+		}
+
+		out, err := json.Marshal(map[string]any{
+			"status":      "accepted",
+			"event_id":    rec.EventID,
+			"forwarding":  forwarding,
+			"decision_id": evt.DecisionID,
+			"item_id":     evt.ItemID,
+			"event_type":  evt.EventType,
+			"actor":       claims.Subject,
+			"tenant_id":   claims.TenantID,
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+		return httpstd.StatusAccepted, out, nil
+	})
+}
+
+func (s *Server) handleDecisionFeedback(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	decisionID := r.PathValue("id")
+	if decisionID == "" {
+		writeError(w, httpstd.StatusBadRequest, "decision_id_required", nil)
+		return
+	}
+	_, found, err := s.store.GetDecisionPayload(r.Context(), decisionID, claims.TenantID)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "decision_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	if !found {
+		writeError(w, httpstd.StatusNotFound, "decision_not_found", nil)
+		return
+	}
+	events, err := s.store.ListDecisionFeedback(r.Context(), claims.TenantID, decisionID)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "feedback_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"decision_id": decisionID,
+		"events":      events,
+		"items":       summarizeFeedback(events),
+	})
+}
+
+func (s *Server) handleFeedbackAggregates(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := parseTimeWindow(r, defaultFeedbackWindow)
+	if err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_time_window", map[string]any{"details": err.Error()})
+		return
+	}
+	q := r.URL.Query()
+	filter := storage.FeedbackFilter{
+		From:         from,
+		To:           to,
+		Surface:      strings.TrimSpace(q.Get("surface")),
+		ItemID:       strings.TrimSpace(q.Get("item_id")),
+		ExperimentID: strings.TrimSpace(q.Get("experiment_id")),
+	}
+	rows, err := s.store.AggregateFeedback(r.Context(), claims.TenantID, filter)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "feedback_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"tenant_id":  claims.TenantID,
+		"from":       from,
+		"to":         to,
+		"aggregates": withFeedbackRates(rows),
+	})
+}
+
+// handleUserExposures reads the exposure ledger frequency caps rank against:
+// per-item counts for one user, most exposed first.
+func (s *Server) handleUserExposures(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := parseTimeWindow(r, defaultFeedbackWindow)
+	if err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_time_window", map[string]any{"details": err.Error()})
+		return
+	}
+	q := r.URL.Query()
+	userID := strings.TrimSpace(q.Get("user_id"))
+	if userID == "" {
+		writeError(w, httpstd.StatusBadRequest, "user_id_required", nil)
+		return
+	}
+	limit := 100
+	if raw := strings.TrimSpace(q.Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 500 {
+			writeError(w, httpstd.StatusBadRequest, "invalid_limit", map[string]any{"max": 500})
+			return
+		}
+		limit = n
+	}
+	surface := strings.TrimSpace(q.Get("surface"))
+	rows, err := s.store.ListUserExposures(r.Context(), claims.TenantID, userID, surface, from, to, limit)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "exposure_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"tenant_id": claims.TenantID,
+		"user_id":   userID,
+		"surface":   surface,
+		"from":      from,
+		"to":        to,
+		"exposures": rows,
+	})
+}
+
+type feedbackAggregateView struct {
+	storage.FeedbackAggregate
+	ClickThroughRate float64 `json:"click_through_rate"`
+	ConversionRate   float64 `json:"conversion_rate"`
+}
+
+func withFeedbackRates(rows []storage.FeedbackAggregate) []feedbackAggregateView {
+	out := make([]feedbackAggregateView, 0, len(rows))
+	for _, row := range rows {
+		view := feedbackAggregateView{FeedbackAggregate: row}
+		if row.Impressions > 0 {
+			view.ClickThroughRate = float64(row.Clicks) / float64(row.Impressions)
+			view.ConversionRate = float64(row.Conversions) / float64(row.Impressions)
+		}
+		out = append(out, view)
+	}
+	return out
+}
+
+func summarizeFeedback(events []storage.FeedbackRecord) []storage.FeedbackAggregate {
+	index := map[string]int{}
+	out := []storage.FeedbackAggregate{}
+	for _, evt := range events {
+		key := evt.ItemID + "|" + evt.Surface
+		i, ok := index[key]
+		if !ok {
+			i = len(out)
+			index[key] = i
+			out = append(out, storage.FeedbackAggregate{ItemID: evt.ItemID, Surface: evt.Surface})
+		}
+		switch evt.EventType {
+		case "impression":
+			out[i].Impressions++
+		case "click":
+			out[i].Clicks++
+		case "conversion":
+			out[i].Conversions++
+		}
+	}
+	return out
+}
+
+func decisionHasItem(resp decision.DecisionResponse, itemID string) bool {
+	for _, item := range resp.Items {
+		if item.ItemID == itemID {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeWindow reads RFC3339 `from`/`to` query parameters. Missing bounds
+// default to [now-fallback, now).
+func parseTimeWindow(r *httpstd.Request, fallback time.Duration) (time.Time, time.Time, error) {
+	q := r.URL.Query()
+	to := time.Now().UTC()
+	if raw := strings.TrimSpace(q.Get("to")); raw != "" {
+		v, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be RFC3339")
+		}
+		to = v.UTC()
+	}
+	from := to.Add(-fallback)
+	if raw := strings.TrimSpace(q.Get("from")); raw != "" {
+		v, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be RFC3339")
+		}
+		from = v.UTC()
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+func (s *Server) handleFeedbackOutbox(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	stats, err := s.store.FeedbackOutboxStats(r.Context(), claims.TenantID)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "feedback_outbox_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"tenant_id": claims.TenantID,
+		"outbox":    stats,
+	})
+}
@@ -9,7 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorules"
+	"github.com/restarone/violet-deterministic-api/internal/auth"
 	"github.com/restarone/violet-deterministic-api/internal/decision"
+	"github.com/restarone/violet-deterministic-api/internal/signing"
 	"github.com/restarone/violet-deterministic-api/internal/storage"
 )
 
@@ -20,109 +23,42 @@ func (s *Server) handleHealth(w httpstd.ResponseWriter, _ *httpstd.Request) {
 		"policy_version":                    s.cfg.PolicyVersion,
 		"data_version":                      s.cfg.DataVersion,
 		"idempotency_cleanup_deleted_total": s.store.IdempotencyCleanupDeletedTotal(),
+		"feedback_outbox_delivered_total":   s.outbox.DeliveredTotal(),
+		"feedback_outbox_dead_total":        s.outbox.DeadTotal(),
+		"gorse_breaker_state":               s.gorse.BreakerState(),
+		"signing_key_id":                    s.signingKeyID(),
 	})
 }
 
-func (s *Server) handleDecisions(w httpstd.ResponseWriter, r *httpstd.Request) {
-	claims, ok := s.authClaims(w, r)
-	if !ok {
-		return
-	}
-	idemKey, ok := s.idempotencyKey(w, r)
-	if !ok {
-		return
-	}
-
-	var req decision.DecisionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
-		return
-	}
-	if req.TenantID == "" {
-		req.TenantID = claims.TenantID
-	}
-	if req.TenantID != claims.TenantID {
-		writeError(w, httpstd.StatusForbidden, "tenant_mismatch", nil)
-		return
+// handleKeys publishes the decision signing keys as a JWK set. It needs no
+// auth so offline consumers can fetch keys to verify decisions.
+//
+// A decision's signature.value is the base64url (unpadded) Ed25519 signature
+// over the RFC 8785 canonical JSON of
+//
+//	{"alg": "EdDSA", "kid": signature.key_id, "decision_id", "decision_hash",
+//	 "policy_version", "data_version", "rule_set_hash", "output_digest"}
+//
+// taken from the response, where output_digest is "v2:" followed by the hex
+// SHA-256 of the canonical JSON {"items": [{"item_id", "score"}...],
+// "removed": [{"item_id", "reason", "tag"?}...]} in response order, empty
+// lists written as []. See signing.SigningInput.
+func (s *Server) handleKeys(w httpstd.ResponseWriter, _ *httpstd.Request) {
+	keys := []signing.JWK{}
+	if s.signer != nil {
+		keys = s.signer.JWKS()
 	}
-
-	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
-		resp := s.engine.Decide(r.Context(), req)
-		payload, err := json.Marshal(resp)
-		if err != nil {
-			return 0, nil, err
-		}
-		if err := s.store.SaveDecision(
-			r.Context(),
-			resp.DecisionID,
-			claims.TenantID,
-			resp.DecisionHash,
-			resp.PolicyVersion,
-			resp.DataVersion,
-			resp.GeneratedAt,
-			payload,
-		); err != nil {
-			return 0, nil, err
-		}
-		return httpstd.StatusOK, payload, nil
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"keys":          keys,
+		"active_key_id": s.signingKeyID(),
 	})
 }
 
-func (s *Server) handleReplay(w httpstd.ResponseWriter, r *httpstd.Request) {
-	claims, ok := s.authClaims(w, r)
-	if !ok {
-		return
-	}
-
-	var body struct {
-		DecisionID string `json:"decision_id"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.DecisionID == "" {
-		writeError(w, httpstd.StatusBadRequest, "invalid_request", nil)
-		return
-	}
-
-	payload, found, err := s.store.GetDecisionPayload(r.Context(), body.DecisionID, claims.TenantID)
-	if err != nil {
-		writeError(w, httpstd.StatusInternalServerError, "replay_read_failed", map[string]any{"details": err.Error()})
-		return
-	}
-	if !found {
-		writeError(w, httpstd.StatusNotFound, "decision_not_found", nil)
-		return
-	}
-	writeJSON(w, httpstd.StatusOK, payload)
-}
-
-func (s *Server) handleFeedback(w httpstd.ResponseWriter, r *httpstd.Request) {
-	claims, ok := s.authClaims(w, r)
-	if !ok {
-		return
-	}
-	idemKey, ok := s.idempotencyKey(w, r)
-	if !ok {
-		return
-	}
-
-	var evt decision.FeedbackEvent
-	if err := json.NewDecoder(r.Body).Decode(&evt); err != nil {
-		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
-		return
+func (s *Server) signingKeyID() string {
+	if s.signer == nil {
+		return ""
 	}
-
-	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
-		payload, err := json.Marshal(map[string]any{
-			"status":      "accepted",
-			"decision_id": evt.DecisionID,
-			"event_type":  evt.EventType,
-			"actor":       claims.Subject,
-			"tenant_id":   claims.TenantID,
-		})
-		if err != nil {
-			return 0, nil, err
-		}
-		return httpstd.StatusAccepted, payload, nil
-	})
+	return s.signer.ActiveKeyID()
 }
 
 type createAppRequest struct {
@@ -277,7 +213,7 @@ func (s *Server) handleAppMutation(w httpstd.ResponseWriter, r *httpstd.Request)
 	}
 
 	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
-		resp, status, err := s.executeMutation(r.Context(), claims.TenantID, appID, idemKey, req)
+		resp, status, err := s.executeMutation(r.Context(), claims, gorules.ActorHuman, appID, idemKey, req)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -289,7 +225,11 @@ func (s *Server) handleAppMutation(w httpstd.ResponseWriter, r *httpstd.Request)
 	})
 }
 
-func (s *Server) executeMutation(ctx context.Context, tenantID, appID, idemKey string, req appMutationRequest) (map[string]any, int, error) {
+// executeMutation checks a mutation against the tenant's active mutation
+// policy and applies it. The policy sees the app, its plan, the actor and the
+// target path; a denial names the rule that denied it.
+func (s *Server) executeMutation(ctx context.Context, claims auth.Claims, actorType, appID, idemKey string, req appMutationRequest) (map[string]any, int, error) {
+	tenantID := claims.TenantID
 	app, found, err := s.store.GetApp(ctx, tenantID, appID)
 	if err != nil {
 		return nil, 0, err
@@ -298,12 +238,24 @@ func (s *Server) executeMutation(ctx context.Context, tenantID, appID, idemKey s
 		return map[string]any{"error": "app_not_found"}, httpstd.StatusNotFound, nil
 	}
 
-	policyOut, err := s.policy.Evaluate(ctx, tenantID, map[string]any{"mutation_class": req.Class})
+	policyVersion, err := s.engine.ActivePolicyVersion(ctx, tenantID, decision.MutationSurface)
+	if err != nil {
+		return nil, 0, err
+	}
+	input := policyMutation(app, actorType, claims.Subject, req).Input()
+	input["policy_version"] = policyVersion
+	policyOut, err := s.policy.Evaluate(ctx, tenantID, input)
 	if err != nil {
 		return nil, 0, err
 	}
-	if allowed, ok := policyOut["allowed"].(bool); ok && !allowed {
-		return map[string]any{"error": "mutation_not_allowed", "class": req.Class}, httpstd.StatusForbidden, nil
+	if allowed, rule := gorules.MutationVerdict(policyOut); !allowed {
+		return map[string]any{
+			"error":          "mutation_not_allowed",
+			"class":          req.Class,
+			"path":           input["path"],
+			"policy_version": policyVersion,
+			"rule":           rule,
+		}, httpstd.StatusForbidden, nil
 	}
 
 	beforeRaw, _ := json.Marshal(app)
@@ -319,17 +271,48 @@ func (s *Server) executeMutation(ctx context.Context, tenantID, appID, idemKey s
 	mutationPayload, _ := json.Marshal(req)
 
 	mutationID := stableID("mut", tenantID, appID, idemKey, req.Class)
-	if err := s.store.SaveMutation(ctx, mutationID, tenantID, appID, req.Class, beforeRaw, afterRaw, mutationPayload); err != nil {
+	if err := s.store.SaveMutation(ctx, mutationID, tenantID, appID, req.Class, policyVersion, actorType, claims.Subject, beforeRaw, afterRaw, mutationPayload); err != nil {
 		return nil, 0, err
 	}
 
 	return map[string]any{
 		"mutation_id":    mutationID,
-		"policy_version": s.cfg.PolicyVersion,
+		"policy_version": policyVersion,
 		"app":            app,
 	}, httpstd.StatusOK, nil
 }
 
+// policyMutation describes req against app as the mutation policy sees it.
+func policyMutation(app storage.App, actorType, actorID string, req appMutationRequest) gorules.Mutation {
+	return gorules.Mutation{
+		TenantID:  app.TenantID,
+		AppID:     app.ID,
+		Blueprint: app.Blueprint,
+		Class:     req.Class,
+		Path:      mutationTarget(req),
+		Value:     req.Value,
+		ActorType: actorType,
+		ActorID:   actorID,
+	}
+}
+
+// mutationTarget is the app field a mutation writes, as a dotted path.
+// Unknown classes target their own name so policies can still match them.
+func mutationTarget(req appMutationRequest) string {
+	switch req.Class {
+	case "set_name":
+		return "name"
+	case "set_plan":
+		return "blueprint.plan"
+	case "set_region":
+		return "blueprint.region"
+	case "set_feature_flag":
+		return "blueprint.features." + strings.TrimSpace(req.Path)
+	default:
+		return req.Class
+	}
+}
+
 func applyMutation(app *storage.App, req appMutationRequest) error {
 	switch req.Class {
 	case "set_name":
@@ -1014,7 +997,7 @@ func (s *Server) handleAgentAct(w httpstd.ResponseWriter, r *httpstd.Request) {
 		return
 	}
 	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
-		resp, status, err := s.executeMutation(r.Context(), claims.TenantID, req.AppID, idemKey, appMutationRequest{
+		resp, status, err := s.executeMutation(r.Context(), claims, gorules.ActorAgent, req.AppID, idemKey, appMutationRequest{
 			Class: req.Class,
 			Path:  req.Path,
 			Value: req.Value,
@@ -1022,7 +1005,7 @@ func (s *Server) handleAgentAct(w httpstd.ResponseWriter, r *httpstd.Request) {
 		if err != nil {
 			return 0, nil, err
 		}
-		resp["actor"] = "agent"
+		resp["actor"] = gorules.ActorAgent
 		resp["subject"] = claims.Subject
 		payload, err := json.Marshal(resp)
 		if err != nil {
@@ -1059,7 +1042,7 @@ func (s *Server) handleAgentVerify(w httpstd.ResponseWriter, r *httpstd.Request)
 		if err != nil {
 			return 0, nil, err
 		}
-		resp["actor"] = "agent"
+		resp["actor"] = gorules.ActorAgent
 		resp["subject"] = claims.Subject
 		payload, err := json.Marshal(resp)
 		if err != nil {
@@ -1103,7 +1086,7 @@ func (s *Server) handleAgentDeploy(w httpstd.ResponseWriter, r *httpstd.Request)
 		if err != nil {
 			return 0, nil, err
 		}
-		resp["actor"] = "agent"
+		resp["actor"] = gorules.ActorAgent
 		resp["subject"] = claims.Subject
 		payload, err := json.Marshal(resp)
 		if err != nil {
@@ -0,0 +1,297 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	httpstd "net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorules"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+const (
+	defaultImpactMaxMutations = 1000
+	maxImpactMutations        = 20000
+	maxImpactApps             = 1000
+	maxImpactDenials          = 200
+)
+
+// impactProbeClasses are the mutation classes checked against each current
+// app blueprint.
+var impactProbeClasses = []string{"set_name", "set_plan", "set_region", "set_feature_flag"}
+
+type policyImpactRequest struct {
+	From         *time.Time `json:"from,omitempty"`
+	To           *time.Time `json:"to,omitempty"`
+	MaxMutations int        `json:"max_mutations,omitempty"`
+}
+
+type impactCount struct {
+	Scanned int `json:"scanned"`
+	Denied  int `json:"denied"`
+}
+
+// impactDenial is one mutation the candidate policy denies. History denials
+// carry the stored mutation and the version that allowed it; probes of
+// current blueprints carry neither.
+type impactDenial struct {
+	MutationID   string     `json:"mutation_id,omitempty"`
+	AppID        string     `json:"app_id"`
+	Class        string     `json:"class"`
+	Path         string     `json:"path"`
+	ActorType    string     `json:"actor_type"`
+	AllowedUnder string     `json:"allowed_under,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	Rule         any        `json:"rule"`
+}
+
+type impactHistory struct {
+	Scanned    int                    `json:"scanned"`
+	Denied     int                    `json:"denied"`
+	Failed     int                    `json:"failed"`
+	FirstError string                 `json:"first_error,omitempty"`
+	Truncated  bool                   `json:"truncated"`
+	ByApp      map[string]impactCount `json:"by_app"`
+	ByClass    map[string]impactCount `json:"by_class"`
+	Denials    []impactDenial         `json:"denials"`
+}
+
+type appImpact struct {
+	AppID  string         `json:"app_id"`
+	Name   string         `json:"name"`
+	Plan   string         `json:"plan,omitempty"`
+	Denied []impactDenial `json:"denied"`
+}
+
+type impactApps struct {
+	Scanned    int         `json:"scanned"`
+	Affected   int         `json:"affected"`
+	Failed     int         `json:"failed"`
+	FirstError string      `json:"first_error,omitempty"`
+	Truncated  bool        `json:"truncated"`
+	Results    []appImpact `json:"results"`
+}
+
+type policyImpactReport struct {
+	ReportID      string        `json:"report_id"`
+	TenantID      string        `json:"tenant_id"`
+	PolicyVersion string        `json:"policy_version"`
+	GeneratedAt   time.Time     `json:"generated_at"`
+	From          *time.Time    `json:"from,omitempty"`
+	To            time.Time     `json:"to"`
+	History       impactHistory `json:"history"`
+	Apps          impactApps    `json:"apps"`
+}
+
+// handlePolicyImpact reports which stored mutations and which current apps
+// the candidate policy version would deny. It only evaluates; nothing is
+// stored or activated.
+func (s *Server) handlePolicyImpact(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	version := r.PathValue("version")
+	if version == "" || version != strings.TrimSpace(version) || strings.ContainsAny(version, `/\:`) {
+		writeError(w, httpstd.StatusBadRequest, "invalid_policy_version", nil)
+		return
+	}
+	var req policyImpactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	if req.MaxMutations == 0 {
+		req.MaxMutations = defaultImpactMaxMutations
+	}
+	if req.MaxMutations < 0 || req.MaxMutations > maxImpactMutations {
+		writeError(w, httpstd.StatusBadRequest, "invalid_max_mutations", map[string]any{"max": maxImpactMutations})
+		return
+	}
+	to := time.Now().UTC()
+	if req.To != nil {
+		to = req.To.UTC()
+	}
+	var from time.Time
+	if req.From != nil {
+		from = req.From.UTC()
+		if !from.Before(to) {
+			writeError(w, httpstd.StatusBadRequest, "invalid_time_window", map[string]any{"details": "from must be before to"})
+			return
+		}
+	}
+
+	if version != s.engine.PolicyVersion {
+		_, found, err := s.store.GetPolicy(r.Context(), claims.TenantID, version)
+		if err != nil {
+			writeError(w, httpstd.StatusInternalServerError, "policy_read_failed", map[string]any{"details": err.Error()})
+			return
+		}
+		if !found {
+			writeError(w, httpstd.StatusNotFound, "policy_not_found", nil)
+			return
+		}
+	}
+
+	report := policyImpactReport{
+		ReportID:      stableID("pim", claims.TenantID, version, from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano), fmt.Sprint(req.MaxMutations)),
+		TenantID:      claims.TenantID,
+		PolicyVersion: version,
+		GeneratedAt:   time.Now().UTC(),
+		To:            to,
+	}
+	if req.From != nil {
+		report.From = &from
+	}
+	var err error
+	if report.History, err = s.mutationHistoryImpact(r.Context(), claims.TenantID, version, from, to, req.MaxMutations); err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "impact_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	if report.Apps, err = s.appImpact(r.Context(), claims.TenantID, version); err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "impact_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, report)
+}
+
+// evaluateMutation checks one mutation under version. Like fixtures, impact
+// analysis evaluates the published document in-process.
+func (s *Server) evaluateMutation(ctx context.Context, version string, m gorules.Mutation) (bool, any, error) {
+	input := m.Input()
+	input["policy_version"] = version
+	out, err := s.jdm.Evaluate(ctx, m.TenantID, input)
+	if err != nil {
+		return false, nil, err
+	}
+	allowed, rule := gorules.MutationVerdict(out)
+	return allowed, rule, nil
+}
+
+// mutationHistoryImpact replays stored mutations, newest first, against the
+// app snapshot each was checked under.
+func (s *Server) mutationHistoryImpact(ctx context.Context, tenantID, version string, from, to time.Time, limit int) (impactHistory, error) {
+	out := impactHistory{ByApp: map[string]impactCount{}, ByClass: map[string]impactCount{}, Denials: []impactDenial{}}
+	records, err := s.store.ListMutations(ctx, tenantID, from, to, limit+1)
+	if err != nil {
+		return impactHistory{}, err
+	}
+	if len(records) > limit {
+		records, out.Truncated = records[:limit], true
+	}
+	for _, rec := range records {
+		out.Scanned++
+		var app storage.App
+		var req appMutationRequest
+		err := json.Unmarshal(rec.Before, &app)
+		if err == nil {
+			err = json.Unmarshal(rec.Payload, &req)
+		}
+		var allowed bool
+		var rule any
+		if err == nil {
+			app.TenantID = tenantID
+			allowed, rule, err = s.evaluateMutation(ctx, version, policyMutation(app, rec.ActorType, rec.ActorID, req))
+		}
+		if err != nil {
+			out.Failed++
+			if out.FirstError == "" {
+				out.FirstError = rec.MutationID + ": " + err.Error()
+			}
+			continue
+		}
+
+		byApp, byClass := out.ByApp[rec.AppID], out.ByClass[rec.Class]
+		byApp.Scanned++
+		byClass.Scanned++
+		if !allowed {
+			out.Denied++
+			byApp.Denied++
+			byClass.Denied++
+			if len(out.Denials) < maxImpactDenials {
+				createdAt := rec.CreatedAt
+				out.Denials = append(out.Denials, impactDenial{
+					MutationID:   rec.MutationID,
+					AppID:        rec.AppID,
+					Class:        rec.Class,
+					Path:         mutationTarget(req),
+					ActorType:    rec.ActorType,
+					AllowedUnder: rec.PolicyVersion,
+					CreatedAt:    &createdAt,
+					Rule:         rule,
+				})
+			}
+		}
+		out.ByApp[rec.AppID], out.ByClass[rec.Class] = byApp, byClass
+	}
+	return out, nil
+}
+
+// appImpact probes each current app with every supported mutation class, by
+// both actor types. Feature flags are probed per flag the blueprint already
+// has. Probes carry no value, so rules on values are not exercised.
+func (s *Server) appImpact(ctx context.Context, tenantID, version string) (impactApps, error) {
+	out := impactApps{Results: []appImpact{}}
+	apps, err := s.store.ListApps(ctx, tenantID, maxImpactApps+1)
+	if err != nil {
+		return impactApps{}, err
+	}
+	if len(apps) > maxImpactApps {
+		apps, out.Truncated = apps[:maxImpactApps], true
+	}
+	for _, app := range apps {
+		out.Scanned++
+		plan, _ := app.Blueprint["plan"].(string)
+		res := appImpact{AppID: app.ID, Name: app.Name, Plan: plan, Denied: []impactDenial{}}
+		for _, req := range probeMutations(app) {
+			for _, actor := range []string{gorules.ActorHuman, gorules.ActorAgent} {
+				allowed, rule, err := s.evaluateMutation(ctx, version, policyMutation(app, actor, "", req))
+				if err != nil {
+					out.Failed++
+					if out.FirstError == "" {
+						out.FirstError = app.ID + ": " + err.Error()
+					}
+					continue
+				}
+				if !allowed {
+					res.Denied = append(res.Denied, impactDenial{AppID: app.ID, Class: req.Class, Path: mutationTarget(req), ActorType: actor, Rule: rule})
+				}
+			}
+		}
+		if len(res.Denied) > 0 {
+			out.Affected++
+			out.Results = append(out.Results, res)
+		}
+	}
+	return out, nil
+}
+
+func probeMutations(app storage.App) []appMutationRequest {
+	var out []appMutationRequest
+	for _, class := range impactProbeClasses {
+		if class != "set_feature_flag" {
+			out = append(out, appMutationRequest{Class: class})
+			continue
+		}
+		features, _ := app.Blueprint["features"].(map[string]any)
+		if len(features) == 0 {
+			out = append(out, appMutationRequest{Class: class})
+			continue
+		}
+		flags := make([]string, 0, len(features))
+		for flag := range features {
+			flags = append(flags, flag)
+		}
+		sort.Strings(flags)
+		for _, flag := range flags {
+			out = append(out, appMutationRequest{Class: class, Path: flag})
+		}
+	}
+	return out
+}
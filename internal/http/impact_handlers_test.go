@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	httpstd "net/http"
+	"reflect"
+	"testing"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorules"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+func TestPolicyImpactValidatesRequest(t *testing.T) {
+	s := newTestServer(t, "t1", nil)
+	cases := []struct {
+		body any
+		want string
+	}{
+		{"{", "invalid_json"},
+		{map[string]any{"max_mutations": -1}, "invalid_max_mutations"},
+		{map[string]any{"max_mutations": maxImpactMutations + 1}, "invalid_max_mutations"},
+		{map[string]any{"from": "2026-02-01T00:00:00Z", "to": "2026-01-01T00:00:00Z"}, "invalid_time_window"},
+		{map[string]any{"from": "2026-01-01T00:00:00Z", "to": "2026-01-01T00:00:00Z"}, "invalid_time_window"},
+	}
+	handler := withPathValue(s.handlePolicyImpact, "version", "policy-v2")
+	for _, tc := range cases {
+		code, out := serve(t, handler, httpstd.MethodPost, "/v1/policies/policy-v2/impact", tc.body, nil)
+		if code != httpstd.StatusBadRequest || out["error"] != tc.want {
+			t.Fatalf("%v: got %d %v, want 400 %s", tc.body, code, out, tc.want)
+		}
+	}
+	for _, version := range []string{" policy-v2", "policy-v2 ", "a:b"} {
+		code, out := serve(t, withPathValue(s.handlePolicyImpact, "version", version), httpstd.MethodPost, "/v1/policies/x/impact", nil, nil)
+		if code != httpstd.StatusBadRequest || out["error"] != "invalid_policy_version" {
+			t.Fatalf("version %q: got %d %v, want 400 invalid_policy_version", version, code, out)
+		}
+	}
+}
+
+func TestProbeMutationsProbesEachFeatureFlag(t *testing.T) {
+	app := storage.App{Blueprint: map[string]any{"features": map[string]any{"search": true, "billing": false, "audit": true}}}
+	var got []string
+	for _, req := range probeMutations(app) {
+		got = append(got, req.Class+":"+req.Path)
+	}
+	want := []string{"set_name:", "set_plan:", "set_region:", "set_feature_flag:audit", "set_feature_flag:billing", "set_feature_flag:search"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("probes = %v, want %v", got, want)
+	}
+
+	got = nil
+	for _, req := range probeMutations(storage.App{Blueprint: map[string]any{}}) {
+		got = append(got, req.Class+":"+req.Path)
+	}
+	if want := []string{"set_name:", "set_plan:", "set_region:", "set_feature_flag:"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("probes without features = %v, want %v", got, want)
+	}
+}
+
+func TestPolicyImpactTruncatesHistory(t *testing.T) {
+	s, tenant := newStoreServer(t, nil)
+	ctx := context.Background()
+	before, _ := json.Marshal(storage.App{ID: "app_1", Name: "App", Blueprint: map[string]any{"plan": "starter"}})
+	payload, _ := json.Marshal(appMutationRequest{Class: "set_name", Value: "Renamed"})
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("%s_mut_%d", tenant, i)
+		if err := s.store.SaveMutation(ctx, id, tenant, "app_1", "set_name", "policy-v1", gorules.ActorHuman, "tester", before, before, payload); err != nil {
+			t.Fatalf("save mutation: %v", err)
+		}
+	}
+
+	handler := withPathValue(s.handlePolicyImpact, "version", s.engine.PolicyVersion)
+	code, out := serve(t, handler, httpstd.MethodPost, "/v1/policies/policy-v1/impact", map[string]any{"max_mutations": 2}, nil)
+	if code != httpstd.StatusOK {
+		t.Fatalf("impact: got %d %v", code, out)
+	}
+	history := out["history"].(map[string]any)
+	if history["scanned"] != float64(2) || history["truncated"] != true {
+		t.Fatalf("expected 2 scanned and truncated, got %v", history)
+	}
+
+	code, out = serve(t, handler, httpstd.MethodPost, "/v1/policies/policy-v1/impact", map[string]any{"max_mutations": 3}, nil)
+	if history, _ := out["history"].(map[string]any); code != httpstd.StatusOK || history["scanned"] != float64(3) || history["truncated"] != false {
+		t.Fatalf("expected 3 scanned and not truncated, got %d %v", code, out)
+	}
+}
+
+func TestPolicyImpactUnknownVersion(t *testing.T) {
+	s, _ := newStoreServer(t, nil)
+	code, out := serve(t, withPathValue(s.handlePolicyImpact, "version", "policy-missing"), httpstd.MethodPost, "/v1/policies/policy-missing/impact", nil, nil)
+	if code != httpstd.StatusNotFound || out["error"] != "policy_not_found" {
+		t.Fatalf("expected 404 policy_not_found, got %d %v", code, out)
+	}
+}
@@ -2,8 +2,6 @@ package http
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/restarone/violet-deterministic-api/internal/canonical"
 	"github.com/restarone/violet-deterministic-api/internal/storage"
 )
 
@@ -319,8 +318,14 @@ func normalizeImportedBundle(in violetBundle, tenantID, defaultPolicyVersion, de
 	if err != nil {
 		return violetBundle{}, err
 	}
-	if expected := strings.TrimSpace(in.Checksum); expected != "" && expected != out.Checksum {
-		return violetBundle{}, fmt.Errorf("checksum mismatch: expected=%s got=%s", expected, out.Checksum)
+	if expected := strings.TrimSpace(in.Checksum); expected != "" {
+		ok, err := canonical.VerifyHash(expected, violetBundleCore(out))
+		if err != nil {
+			return violetBundle{}, fmt.Errorf("checksum: %w", err)
+		}
+		if !ok {
+			return violetBundle{}, fmt.Errorf("checksum mismatch: expected=%s got=%s", expected, out.Checksum)
+		}
 	}
 	return out, nil
 }
@@ -626,8 +631,15 @@ func normalizeRoles(raw any) ([]string, []string, error) {
 	return roles, unsupported, nil
 }
 
+// hashVioletBundle returns the current-version checksum of the bundle
+// content. Imports also accept checksums made with older hash versions.
 func hashVioletBundle(bundle violetBundle) string {
-	core := map[string]any{
+	h, _ := canonical.Hash(canonical.Current, violetBundleCore(bundle))
+	return h
+}
+
+func violetBundleCore(bundle violetBundle) map[string]any {
+	return map[string]any{
 		"source_system":      bundle.SourceSystem,
 		"bundle_version":     bundle.BundleVersion,
 		"policy_version":     bundle.PolicyVersion,
@@ -638,9 +650,6 @@ func hashVioletBundle(bundle violetBundle) string {
 		"roles":              bundle.Roles,
 		"unsupported_fields": bundle.UnsupportedFields,
 	}
-	raw, _ := json.Marshal(core)
-	sum := sha256.Sum256(raw)
-	return hex.EncodeToString(sum[:])
 }
 
 func uniqueSortedStrings(in []string) []string {
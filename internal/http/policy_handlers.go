@@ -0,0 +1,403 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	httpstd "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorules"
+	"github.com/restarone/violet-deterministic-api/internal/canonical"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+type publishPolicyRequest struct {
+	PolicyVersion string            `json:"policy_version"`
+	Description   string            `json:"description,omitempty"`
+	Document      json.RawMessage   `json:"document"`
+	Fixtures      []gorules.Fixture `json:"fixtures,omitempty"`
+}
+
+// policyContent is what a policy version's content hash covers.
+type policyContent struct {
+	Document json.RawMessage   `json:"document"`
+	Fixtures []gorules.Fixture `json:"fixtures,omitempty"`
+}
+
+type activatePolicyRequest struct {
+	Surface    string     `json:"surface"`
+	ActivateAt *time.Time `json:"activate_at,omitempty"`
+}
+
+type rollbackPolicyRequest struct {
+	Surface string `json:"surface"`
+}
+
+type policyView struct {
+	storage.PolicyRecord
+	Document json.RawMessage `json:"document,omitempty"`
+	Fixtures json.RawMessage `json:"fixtures,omitempty"`
+}
+
+func newPolicyView(rec storage.PolicyRecord) policyView {
+	return policyView{PolicyRecord: rec, Document: rec.Document, Fixtures: rec.Fixtures}
+}
+
+// handlePublishPolicy stores a GoRules decision model and its test fixtures as
+// an immutable policy version. The document is validated and stored in
+// canonical form, and the content hash over document and fixtures identifies
+// it: republishing identical content is a no-op, different content under a
+// published version is a conflict.
+func (s *Server) handlePublishPolicy(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	var req publishPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	req.PolicyVersion = strings.TrimSpace(req.PolicyVersion)
+	if req.PolicyVersion == "" || strings.ContainsAny(req.PolicyVersion, `/\:`) {
+		writeError(w, httpstd.StatusBadRequest, "invalid_policy_version", nil)
+		return
+	}
+	if len(req.Document) == 0 {
+		writeError(w, httpstd.StatusBadRequest, "document_required", nil)
+		return
+	}
+	if _, err := gorules.ParseDecision(req.Document); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_policy_document", map[string]any{"details": err.Error()})
+		return
+	}
+	doc, err := canonical.Canonicalize(req.Document)
+	if err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_policy_document", map[string]any{"details": err.Error()})
+		return
+	}
+	for i := range req.Fixtures {
+		req.Fixtures[i].Name = strings.TrimSpace(req.Fixtures[i].Name)
+	}
+	if err := gorules.ValidateFixtures(req.Fixtures); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_fixtures", map[string]any{"details": err.Error()})
+		return
+	}
+
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		h, err := canonical.Hash(canonical.Current, policyContent{Document: doc, Fixtures: req.Fixtures})
+		if err != nil {
+			return 0, nil, err
+		}
+		fixtures := req.Fixtures
+		if fixtures == nil {
+			fixtures = []gorules.Fixture{}
+		}
+		rec := storage.PolicyRecord{
+			TenantID:      claims.TenantID,
+			PolicyVersion: req.PolicyVersion,
+			ContentHash:   h,
+			Description:   strings.TrimSpace(req.Description),
+			Document:      doc,
+			Fixtures:      mustJSON(fixtures),
+		}
+		created, existingHash, err := s.store.SavePolicy(r.Context(), rec)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !created && existingHash != h {
+			return httpstd.StatusConflict, mustJSON(map[string]any{
+				"error":          "policy_immutable",
+				"policy_version": req.PolicyVersion,
+				"content_hash":   existingHash,
+			}), nil
+		}
+		status := httpstd.StatusCreated
+		if !created {
+			status = httpstd.StatusOK
+		}
+		stored, _, err := s.store.GetPolicy(r.Context(), claims.TenantID, req.PolicyVersion)
+		if err != nil {
+			return 0, nil, err
+		}
+		return status, mustJSON(map[string]any{
+			"policy":  newPolicyView(stored),
+			"created": created,
+		}), nil
+	})
+}
+
+func (s *Server) handleListPolicies(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	recs, err := s.store.ListPolicies(r.Context(), claims.TenantID)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "policy_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"tenant_id":              claims.TenantID,
+		"default_policy_version": s.engine.PolicyVersion,
+		"policies":               recs,
+	})
+}
+
+func (s *Server) handleGetPolicy(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	rec, found, err := s.store.GetPolicy(r.Context(), claims.TenantID, r.PathValue("version"))
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "policy_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	if !found {
+		writeError(w, httpstd.StatusNotFound, "policy_not_found", nil)
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, newPolicyView(rec))
+}
+
+// handleTestPolicy runs a policy version's fixtures and reports each as a
+// check, in the same shape as app verify reports. Nothing is stored.
+func (s *Server) handleTestPolicy(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	rec, found, err := s.store.GetPolicy(r.Context(), claims.TenantID, r.PathValue("version"))
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "policy_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	if !found {
+		writeError(w, httpstd.StatusNotFound, "policy_not_found", nil)
+		return
+	}
+	report, err := s.testPolicy(r.Context(), rec)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "policy_test_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, report)
+}
+
+// testPolicy evaluates every fixture through the policy client, so tests
+// exercise the same model loading and evaluation path decisions use.
+func (s *Server) testPolicy(ctx context.Context, rec storage.PolicyRecord) (map[string]any, error) {
+	var fixtures []gorules.Fixture
+	if err := json.Unmarshal(rec.Fixtures, &fixtures); err != nil {
+		return nil, err
+	}
+	checks := []map[string]any{}
+	verdict := "pass"
+	// Fixtures check the published document itself, so they run in-process
+	// even for tenants that evaluate on a remote agent.
+	for _, res := range gorules.RunFixtures(ctx, s.jdm, rec.TenantID, rec.PolicyVersion, fixtures) {
+		check := map[string]any{
+			"id":       "fixture:" + res.Name,
+			"status":   passFail(res.Passed),
+			"evidence": "expected outputs matched",
+		}
+		switch {
+		case res.Error != "":
+			check["evidence"] = "evaluation failed: " + res.Error
+		case len(res.Mismatches) > 0:
+			check["evidence"] = gorules.FormatMismatches(res.Mismatches)
+			check["mismatches"] = res.Mismatches
+		}
+		if !res.Passed {
+			verdict = "fail"
+		}
+		checks = append(checks, check)
+	}
+	return map[string]any{
+		"report_id":      stableID("ptr", rec.TenantID, rec.PolicyVersion, rec.ContentHash),
+		"tenant_id":      rec.TenantID,
+		"policy_version": rec.PolicyVersion,
+		"content_hash":   rec.ContentHash,
+		"verdict":        verdict,
+		"checks":         checks,
+		"generated_at":   time.Now().UTC(),
+	}, nil
+}
+
+// handleActivatePolicy points a tenant surface at a policy version, now or at
+// activate_at. Surface "" sets the tenant-wide pointer that surfaces without
+// their own activation fall back to. The version must be published as a
+// policy or rule set, or be the server default, and a published policy must
+// pass its fixtures.
+func (s *Server) handleActivatePolicy(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	version := r.PathValue("version")
+
+	var req activatePolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	req.Surface = strings.TrimSpace(req.Surface)
+	now := time.Now().UTC()
+	activateAt := now
+	if req.ActivateAt != nil {
+		activateAt = req.ActivateAt.UTC()
+		// Backdated activations would rewrite which version past decisions
+		// ran under.
+		if activateAt.Before(now.Add(-time.Minute)) {
+			writeError(w, httpstd.StatusBadRequest, "invalid_activate_at", map[string]any{"details": "activate_at must not be in the past"})
+			return
+		}
+		if activateAt.Before(now) {
+			activateAt = now
+		}
+	}
+
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		// A published policy is gated on its fixtures even when it shares the
+		// server default's version; only the built-in default, which has no
+		// stored record, skips the gate.
+		policy, policyFound, err := s.store.GetPolicy(r.Context(), claims.TenantID, version)
+		if err != nil {
+			return 0, nil, err
+		}
+		if policyFound {
+			report, err := s.testPolicy(r.Context(), policy)
+			if err != nil {
+				return 0, nil, err
+			}
+			if report["verdict"] != "pass" {
+				return httpstd.StatusUnprocessableEntity, mustJSON(map[string]any{
+					"error":          "policy_tests_failed",
+					"policy_version": version,
+					"report":         report,
+				}), nil
+			}
+		} else if version != s.engine.PolicyVersion {
+			_, rulesFound, err := s.store.GetRuleSet(r.Context(), claims.TenantID, version)
+			if err != nil {
+				return 0, nil, err
+			}
+			if !rulesFound {
+				return httpstd.StatusUnprocessableEntity, mustJSON(map[string]any{
+					"error":          "policy_not_found",
+					"policy_version": version,
+				}), nil
+			}
+		}
+		rec := storage.PolicyActivation{
+			ActivationID:  stableID("act", claims.TenantID, idemKey),
+			TenantID:      claims.TenantID,
+			Surface:       req.Surface,
+			PolicyVersion: version,
+			ActivateAt:    activateAt,
+			Actor:         claims.Subject,
+		}
+		if err := s.store.CreateActivation(r.Context(), rec); err != nil {
+			return 0, nil, err
+		}
+		active, err := s.engine.ActivePolicyVersion(r.Context(), claims.TenantID, req.Surface)
+		if err != nil {
+			return 0, nil, err
+		}
+		return httpstd.StatusOK, mustJSON(map[string]any{
+			"activation":            rec,
+			"scheduled":             activateAt.After(now),
+			"active_policy_version": active,
+		}), nil
+	})
+}
+
+// handleRollbackPolicy cancels the activation in effect on a surface's own
+// pointer, and any scheduled after it, so the surface reverts at once to the
+// version active before.
+func (s *Server) handleRollbackPolicy(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	var req rollbackPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	req.Surface = strings.TrimSpace(req.Surface)
+
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		canceled, err := s.store.RollbackActivation(r.Context(), claims.TenantID, req.Surface, time.Now().UTC())
+		if errors.Is(err, storage.ErrNoActivation) {
+			return httpstd.StatusNotFound, mustJSON(map[string]any{
+				"error":   "no_activation",
+				"surface": req.Surface,
+			}), nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		active, err := s.engine.ActivePolicyVersion(r.Context(), claims.TenantID, req.Surface)
+		if err != nil {
+			return 0, nil, err
+		}
+		return httpstd.StatusOK, mustJSON(map[string]any{
+			"rolled_back":           canceled,
+			"active_policy_version": active,
+		}), nil
+	})
+}
+
+// handleListActivations reports the version currently active on a surface
+// and the activation history behind it, scheduled and rolled back entries
+// included.
+func (s *Server) handleListActivations(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	surface := strings.TrimSpace(r.URL.Query().Get("surface"))
+	limit := 50
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 200 {
+			writeError(w, httpstd.StatusBadRequest, "invalid_limit", map[string]any{"max": 200})
+			return
+		}
+		limit = n
+	}
+	active, err := s.engine.ActivePolicyVersion(r.Context(), claims.TenantID, surface)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "policy_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	recs, err := s.store.ListActivations(r.Context(), claims.TenantID, surface, limit)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "policy_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"tenant_id":             claims.TenantID,
+		"surface":               surface,
+		"active_policy_version": active,
+		"activations":           recs,
+	})
+}
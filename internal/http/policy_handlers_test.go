@@ -0,0 +1,38 @@
+package http
+
+import (
+	httpstd "net/http"
+	"testing"
+	"time"
+)
+
+func TestPublishPolicyValidatesRequest(t *testing.T) {
+	s := newTestServer(t, "t1", nil)
+	idem := map[string]string{"Idempotency-Key": "publish-1"}
+	cases := []struct {
+		body    any
+		headers map[string]string
+		want    string
+	}{
+		{map[string]any{"policy_version": "p2"}, nil, "missing_idempotency_key"},
+		{"{", idem, "invalid_json"},
+		{map[string]any{"policy_version": "a/b", "document": map[string]any{}}, idem, "invalid_policy_version"},
+		{map[string]any{"policy_version": "p2"}, idem, "document_required"},
+		{map[string]any{"policy_version": "p2", "document": []int{1}}, idem, "invalid_policy_document"},
+	}
+	for _, tc := range cases {
+		code, out := serve(t, s.handlePublishPolicy, httpstd.MethodPost, "/v1/policies", tc.body, tc.headers)
+		if code != httpstd.StatusBadRequest || out["error"] != tc.want {
+			t.Fatalf("%v: got %d %v, want 400 %s", tc.body, code, out, tc.want)
+		}
+	}
+}
+
+func TestActivatePolicyRejectsBackdatedActivation(t *testing.T) {
+	s := newTestServer(t, "t1", nil)
+	body := map[string]any{"surface": "home", "activate_at": time.Now().Add(-time.Hour).UTC()}
+	code, out := serve(t, s.handleActivatePolicy, httpstd.MethodPost, "/v1/policies/p2/activate", body, map[string]string{"Idempotency-Key": "activate-1"})
+	if code != httpstd.StatusBadRequest || out["error"] != "invalid_activate_at" {
+		t.Fatalf("expected invalid_activate_at, got %d %v", code, out)
+	}
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"encoding/json"
+	httpstd "net/http"
+	"strings"
+
+	"github.com/restarone/violet-deterministic-api/internal/canonical"
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+)
+
+func (s *Server) handleCreateRuleSet(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	idemKey, ok := s.idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	var rs decision.RuleSet
+	if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	rs.PolicyVersion = strings.TrimSpace(rs.PolicyVersion)
+	if err := validateRuleSet(s.engine, rs); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_rule_set", map[string]any{"details": err.Error()})
+		return
+	}
+
+	s.withIdempotency(r.Context(), w, claims.TenantID, r.URL.Path, idemKey, func() (int, []byte, error) {
+		doc, err := json.Marshal(rs)
+		if err != nil {
+			return 0, nil, err
+		}
+		h := rs.Hash()
+		created, existingHash, err := s.store.SaveRuleSet(r.Context(), claims.TenantID, rs.PolicyVersion, h, doc)
+		if err != nil {
+			return 0, nil, err
+		}
+		// Rule sets stored before the current hash version keep their hash;
+		// compare under the version they were hashed with.
+		if !created && existingHash != rs.HashWith(canonical.HashVersion(existingHash)) {
+			return httpstd.StatusConflict, mustJSON(map[string]any{
+				"error":          "rule_set_immutable",
+				"policy_version": rs.PolicyVersion,
+				"rule_set_hash":  existingHash,
+			}), nil
+		}
+		status := httpstd.StatusCreated
+		if !created {
+			status, h = httpstd.StatusOK, existingHash
+		}
+		payload, err := json.Marshal(map[string]any{
+			"tenant_id":     claims.TenantID,
+			"rule_set":      rs,
+			"rule_set_hash": h,
+			"created":       created,
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+		return status, payload, nil
+	})
+}
+
+func (s *Server) handleGetRuleSet(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	version := strings.TrimSpace(r.PathValue("version"))
+	if version == "" {
+		writeError(w, httpstd.StatusBadRequest, "policy_version_required", nil)
+		return
+	}
+	raw, storedHash, found, err := s.store.GetRuleSetWithHash(r.Context(), claims.TenantID, version)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "rule_set_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	if !found {
+		writeError(w, httpstd.StatusNotFound, "rule_set_not_found", nil)
+		return
+	}
+	rs, err := decision.ParseRuleSet(raw)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "rule_set_decode_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	// "active" reports whether decisions on the surface query parameter (the
+	// tenant-wide pointer when empty) currently run under this version.
+	surface := strings.TrimSpace(r.URL.Query().Get("surface"))
+	active, err := s.engine.ActivePolicyVersion(r.Context(), claims.TenantID, surface)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "policy_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"tenant_id":     claims.TenantID,
+		"rule_set":      rs,
+		"rule_set_hash": storedHash,
+		"surface":       surface,
+		"active":        version == active,
+	})
+}
+
+// validateRuleSet checks the document and that every pipeline names stages
+// this engine registers.
+func validateRuleSet(engine *decision.Engine, rs decision.RuleSet) error {
+	if err := rs.Validate(); err != nil {
+		return err
+	}
+	return engine.ValidatePipelines(rs)
+}
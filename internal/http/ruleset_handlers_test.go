@@ -0,0 +1,47 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	httpstd "net/http"
+	"testing"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorules"
+	"github.com/restarone/violet-deterministic-api/internal/canonical"
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+)
+
+// surfaceActivations activates a policy version per surface.
+type surfaceActivations map[string]string
+
+func (a surfaceActivations) ActivePolicyVersion(_ context.Context, _, surface string, _ time.Time) (string, bool, error) {
+	version, ok := a[surface]
+	return version, ok, nil
+}
+
+func TestGetRuleSetReportsStoredHashAndActivation(t *testing.T) {
+	s, tenant := newStoreServer(t, nil)
+	s.engine = decision.NewEngine(s.cfg.PolicyVersion, s.cfg.DataVersion, nil, gorules.NewLocalClient(s.cfg.PolicyVersion),
+		decision.WithPolicyActivations(surfaceActivations{"home": "policy-v2"}))
+	rs := decision.RuleSet{PolicyVersion: "policy-v2", Pipelines: map[string][]string{"home": {"policy_eval", "rank"}}}
+	doc, _ := json.Marshal(rs)
+	// Stored before the current hash version: the stored hash is returned,
+	// not a rehash of the document.
+	legacyHash := rs.HashWith(canonical.V1)
+	if _, _, err := s.store.SaveRuleSet(context.Background(), tenant, rs.PolicyVersion, legacyHash, doc); err != nil {
+		t.Fatalf("save rule set: %v", err)
+	}
+
+	handler := withPathValue(s.handleGetRuleSet, "version", "policy-v2")
+	for target, want := range map[string]bool{
+		"/v1/rulesets/policy-v2?surface=home": true,
+		"/v1/rulesets/policy-v2?surface=feed": false,
+		"/v1/rulesets/policy-v2":              false,
+	} {
+		code, out := serve(t, handler, httpstd.MethodGet, target, nil, nil)
+		if code != httpstd.StatusOK || out["active"] != want || out["rule_set_hash"] != legacyHash {
+			t.Fatalf("%s: got %d %v, want active=%v and hash %s", target, code, out, want, legacyHash)
+		}
+	}
+}
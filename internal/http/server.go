@@ -16,7 +16,9 @@ import (
 	"github.com/restarone/violet-deterministic-api/internal/auth"
 	"github.com/restarone/violet-deterministic-api/internal/config"
 	"github.com/restarone/violet-deterministic-api/internal/decision"
+	"github.com/restarone/violet-deterministic-api/internal/feedback"
 	"github.com/restarone/violet-deterministic-api/internal/llm"
+	"github.com/restarone/violet-deterministic-api/internal/signing"
 	"github.com/restarone/violet-deterministic-api/internal/storage"
 	"github.com/restarone/violet-deterministic-api/internal/studio"
 )
@@ -28,8 +30,12 @@ type Server struct {
 	store  *storage.Store
 	auth   *auth.Authenticator
 	policy gorules.Client
+	jdm    *gorules.JDMClient
 	studio *studio.Service
 	llm    *llm.Service
+	outbox *feedback.Worker
+	gorse  *gorse.ResilientClient
+	signer *signing.Keyring
 
 	cleanupCtx    context.Context
 	cleanupCancel context.CancelFunc
@@ -45,15 +51,69 @@ func NewServer(cfg config.Config) (*Server, error) {
 	store.StartIdempotencyCleanup(ctx)
 
 	gorseClient := gorse.NewHTTPClient(cfg.GorseBaseURL, cfg.GorseAPIKey)
-	policyClient := gorules.NewLocalClient(cfg.PolicyVersion)
+	retrieval, err := gorse.NewResilientClient(gorseClient, gorse.ResilientConfig{
+		MaxAttempts:     cfg.GorseMaxAttempts,
+		BaseBackoff:     time.Duration(cfg.GorseRetryBaseMillis) * time.Millisecond,
+		AttemptTimeout:  time.Duration(cfg.GorseAttemptTimeoutMs) * time.Millisecond,
+		Deadline:        time.Duration(cfg.GorseDeadlineMs) * time.Millisecond,
+		BreakerFailures: cfg.GorseBreakerFailures,
+		BreakerOpenFor:  time.Duration(cfg.GorseBreakerOpenSeconds) * time.Second,
+		Fallbacks:       strings.Split(cfg.GorseFallbacks, ","),
+	})
+	if err != nil {
+		cancel()
+		_ = store.Close()
+		return nil, err
+	}
+	var signer *signing.Keyring
+	if cfg.SigningKeysDir != "" {
+		signer, err = signing.LoadKeyring(cfg.SigningKeysDir, cfg.SigningActiveKeyID)
+		if err != nil {
+			cancel()
+			_ = store.Close()
+			return nil, fmt.Errorf("signing keys: %w", err)
+		}
+	}
+	// Models published to the policy registry take precedence over files in
+	// GORULES_MODELS_DIR; versions with neither use the built-in local rules.
+	models := gorules.Sources{store}
+	if cfg.GoRulesModelsDir != "" {
+		models = append(models, gorules.DirSource{Dir: cfg.GoRulesModelsDir})
+	}
+	jdm := gorules.NewJDMClient(cfg.PolicyVersion, models)
+	// Tenants listed in GORULES_REMOTES evaluate on a GoRules agent and fall
+	// back to the in-process evaluator when it is unreachable.
+	var policyClient gorules.Client = jdm
+	if cfg.GoRulesRemotes != "" {
+		targets, err := gorules.ParseRemoteTargets(cfg.GoRulesRemotes)
+		if err != nil {
+			cancel()
+			_ = store.Close()
+			return nil, fmt.Errorf("gorules remotes: %w", err)
+		}
+		policyClient = gorules.NewRemoteClient(cfg.PolicyVersion, targets, jdm,
+			gorules.WithRemoteToken(cfg.GoRulesRemoteToken),
+			gorules.WithRemoteTimeout(time.Duration(cfg.GoRulesRemoteTimeoutMs)*time.Millisecond))
+	}
+
+	outbox := feedback.NewWorker(store, gorseClient, feedback.Config{
+		PollInterval: time.Duration(cfg.FeedbackOutboxPollSeconds) * time.Second,
+		BatchSize:    cfg.FeedbackOutboxBatchSize,
+		MaxAttempts:  cfg.FeedbackOutboxMaxAttempts,
+	})
+	outbox.Start(ctx)
 
 	s := &Server{
 		cfg:    cfg,
-		engine: decision.NewEngine(cfg.PolicyVersion, cfg.DataVersion, gorseClient, policyClient),
+		engine: decision.NewEngine(cfg.PolicyVersion, cfg.DataVersion, retrieval, policyClient, decision.WithRuleSets(store), decision.WithGorseSnapshots(store), decision.WithCatalog(store), decision.WithExperiments(store), decision.WithExposures(store), decision.WithPolicyActivations(store)),
 		store:  store,
 		auth:   auth.New(cfg.AuthTokens),
 		policy: policyClient,
+		jdm:    jdm,
 		studio: studio.NewService(studio.WithPersistence(store)),
+		outbox: outbox,
+		gorse:  retrieval,
+		signer: signer,
 		llm: llm.NewService(llm.Config{
 			DefaultProvider:      cfg.LLMDefaultProvider,
 			DefaultModel:         cfg.LLMDefaultModel,
@@ -67,15 +127,54 @@ func NewServer(cfg config.Config) (*Server, error) {
 		cleanupCtx:    ctx,
 		cleanupCancel: cancel,
 	}
+	s.startEvaluationSweep(ctx)
 
 	mux := httpstd.NewServeMux()
 	mux.Handle("GET /ui/", s.uiHandler())
 	mux.HandleFunc("GET /", s.handleUIRoot)
 
 	mux.HandleFunc("GET /v1/health", s.handleHealth)
+	mux.HandleFunc("GET /v1/keys", s.handleKeys)
+	mux.HandleFunc("GET /v1/decisions", s.handleListDecisions)
 	mux.HandleFunc("POST /v1/decisions", s.handleDecisions)
+	mux.HandleFunc("POST /v1/decisions:batch", s.handleBatchDecisions)
+	mux.HandleFunc("POST /v1/decisions/simulate", s.handleSimulateDecision)
 	mux.HandleFunc("POST /v1/replay", s.handleReplay)
 	mux.HandleFunc("POST /v1/feedback", s.handleFeedback)
+	mux.HandleFunc("GET /v1/feedback/aggregates", s.handleFeedbackAggregates)
+	mux.HandleFunc("GET /v1/feedback/outbox", s.handleFeedbackOutbox)
+	mux.HandleFunc("GET /v1/exposures", s.handleUserExposures)
+	mux.HandleFunc("GET /v1/decisions/{id}/feedback", s.handleDecisionFeedback)
+	mux.HandleFunc("POST /v1/shadow/decisions", s.handleShadowDecision)
+	mux.HandleFunc("GET /v1/shadow/report", s.handleShadowReport)
+	mux.HandleFunc("GET /v1/shadow/divergences", s.handleShadowDivergences)
+	mux.HandleFunc("GET /v1/catalog", s.handleGetCatalog)
+	mux.HandleFunc("GET /v1/catalog/items", s.handleListCatalogItems)
+	mux.HandleFunc("POST /v1/catalog/items:bulk", s.handleBulkCatalogItems)
+	mux.HandleFunc("GET /v1/catalog/items/{id}", s.handleGetCatalogItem)
+	mux.HandleFunc("PUT /v1/catalog/items/{id}", s.handlePutCatalogItem)
+	mux.HandleFunc("DELETE /v1/catalog/items/{id}", s.handleDeleteCatalogItem)
+	mux.HandleFunc("GET /v1/catalog/tags", s.handleListCatalogTags)
+	mux.HandleFunc("PUT /v1/catalog/tags/{tag}", s.handlePutCatalogTag)
+	mux.HandleFunc("DELETE /v1/catalog/tags/{tag}", s.handleDeleteCatalogTag)
+	mux.HandleFunc("POST /v1/experiments", s.handleCreateExperiment)
+	mux.HandleFunc("GET /v1/experiments", s.handleListExperiments)
+	mux.HandleFunc("GET /v1/experiments/{id}", s.handleGetExperiment)
+	mux.HandleFunc("POST /v1/experiments/{id}/stop", s.handleStopExperiment)
+	mux.HandleFunc("GET /v1/experiments/{id}/results", s.handleExperimentResults)
+	mux.HandleFunc("POST /v1/rulesets", s.handleCreateRuleSet)
+	mux.HandleFunc("GET /v1/rulesets/{version}", s.handleGetRuleSet)
+	mux.HandleFunc("POST /v1/policies", s.handlePublishPolicy)
+	mux.HandleFunc("GET /v1/policies", s.handleListPolicies)
+	mux.HandleFunc("GET /v1/policies/{version}", s.handleGetPolicy)
+	mux.HandleFunc("POST /v1/policies/{version}/test", s.handleTestPolicy)
+	mux.HandleFunc("POST /v1/policies/{version}/impact", s.handlePolicyImpact)
+	mux.HandleFunc("POST /v1/policies/{version}/activate", s.handleActivatePolicy)
+	mux.HandleFunc("POST /v1/policies:rollback", s.handleRollbackPolicy)
+	mux.HandleFunc("GET /v1/policies:activations", s.handleListActivations)
+	mux.HandleFunc("POST /v1/evaluations", s.handleCreateEvaluation)
+	mux.HandleFunc("GET /v1/evaluations", s.handleListEvaluations)
+	mux.HandleFunc("GET /v1/evaluations/{id}", s.handleGetEvaluation)
 
 	mux.HandleFunc("POST /v1/apps", s.handleCreateApp)
 	mux.HandleFunc("GET /v1/apps/{id}", s.handleGetApp)
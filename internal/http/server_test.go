@@ -0,0 +1,148 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	httpstd "net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorse"
+	"github.com/restarone/violet-deterministic-api/internal/adapters/gorules"
+	"github.com/restarone/violet-deterministic-api/internal/auth"
+	"github.com/restarone/violet-deterministic-api/internal/config"
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+const testToken = "test-token"
+
+// toggleGorse answers with a fixed ranking until it is marked down.
+type toggleGorse struct {
+	down bool
+}
+
+func (g *toggleGorse) Recommend(context.Context, string, int) ([]string, error) {
+	if g.down {
+		return nil, fmt.Errorf("gorse down")
+	}
+	return []string{"b", "a"}, nil
+}
+
+// assertNoLastGood fails if retrieval has cached a ranking for u1: with
+// Gorse down, its last_good fallback must come back empty.
+func assertNoLastGood(t *testing.T, upstream *toggleGorse, retrieval *gorse.ResilientClient) {
+	t.Helper()
+	upstream.down = true
+	defer func() { upstream.down = false }()
+	_, trace, _ := retrieval.RecommendTraced(context.Background(), "u1", 2)
+	if last := trace[len(trace)-1]; last.Source != "last_good" || last.Outcome != "empty" {
+		t.Fatalf("expected no last_good entry, got trace %+v", trace)
+	}
+}
+
+// newTestServer builds a server for tenant without a store, for handlers and
+// validation paths that never reach Postgres.
+func newTestServer(t *testing.T, tenant string, retrieval *gorse.ResilientClient, opts ...decision.Option) *Server {
+	t.Helper()
+	cfg := config.Config{PolicyVersion: "policy-v1", DataVersion: "data-v1", DecisionBatchConcurrency: 4}
+	var client gorse.Client
+	if retrieval != nil {
+		client = retrieval
+	}
+	return &Server{
+		cfg:    cfg,
+		engine: decision.NewEngine(cfg.PolicyVersion, cfg.DataVersion, client, gorules.NewLocalClient(cfg.PolicyVersion), opts...),
+		auth:   auth.New(testToken + ":" + tenant + ":tester"),
+		policy: gorules.NewLocalClient(cfg.PolicyVersion),
+		gorse:  retrieval,
+	}
+}
+
+// newStoreServer is newTestServer backed by the Postgres database named by
+// VDA_TEST_DATABASE_URL, under a tenant unique to the test run. Tests using
+// it are skipped when the variable is unset.
+func newStoreServer(t *testing.T, retrieval *gorse.ResilientClient) (*Server, string) {
+	t.Helper()
+	url := os.Getenv("VDA_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("VDA_TEST_DATABASE_URL not set")
+	}
+	store, err := storage.New(context.Background(), url, 0, 0)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	tenant := fmt.Sprintf("t_test_%d", time.Now().UnixNano())
+	s := newTestServer(t, tenant, retrieval, decision.WithGorseSnapshots(store))
+	s.store = store
+	s.jdm = gorules.NewJDMClient(s.cfg.PolicyVersion, gorules.Sources{store})
+	return s, tenant
+}
+
+func newTestRetrieval(t *testing.T, upstream gorse.Client) *gorse.ResilientClient {
+	t.Helper()
+	c, err := gorse.NewResilientClient(upstream, gorse.ResilientConfig{MaxAttempts: 1, Fallbacks: []string{"last_good"}})
+	if err != nil {
+		t.Fatalf("new retrieval client: %v", err)
+	}
+	return c
+}
+
+// withPathValue sets a path wildcard the mux would otherwise fill in.
+func withPathValue(handler httpstd.HandlerFunc, name, value string) httpstd.HandlerFunc {
+	return func(w httpstd.ResponseWriter, r *httpstd.Request) {
+		r.SetPathValue(name, value)
+		handler(w, r)
+	}
+}
+
+// serve runs handler on a request carrying the test token and decodes the
+// JSON response body.
+func serve(t *testing.T, handler httpstd.HandlerFunc, method, target string, body any, headers map[string]string) (int, map[string]any) {
+	t.Helper()
+	var raw []byte
+	switch b := body.(type) {
+	case nil:
+	case string:
+		raw = []byte(b)
+	default:
+		var err error
+		if raw, err = json.Marshal(b); err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(raw))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	var out map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, out
+}
+
+func TestAuthRejectsMissingAndUnknownTokens(t *testing.T) {
+	s := newTestServer(t, "t1", nil)
+	for header, want := range map[string]string{"": "missing_authorization_header", "Basic abc": "invalid_authorization_scheme", "Bearer nope": "invalid_token"} {
+		req := httptest.NewRequest(httpstd.MethodPost, "/v1/decisions/simulate", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		s.handleSimulateDecision(rec, req)
+		var out map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		if rec.Code/100 != 4 || out["error"] != want {
+			t.Fatalf("Authorization %q: got %d %v, want %s", header, rec.Code, out, want)
+		}
+	}
+}
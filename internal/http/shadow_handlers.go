@@ -0,0 +1,188 @@
+package http
+
+import (
+	"encoding/json"
+	httpstd "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+	"github.com/restarone/violet-deterministic-api/internal/storage"
+)
+
+// shadowParityThreshold is the replay mismatch ceiling from docs/DEPRECATION_PLAN.md.
+const shadowParityThreshold = 0.005
+
+type shadowDecisionRequest struct {
+	RequestID string                   `json:"request_id,omitempty"`
+	Request   decision.DecisionRequest `json:"request"`
+	Legacy    shadowLegacyOutput       `json:"legacy"`
+}
+
+type shadowLegacyOutput struct {
+	Items []decision.RankedItem `json:"items"`
+}
+
+// handleShadowDecision mirrors one legacy Violet decision. The engine runs
+// read-only, without persisting a decision, idempotency record or Gorse
+// snapshot, so mirrored traffic never pins the retrieval real decisions use;
+// only the comparison is stored.
+func (s *Server) handleShadowDecision(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+
+	var req shadowDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_json", nil)
+		return
+	}
+	if req.Request.TenantID == "" {
+		req.Request.TenantID = claims.TenantID
+	}
+	if req.Request.TenantID != claims.TenantID {
+		writeError(w, httpstd.StatusForbidden, "tenant_mismatch", nil)
+		return
+	}
+	if err := req.Request.Validate(); err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_decision_request", map[string]any{"details": err.Error()})
+		return
+	}
+
+	resp := s.engine.ReadOnly().Decide(r.Context(), req.Request)
+	legacy := decision.DecisionResponse{Items: req.Legacy.Items}
+	diff := decision.CompareDecisions(legacy, resp)
+	divergence := decision.RankDivergence(legacy.Items, resp.Items)
+
+	canonical, _ := json.Marshal(decision.CanonicalRequest(req.Request))
+	requestID := strings.TrimSpace(req.RequestID)
+	shadowKey := requestID
+	if shadowKey == "" {
+		legacyRaw, _ := json.Marshal(req.Legacy.Items)
+		shadowKey = string(canonical) + "|" + string(legacyRaw)
+	}
+	rec := storage.ShadowRecord{
+		ShadowID:      stableID("shd", claims.TenantID, shadowKey),
+		TenantID:      claims.TenantID,
+		RequestID:     requestID,
+		Surface:       req.Request.Surface,
+		UserID:        req.Request.UserID,
+		PolicyVersion: resp.PolicyVersion,
+		Mismatch:      diff.OrderChanged,
+		Divergence:    divergence,
+		Request:       canonical,
+		Legacy:        mustJSON(req.Legacy.Items),
+		Engine:        mustJSON(resp),
+		Diff:          mustJSON(diff),
+		CreatedAt:     time.Now().UTC(),
+	}
+	if err := s.store.SaveShadowDecision(r.Context(), rec); err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "shadow_write_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"shadow_id":  rec.ShadowID,
+		"request_id": requestID,
+		"mismatch":   rec.Mismatch,
+		"divergence": divergence,
+		"diff":       diff,
+		"engine":     resp,
+	})
+}
+
+func (s *Server) handleShadowReport(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := parseTimeWindow(r, defaultFeedbackWindow)
+	if err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_time_window", map[string]any{"details": err.Error()})
+		return
+	}
+	rows, err := s.store.ShadowParity(r.Context(), claims.TenantID, from, to)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "shadow_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+
+	var total, mismatches int64
+	groups := make([]map[string]any, 0, len(rows))
+	for _, row := range rows {
+		total += row.Total
+		mismatches += row.Mismatches
+		groups = append(groups, map[string]any{
+			"surface":         row.Surface,
+			"policy_version":  row.PolicyVersion,
+			"total":           row.Total,
+			"mismatches":      row.Mismatches,
+			"mismatch_rate":   row.MismatchRate,
+			"mean_divergence": row.MeanDivergence,
+			"parity_gate":     passFail(row.MismatchRate <= shadowParityThreshold),
+		})
+	}
+	rate := 0.0
+	if total > 0 {
+		rate = float64(mismatches) / float64(total)
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"tenant_id":      claims.TenantID,
+		"from":           from,
+		"to":             to,
+		"total":          total,
+		"mismatches":     mismatches,
+		"mismatch_rate":  rate,
+		"threshold":      shadowParityThreshold,
+		"parity_gate":    passFail(total > 0 && rate <= shadowParityThreshold),
+		"groups":         groups,
+		"policy_version": s.cfg.PolicyVersion,
+	})
+}
+
+func (s *Server) handleShadowDivergences(w httpstd.ResponseWriter, r *httpstd.Request) {
+	claims, ok := s.authClaims(w, r)
+	if !ok {
+		return
+	}
+	from, to, err := parseTimeWindow(r, defaultFeedbackWindow)
+	if err != nil {
+		writeError(w, httpstd.StatusBadRequest, "invalid_time_window", map[string]any{"details": err.Error()})
+		return
+	}
+	limit := 20
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 200 {
+			writeError(w, httpstd.StatusBadRequest, "invalid_limit", map[string]any{"max": 200})
+			return
+		}
+		limit = n
+	}
+	recs, err := s.store.WorstShadowDecisions(r.Context(), claims.TenantID, strings.TrimSpace(r.URL.Query().Get("surface")), from, to, limit)
+	if err != nil {
+		writeError(w, httpstd.StatusInternalServerError, "shadow_read_failed", map[string]any{"details": err.Error()})
+		return
+	}
+	out := make([]map[string]any, 0, len(recs))
+	for _, rec := range recs {
+		out = append(out, map[string]any{
+			"shadow_id":      rec.ShadowID,
+			"request_id":     rec.RequestID,
+			"surface":        rec.Surface,
+			"user_id":        rec.UserID,
+			"policy_version": rec.PolicyVersion,
+			"divergence":     rec.Divergence,
+			"created_at":     rec.CreatedAt,
+			"legacy_items":   json.RawMessage(rec.Legacy),
+			"diff":           json.RawMessage(rec.Diff),
+		})
+	}
+	writeJSONValue(w, httpstd.StatusOK, map[string]any{
+		"tenant_id":   claims.TenantID,
+		"from":        from,
+		"to":          to,
+		"divergences": out,
+	})
+}
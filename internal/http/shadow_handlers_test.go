@@ -0,0 +1,54 @@
+package http
+
+import (
+	"context"
+	httpstd "net/http"
+	"testing"
+
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+)
+
+func TestShadowDecisionValidatesBeforeRunning(t *testing.T) {
+	s := newTestServer(t, "t1", nil)
+	mismatched := testDecisionRequest()
+	mismatched.TenantID = "t2"
+	invalid := testDecisionRequest()
+	invalid.Catalog = &decision.CatalogSelector{ItemIDs: []string{"a"}}
+	cases := []struct {
+		body any
+		code int
+		want string
+	}{
+		{"{", httpstd.StatusBadRequest, "invalid_json"},
+		{shadowDecisionRequest{Request: mismatched}, httpstd.StatusForbidden, "tenant_mismatch"},
+		{shadowDecisionRequest{Request: invalid}, httpstd.StatusBadRequest, "invalid_decision_request"},
+	}
+	for _, tc := range cases {
+		code, out := serve(t, s.handleShadowDecision, httpstd.MethodPost, "/v1/shadow/decisions", tc.body, nil)
+		if code != tc.code || out["error"] != tc.want {
+			t.Fatalf("got %d %v, want %d %s", code, out, tc.code, tc.want)
+		}
+	}
+	if code, out := serve(t, s.handleShadowDivergences, httpstd.MethodGet, "/v1/shadow/divergences?limit=201", nil, nil); code != httpstd.StatusBadRequest || out["error"] != "invalid_limit" {
+		t.Fatalf("expected invalid_limit, got %d %v", code, out)
+	}
+}
+
+func TestShadowDecisionIsReadOnly(t *testing.T) {
+	upstream := &toggleGorse{}
+	retrieval := newTestRetrieval(t, upstream)
+	s, tenant := newStoreServer(t, retrieval)
+
+	code, out := serve(t, s.handleShadowDecision, httpstd.MethodPost, "/v1/shadow/decisions", shadowDecisionRequest{
+		RequestID: "req-1",
+		Request:   testDecisionRequest(),
+		Legacy:    shadowLegacyOutput{Items: []decision.RankedItem{{ItemID: "a"}, {ItemID: "b"}}},
+	}, nil)
+	if code != httpstd.StatusOK || out["shadow_id"] == "" || out["mismatch"] != true {
+		t.Fatalf("unexpected shadow response %d %v", code, out)
+	}
+	if _, found, err := s.store.GetGorseSnapshot(context.Background(), tenant, "u1", s.engine.DataVersion); err != nil || found {
+		t.Fatalf("expected no Gorse snapshot stored, got found=%v err=%v", found, err)
+	}
+	assertNoLastGood(t, upstream, retrieval)
+}
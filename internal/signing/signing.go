@@ -0,0 +1,243 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/restarone/violet-deterministic-api/internal/canonical"
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+)
+
+// Alg is the JOSE name of the signature algorithm.
+const Alg = "EdDSA"
+
+var (
+	ErrUnsigned     = errors.New("decision_unsigned")
+	ErrUnknownKey   = errors.New("unknown_key_id")
+	ErrBadSignature = errors.New("signature_mismatch")
+)
+
+// Keyring holds the Ed25519 keys decisions are signed and verified with.
+// Only the active key signs; every key, including retired public-only keys,
+// still verifies and is published so older signatures stay checkable after a
+// rotation.
+type Keyring struct {
+	active  string
+	private map[string]ed25519.PrivateKey
+	public  map[string]ed25519.PublicKey
+}
+
+// JWK is an Ed25519 public key in RFC 8037 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	Kid string `json:"kid"`
+	X   string `json:"x"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+// NewKeyring builds a keyring from signing keys and verify-only retired keys.
+// An empty activeKeyID selects the greatest signing key ID, so date-stamped
+// IDs rotate by adding a newer key.
+func NewKeyring(activeKeyID string, keys map[string]ed25519.PrivateKey, retired map[string]ed25519.PublicKey) (*Keyring, error) {
+	k := &Keyring{private: map[string]ed25519.PrivateKey{}, public: map[string]ed25519.PublicKey{}}
+	for kid, pub := range retired {
+		k.public[kid] = pub
+	}
+	for kid, priv := range keys {
+		k.private[kid] = priv
+		k.public[kid] = priv.Public().(ed25519.PublicKey)
+		if activeKeyID == "" && kid > k.active {
+			k.active = kid
+		}
+	}
+	if activeKeyID != "" {
+		k.active = activeKeyID
+	}
+	if _, ok := k.private[k.active]; !ok {
+		return nil, fmt.Errorf("no private key for active key id %q", k.active)
+	}
+	return k, nil
+}
+
+// LoadKeyring reads keys from dir. `<kid>.pem` files hold PKCS#8 private
+// keys (as written by `openssl genpkey -algorithm ed25519`); `<kid>.pub.pem`
+// files hold PKIX public keys of retired signing keys.
+func LoadKeyring(dir, activeKeyID string) (*Keyring, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]ed25519.PrivateKey{}
+	retired := map[string]ed25519.PublicKey{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".pem") {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(raw)
+		if block == nil {
+			return nil, fmt.Errorf("%s: no PEM block", name)
+		}
+		if kid, ok := strings.CutSuffix(name, ".pub.pem"); ok {
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			edPub, ok := pub.(ed25519.PublicKey)
+			if !ok {
+				return nil, fmt.Errorf("%s: not an Ed25519 public key", name)
+			}
+			retired[kid] = edPub
+			continue
+		}
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		edPriv, ok := priv.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: not an Ed25519 private key", name)
+		}
+		keys[strings.TrimSuffix(name, ".pem")] = edPriv
+	}
+	return NewKeyring(activeKeyID, keys, retired)
+}
+
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// SignDecision signs resp with the active key. The signature covers the
+// decision ID, hash, versions and a digest of the returned items, not the
+// response bytes, so it survives re-encoding and is reproducible from a
+// recomputed decision.
+func (k *Keyring) SignDecision(resp *decision.DecisionResponse) {
+	sig := ed25519.Sign(k.private[k.active], SigningInput(*resp, k.active))
+	resp.Signature = &decision.Signature{
+		KeyID: k.active,
+		Alg:   Alg,
+		Value: base64.RawURLEncoding.EncodeToString(sig),
+	}
+}
+
+// VerifyDecision checks resp's signature against the keyring.
+func (k *Keyring) VerifyDecision(resp decision.DecisionResponse) error {
+	if resp.Signature == nil {
+		return ErrUnsigned
+	}
+	pub, ok := k.public[resp.Signature.KeyID]
+	if !ok || resp.Signature.Alg != Alg {
+		return ErrUnknownKey
+	}
+	return Verify(pub, resp)
+}
+
+// Verify checks resp's signature with pub. Offline consumers use it with a
+// key fetched from the published key set.
+func Verify(pub ed25519.PublicKey, resp decision.DecisionResponse) error {
+	if resp.Signature == nil {
+		return ErrUnsigned
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(resp.Signature.Value)
+	if err != nil || !ed25519.Verify(pub, SigningInput(resp, resp.Signature.KeyID), sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// JWKS lists every public key ordered by key ID.
+func (k *Keyring) JWKS() []JWK {
+	kids := make([]string, 0, len(k.public))
+	for kid := range k.public {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	out := make([]JWK, 0, len(kids))
+	for _, kid := range kids {
+		out = append(out, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			Kid: kid,
+			X:   base64.RawURLEncoding.EncodeToString(k.public[kid]),
+			Use: "sig",
+			Alg: Alg,
+		})
+	}
+	return out
+}
+
+type signedFields struct {
+	Alg           string `json:"alg"`
+	KeyID         string `json:"kid"`
+	DecisionID    string `json:"decision_id"`
+	DecisionHash  string `json:"decision_hash"`
+	PolicyVersion string `json:"policy_version"`
+	DataVersion   string `json:"data_version"`
+	RuleSetHash   string `json:"rule_set_hash"`
+	OutputDigest  string `json:"output_digest"`
+}
+
+// signedOutput is the part of a response the output digest covers: the
+// returned items in order with their scores, and the removed items.
+// Explanations are operational detail and stay out, as they do for the
+// decision hash.
+type signedOutput struct {
+	Items   []signedItem           `json:"items"`
+	Removed []decision.RemovedItem `json:"removed"`
+}
+
+type signedItem struct {
+	ItemID string  `json:"item_id"`
+	Score  float64 `json:"score"`
+}
+
+// SigningInput is the message a decision signature covers: the RFC 8785
+// canonical JSON of
+//
+//	{"alg", "kid", "decision_id", "decision_hash", "policy_version",
+//	 "data_version", "rule_set_hash", "output_digest"}
+//
+// where output_digest is the "v2:"-prefixed SHA-256 of the canonical JSON
+// {"items": [{"item_id", "score"}...], "removed": [{"item_id", "reason",
+// "tag"?}...]}, with both lists in response order and empty lists as [].
+func SigningInput(resp decision.DecisionResponse, keyID string) []byte {
+	b, _ := canonical.Marshal(signedFields{
+		Alg:           Alg,
+		KeyID:         keyID,
+		DecisionID:    resp.DecisionID,
+		DecisionHash:  resp.DecisionHash,
+		PolicyVersion: resp.PolicyVersion,
+		DataVersion:   resp.DataVersion,
+		RuleSetHash:   resp.RuleSetHash,
+		OutputDigest:  OutputDigest(resp),
+	})
+	return b
+}
+
+// OutputDigest hashes the ranked and removed items of resp, so a signature
+// breaks when a stored or relayed response is reordered or rescored.
+func OutputDigest(resp decision.DecisionResponse) string {
+	out := signedOutput{
+		Items:   make([]signedItem, 0, len(resp.Items)),
+		Removed: append([]decision.RemovedItem{}, resp.Removed...),
+	}
+	for _, item := range resp.Items {
+		out.Items = append(out.Items, signedItem{ItemID: item.ItemID, Score: item.Score})
+	}
+	h, _ := canonical.Hash(canonical.V2, out)
+	return h
+}
@@ -0,0 +1,159 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restarone/violet-deterministic-api/internal/decision"
+)
+
+func seededKey(b byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(bytes.Repeat([]byte{b}, ed25519.SeedSize))
+}
+
+func sampleDecision() decision.DecisionResponse {
+	return decision.DecisionResponse{
+		DecisionID:    "dec_0123456789abcdef",
+		DecisionHash:  "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		PolicyVersion: "policy-v1",
+		DataVersion:   "data-v1",
+		RuleSetHash:   "rs",
+		Items:         []decision.RankedItem{{ItemID: "a", Score: 2.5}, {ItemID: "b", Score: 1}},
+		Removed:       []decision.RemovedItem{{ItemID: "c", Reason: "blocked_tag", Tag: "promo"}},
+	}
+}
+
+func TestSignAndVerifyRoundTripThroughJSON(t *testing.T) {
+	k, err := NewKeyring("", map[string]ed25519.PrivateKey{"2026-01": seededKey(1), "2026-06": seededKey(2)}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if k.ActiveKeyID() != "2026-06" {
+		t.Fatalf("expected newest key to be active, got %s", k.ActiveKeyID())
+	}
+	resp := sampleDecision()
+	k.SignDecision(&resp)
+	raw, _ := json.Marshal(resp)
+	var decoded decision.DecisionResponse
+	_ = json.Unmarshal(raw, &decoded)
+	if err := k.VerifyDecision(decoded); err != nil {
+		t.Fatalf("expected signature to verify, got %v", err)
+	}
+
+	again := sampleDecision()
+	k.SignDecision(&again)
+	if again.Signature.Value != resp.Signature.Value {
+		t.Fatalf("expected deterministic signature")
+	}
+
+	decoded.PolicyVersion = "policy-v2"
+	if err := k.VerifyDecision(decoded); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected tampered versions to fail, got %v", err)
+	}
+}
+
+func TestSignatureCoversReturnedItems(t *testing.T) {
+	k, _ := NewKeyring("", map[string]ed25519.PrivateKey{"2026-06": seededKey(2)}, nil)
+	resp := sampleDecision()
+	k.SignDecision(&resp)
+
+	reordered := resp
+	reordered.Items = []decision.RankedItem{resp.Items[1], resp.Items[0]}
+	rescored := resp
+	rescored.Items = []decision.RankedItem{{ItemID: "a", Score: 9}, resp.Items[1]}
+	unremoved := resp
+	unremoved.Removed = nil
+	for name, tampered := range map[string]decision.DecisionResponse{"reordered": reordered, "rescored": rescored, "removals": unremoved} {
+		if err := k.VerifyDecision(tampered); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("expected %s output to fail, got %v", name, err)
+		}
+	}
+
+	explained := resp
+	explained.Items = []decision.RankedItem{{ItemID: "a", Score: 2.5, Explanation: &decision.ItemExplanation{BaseScore: 2}}, resp.Items[1]}
+	if err := k.VerifyDecision(explained); err != nil {
+		t.Fatalf("expected explanations to stay outside the signature, got %v", err)
+	}
+}
+
+func TestSigningInputIsCanonicalJSON(t *testing.T) {
+	resp := sampleDecision()
+	resp.DecisionID = "dec_<&>"
+	want := `{"alg":"EdDSA","data_version":"data-v1","decision_hash":"` + resp.DecisionHash +
+		`","decision_id":"dec_<&>","kid":"k1","output_digest":"` + OutputDigest(resp) +
+		`","policy_version":"policy-v1","rule_set_hash":"rs"}`
+	if got := string(SigningInput(resp, "k1")); got != want {
+		t.Fatalf("unexpected signing input:\n got %s\nwant %s", got, want)
+	}
+
+	sum := sha256.Sum256([]byte(`{"items":[{"item_id":"a","score":2.5},{"item_id":"b","score":1}],"removed":[{"item_id":"c","reason":"blocked_tag","tag":"promo"}]}`))
+	if got, want := OutputDigest(resp), "v2:"+hex.EncodeToString(sum[:]); got != want {
+		t.Fatalf("unexpected output digest %s, want %s", got, want)
+	}
+}
+
+func TestRetiredKeyStillVerifies(t *testing.T) {
+	old, _ := NewKeyring("2026-01", map[string]ed25519.PrivateKey{"2026-01": seededKey(1)}, nil)
+	resp := sampleDecision()
+	old.SignDecision(&resp)
+
+	rotated, err := NewKeyring("", map[string]ed25519.PrivateKey{"2026-06": seededKey(2)}, map[string]ed25519.PublicKey{
+		"2026-01": seededKey(1).Public().(ed25519.PublicKey),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := rotated.VerifyDecision(resp); err != nil {
+		t.Fatalf("expected retired key to verify, got %v", err)
+	}
+	jwks := rotated.JWKS()
+	if len(jwks) != 2 || jwks[0].Kid != "2026-01" || jwks[1].Kid != "2026-06" {
+		t.Fatalf("expected both keys published in kid order, got %#v", jwks)
+	}
+	x, _ := base64.RawURLEncoding.DecodeString(jwks[0].X)
+	if err := Verify(ed25519.PublicKey(x), resp); err != nil {
+		t.Fatalf("expected published key to verify offline, got %v", err)
+	}
+
+	resp.Signature.KeyID = "missing"
+	if err := rotated.VerifyDecision(resp); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected unknown key, got %v", err)
+	}
+}
+
+func TestLoadKeyringFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	der, _ := x509.MarshalPKCS8PrivateKey(seededKey(2))
+	writePEM(t, filepath.Join(dir, "2026-06.pem"), "PRIVATE KEY", der)
+	pubDER, _ := x509.MarshalPKIXPublicKey(seededKey(1).Public())
+	writePEM(t, filepath.Join(dir, "2026-01.pub.pem"), "PUBLIC KEY", pubDER)
+	_ = os.WriteFile(filepath.Join(dir, "README"), []byte("ignored"), 0o600)
+
+	k, err := LoadKeyring(dir, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if k.ActiveKeyID() != "2026-06" || len(k.JWKS()) != 2 {
+		t.Fatalf("unexpected keyring: active=%s keys=%d", k.ActiveKeyID(), len(k.JWKS()))
+	}
+	if _, err := LoadKeyring(dir, "2026-01"); err == nil {
+		t.Fatalf("expected error when the active key has no private part")
+	}
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,420 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CatalogItem is one tenant catalog entry. Revision is the catalog revision
+// that last changed it.
+type CatalogItem struct {
+	ItemID    string   `json:"item_id"`
+	BaseScore float64  `json:"base_score"`
+	Tags      []string `json:"tags,omitempty"`
+	Revision  int64    `json:"revision"`
+}
+
+// CatalogTag is a node of the tenant tag taxonomy. A segment named after a
+// tag covers items carrying that tag or any of its descendants.
+type CatalogTag struct {
+	Tag         string `json:"tag"`
+	Parent      string `json:"parent,omitempty"`
+	Description string `json:"description,omitempty"`
+	Revision    int64  `json:"revision"`
+}
+
+var (
+	ErrCatalogTagCycle     = errors.New("catalog tag parent would create a cycle")
+	ErrCatalogParentAbsent = errors.New("catalog parent tag not found")
+)
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// CatalogRevision returns the tenant's current catalog revision, 0 when the
+// tenant has never written to its catalog.
+func (s *Store) CatalogRevision(ctx context.Context, tenantID string) (int64, error) {
+	var rev int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT revision FROM catalog_versions WHERE tenant_id = $1
+	`, tenantID).Scan(&rev)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return rev, err
+}
+
+// UpsertCatalogItems writes every changed item under a single new revision.
+// Items identical to their current state are skipped; when nothing changes
+// the revision is not bumped. It returns the resulting revision and the number
+// of items written.
+func (s *Store) UpsertCatalogItems(ctx context.Context, tenantID string, items []CatalogItem) (int64, int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rev, err := lockCatalogRevision(ctx, tx, tenantID)
+	if err != nil {
+		return 0, 0, err
+	}
+	current, err := catalogItemsAt(ctx, tx, tenantID, rev)
+	if err != nil {
+		return 0, 0, err
+	}
+	byID := make(map[string]CatalogItem, len(current))
+	for _, it := range current {
+		byID[it.ItemID] = it
+	}
+
+	// Later entries for the same item_id win.
+	last := make(map[string]int, len(items))
+	for i, it := range items {
+		last[it.ItemID] = i
+	}
+	changed := make([]CatalogItem, 0, len(items))
+	for i, it := range items {
+		if last[it.ItemID] != i {
+			continue
+		}
+		if prev, ok := byID[it.ItemID]; ok && prev.BaseScore == it.BaseScore && equalStrings(prev.Tags, it.Tags) {
+			continue
+		}
+		changed = append(changed, it)
+		byID[it.ItemID] = it
+	}
+	if len(changed) == 0 {
+		return rev, 0, tx.Commit()
+	}
+
+	next := rev + 1
+	for _, it := range changed {
+		tags, err := json.Marshal(it.Tags)
+		if err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO catalog_item_revisions (tenant_id, item_id, revision, base_score, tags, deleted, created_at)
+			VALUES ($1, $2, $3, $4, $5, FALSE, NOW())
+		`, tenantID, it.ItemID, next, it.BaseScore, tags); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := setCatalogRevision(ctx, tx, tenantID, next); err != nil {
+		return 0, 0, err
+	}
+	return next, len(changed), tx.Commit()
+}
+
+// DeleteCatalogItem tombstones an item under a new revision. It reports false
+// (without bumping) when the item does not exist.
+func (s *Store) DeleteCatalogItem(ctx context.Context, tenantID, itemID string) (int64, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rev, err := lockCatalogRevision(ctx, tx, tenantID)
+	if err != nil {
+		return 0, false, err
+	}
+	current, err := catalogItemsAt(ctx, tx, tenantID, rev)
+	if err != nil {
+		return 0, false, err
+	}
+	found := false
+	for _, it := range current {
+		if it.ItemID == itemID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return rev, false, tx.Commit()
+	}
+	next := rev + 1
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO catalog_item_revisions (tenant_id, item_id, revision, base_score, tags, deleted, created_at)
+		VALUES ($1, $2, $3, 0, '[]', TRUE, NOW())
+	`, tenantID, itemID, next); err != nil {
+		return 0, false, err
+	}
+	if err := setCatalogRevision(ctx, tx, tenantID, next); err != nil {
+		return 0, false, err
+	}
+	return next, true, tx.Commit()
+}
+
+// CatalogItems returns the live items as of revision, ordered by item_id.
+func (s *Store) CatalogItems(ctx context.Context, tenantID string, revision int64) ([]CatalogItem, error) {
+	return catalogItemsAt(ctx, s.db, tenantID, revision)
+}
+
+// UpsertCatalogTag writes a taxonomy node under a new revision unless it is
+// unchanged. Parents must already exist and may not create a cycle.
+func (s *Store) UpsertCatalogTag(ctx context.Context, tenantID string, tag CatalogTag) (int64, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rev, err := lockCatalogRevision(ctx, tx, tenantID)
+	if err != nil {
+		return 0, false, err
+	}
+	current, err := catalogTagsAt(ctx, tx, tenantID, rev)
+	if err != nil {
+		return 0, false, err
+	}
+	parents := make(map[string]string, len(current))
+	for _, t := range current {
+		parents[t.Tag] = t.Parent
+		if t.Tag == tag.Tag && t.Parent == tag.Parent && t.Description == tag.Description {
+			return rev, false, tx.Commit()
+		}
+	}
+	if tag.Parent != "" {
+		if _, ok := parents[tag.Parent]; !ok {
+			return 0, false, fmt.Errorf("%w: %q", ErrCatalogParentAbsent, tag.Parent)
+		}
+		for p := tag.Parent; p != ""; p = parents[p] {
+			if p == tag.Tag {
+				return 0, false, ErrCatalogTagCycle
+			}
+		}
+	}
+
+	next := rev + 1
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO catalog_tag_revisions (tenant_id, tag, revision, parent, description, deleted, created_at)
+		VALUES ($1, $2, $3, $4, $5, FALSE, NOW())
+	`, tenantID, tag.Tag, next, tag.Parent, tag.Description); err != nil {
+		return 0, false, err
+	}
+	if err := setCatalogRevision(ctx, tx, tenantID, next); err != nil {
+		return 0, false, err
+	}
+	return next, true, tx.Commit()
+}
+
+// DeleteCatalogTag tombstones a taxonomy node. Children keep their parent
+// pointer, so a segment named after the deleted tag still reaches them.
+func (s *Store) DeleteCatalogTag(ctx context.Context, tenantID, tag string) (int64, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rev, err := lockCatalogRevision(ctx, tx, tenantID)
+	if err != nil {
+		return 0, false, err
+	}
+	current, err := catalogTagsAt(ctx, tx, tenantID, rev)
+	if err != nil {
+		return 0, false, err
+	}
+	found := false
+	for _, t := range current {
+		if t.Tag == tag {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return rev, false, tx.Commit()
+	}
+	next := rev + 1
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO catalog_tag_revisions (tenant_id, tag, revision, parent, description, deleted, created_at)
+		VALUES ($1, $2, $3, '', '', TRUE, NOW())
+	`, tenantID, tag, next); err != nil {
+		return 0, false, err
+	}
+	if err := setCatalogRevision(ctx, tx, tenantID, next); err != nil {
+		return 0, false, err
+	}
+	return next, true, tx.Commit()
+}
+
+// CatalogTags returns the taxonomy as of revision, ordered by tag.
+func (s *Store) CatalogTags(ctx context.Context, tenantID string, revision int64) ([]CatalogTag, error) {
+	return catalogTagsAt(ctx, s.db, tenantID, revision)
+}
+
+// ResolveCatalog returns the JSON-encoded candidates for a decision: the
+// items listed in itemIDs, or every item in segment, as of revision.
+func (s *Store) ResolveCatalog(ctx context.Context, tenantID string, revision int64, segment string, itemIDs []string) ([]byte, error) {
+	items, err := catalogItemsAt(ctx, s.db, tenantID, revision)
+	if err != nil {
+		return nil, err
+	}
+	var keep func(CatalogItem) bool
+	if len(itemIDs) > 0 {
+		want := make(map[string]struct{}, len(itemIDs))
+		for _, id := range itemIDs {
+			want[id] = struct{}{}
+		}
+		keep = func(it CatalogItem) bool {
+			_, ok := want[it.ItemID]
+			return ok
+		}
+	} else {
+		tags, err := catalogTagsAt(ctx, s.db, tenantID, revision)
+		if err != nil {
+			return nil, err
+		}
+		members := SegmentTags(tags, segment)
+		keep = func(it CatalogItem) bool {
+			for _, t := range it.Tags {
+				if _, ok := members[t]; ok {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	type candidate struct {
+		ItemID    string   `json:"item_id"`
+		BaseScore float64  `json:"base_score"`
+		Tags      []string `json:"tags,omitempty"`
+	}
+	out := []candidate{}
+	for _, it := range items {
+		if keep(it) {
+			out = append(out, candidate{ItemID: it.ItemID, BaseScore: it.BaseScore, Tags: it.Tags})
+		}
+	}
+	return json.Marshal(out)
+}
+
+// SegmentTags returns segment plus every live descendant tag in the taxonomy.
+func SegmentTags(taxonomy []CatalogTag, segment string) map[string]struct{} {
+	children := map[string][]string{}
+	for _, t := range taxonomy {
+		if t.Parent != "" {
+			children[t.Parent] = append(children[t.Parent], t.Tag)
+		}
+	}
+	members := map[string]struct{}{segment: {}}
+	queue := []string{segment}
+	for len(queue) > 0 {
+		tag := queue[0]
+		queue = queue[1:]
+		for _, child := range children[tag] {
+			if _, seen := members[child]; seen {
+				continue
+			}
+			members[child] = struct{}{}
+			queue = append(queue, child)
+		}
+	}
+	return members
+}
+
+func lockCatalogRevision(ctx context.Context, tx *sql.Tx, tenantID string) (int64, error) {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO catalog_versions (tenant_id, revision, updated_at)
+		VALUES ($1, 0, NOW())
+		ON CONFLICT (tenant_id) DO NOTHING
+	`, tenantID); err != nil {
+		return 0, err
+	}
+	var rev int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT revision FROM catalog_versions WHERE tenant_id = $1 FOR UPDATE
+	`, tenantID).Scan(&rev)
+	return rev, err
+}
+
+func setCatalogRevision(ctx context.Context, tx *sql.Tx, tenantID string, revision int64) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE catalog_versions SET revision = $2, updated_at = NOW() WHERE tenant_id = $1
+	`, tenantID, revision)
+	return err
+}
+
+func catalogItemsAt(ctx context.Context, q queryer, tenantID string, revision int64) ([]CatalogItem, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT item_id, revision, base_score, tags
+		FROM (
+			SELECT DISTINCT ON (item_id) item_id, revision, base_score, tags, deleted
+			FROM catalog_item_revisions
+			WHERE tenant_id = $1 AND revision <= $2
+			ORDER BY item_id, revision DESC
+		) latest
+		WHERE NOT deleted
+		ORDER BY item_id
+	`, tenantID, revision)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []CatalogItem{}
+	for rows.Next() {
+		var it CatalogItem
+		var tags []byte
+		if err := rows.Scan(&it.ItemID, &it.Revision, &it.BaseScore, &tags); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(tags, &it.Tags); err != nil {
+			return nil, err
+		}
+		out = append(out, it)
+	}
+	return out, rows.Err()
+}
+
+func catalogTagsAt(ctx context.Context, q queryer, tenantID string, revision int64) ([]CatalogTag, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT tag, revision, parent, description
+		FROM (
+			SELECT DISTINCT ON (tag) tag, revision, parent, description, deleted
+			FROM catalog_tag_revisions
+			WHERE tenant_id = $1 AND revision <= $2
+			ORDER BY tag, revision DESC
+		) latest
+		WHERE NOT deleted
+		ORDER BY tag
+	`, tenantID, revision)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []CatalogTag{}
+	for rows.Next() {
+		var t CatalogTag
+		if err := rows.Scan(&t.Tag, &t.Revision, &t.Parent, &t.Description); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// DecisionSummary is a listed decision: its promoted columns without the
+// stored payloads.
+type DecisionSummary struct {
+	DecisionID       string    `json:"decision_id"`
+	DecisionHash     string    `json:"decision_hash"`
+	Surface          string    `json:"surface"`
+	UserID           string    `json:"user_id"`
+	PolicyVersion    string    `json:"policy_version"`
+	DataVersion      string    `json:"data_version"`
+	DependencyStatus string    `json:"dependency_status"`
+	ExperimentID     string    `json:"experiment_id,omitempty"`
+	Variant          string    `json:"variant,omitempty"`
+	ItemCount        int       `json:"item_count"`
+	GeneratedAt      time.Time `json:"generated_at"`
+}
+
+// DecisionFilter narrows ListDecisions. Empty strings match everything.
+// Results are ordered newest first; when AfterID is set only decisions
+// strictly before (AfterGeneratedAt, AfterID) in that order are returned.
+type DecisionFilter struct {
+	From             time.Time
+	To               time.Time
+	Surface          string
+	UserID           string
+	PolicyVersion    string
+	DataVersion      string
+	DependencyStatus string
+	ItemID           string
+
+	AfterGeneratedAt time.Time
+	AfterID          string
+}
+
+// decisionFilterWhere matches DecisionFilter against decisions; its
+// parameters are decisionFilterArgs.
+const decisionFilterWhere = `
+	WHERE tenant_id = $1
+		AND generated_at >= $2 AND generated_at < $3
+		AND ($4 = '' OR surface = $4)
+		AND ($5 = '' OR user_id = $5)
+		AND ($6 = '' OR policy_version = $6)
+		AND ($7 = '' OR data_version = $7)
+		AND ($8 = '' OR dependency_status = $8)
+		AND ($9 = '' OR item_ids @> ARRAY[$9])
+		AND (generated_at, decision_id) < ($10::timestamptz, $11::text)
+	ORDER BY generated_at DESC, decision_id DESC
+	LIMIT $12`
+
+func decisionFilterArgs(tenantID string, f DecisionFilter, limit int) []any {
+	afterAt, afterID := f.To, ""
+	if f.AfterID != "" {
+		afterAt, afterID = f.AfterGeneratedAt, f.AfterID
+	}
+	return []any{tenantID, f.From, f.To, f.Surface, f.UserID, f.PolicyVersion, f.DataVersion, f.DependencyStatus, f.ItemID, afterAt, afterID, limit}
+}
+
+func (s *Store) ListDecisions(ctx context.Context, tenantID string, f DecisionFilter, limit int) ([]DecisionSummary, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT decision_id, decision_hash, surface, user_id, policy_version, data_version, dependency_status,
+			experiment_id, variant, COALESCE(array_length(item_ids, 1), 0), generated_at
+		FROM decisions`+decisionFilterWhere, decisionFilterArgs(tenantID, f, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []DecisionSummary{}
+	for rows.Next() {
+		var d DecisionSummary
+		if err := rows.Scan(&d.DecisionID, &d.DecisionHash, &d.Surface, &d.UserID, &d.PolicyVersion, &d.DataVersion, &d.DependencyStatus,
+			&d.ExperimentID, &d.Variant, &d.ItemCount, &d.GeneratedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// ListDecisionRecords is ListDecisions returning full records, including the
+// stored payload, canonical request and retrieval inputs. ItemIDs is left
+// empty; the items are in the payload.
+func (s *Store) ListDecisionRecords(ctx context.Context, tenantID string, f DecisionFilter, limit int) ([]DecisionRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT decision_id, decision_hash, policy_version, data_version, generated_at, payload, request_payload, inputs_payload,
+			experiment_id, variant, surface, user_id, dependency_status
+		FROM decisions`+decisionFilterWhere, decisionFilterArgs(tenantID, f, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []DecisionRecord{}
+	for rows.Next() {
+		rec := DecisionRecord{TenantID: tenantID}
+		if err := rows.Scan(&rec.DecisionID, &rec.DecisionHash, &rec.PolicyVersion, &rec.DataVersion, &rec.GeneratedAt, &rec.Payload, &rec.Request, &rec.Inputs,
+			&rec.ExperimentID, &rec.Variant, &rec.Surface, &rec.UserID, &rec.DependencyStatus); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// EvaluationRecord is an offline policy evaluation. Request is the job
+// definition; Report is written once the job finishes.
+type EvaluationRecord struct {
+	EvaluationID           string     `json:"evaluation_id"`
+	TenantID               string     `json:"tenant_id"`
+	Status                 string     `json:"status"`
+	Surface                string     `json:"surface,omitempty"`
+	BaselinePolicyVersion  string     `json:"baseline_policy_version"`
+	CandidatePolicyVersion string     `json:"candidate_policy_version"`
+	From                   time.Time  `json:"from"`
+	To                     time.Time  `json:"to"`
+	K                      int        `json:"k"`
+	Request                []byte     `json:"-"`
+	Report                 []byte     `json:"-"`
+	Error                  string     `json:"error,omitempty"`
+	CreatedAt              time.Time  `json:"created_at"`
+	CompletedAt            *time.Time `json:"completed_at,omitempty"`
+}
+
+// CreateEvaluation stores a running evaluation. It reports false when the
+// evaluation ID already exists.
+func (s *Store) CreateEvaluation(ctx context.Context, rec EvaluationRecord) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO policy_evaluations (tenant_id, evaluation_id, status, surface, baseline_policy_version, candidate_policy_version, window_from, window_to, k, request_payload, created_at)
+		VALUES ($1, $2, 'running', $3, $4, $5, $6, $7, $8, $9, NOW())
+		ON CONFLICT (tenant_id, evaluation_id) DO NOTHING
+	`, rec.TenantID, rec.EvaluationID, rec.Surface, rec.BaselinePolicyVersion, rec.CandidatePolicyVersion, rec.From, rec.To, rec.K, rec.Request)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// FinishEvaluation moves a running evaluation to its final status.
+func (s *Store) FinishEvaluation(ctx context.Context, tenantID, evaluationID, status string, report []byte, errMsg string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE policy_evaluations
+		SET status = $3, report_payload = $4, error = $5, completed_at = NOW()
+		WHERE tenant_id = $1 AND evaluation_id = $2 AND status = 'running'
+	`, tenantID, evaluationID, status, report, errMsg)
+	return err
+}
+
+// FailStaleEvaluations marks evaluations still running that were created
+// before cutoff as failed with errMsg, and returns how many it marked.
+func (s *Store) FailStaleEvaluations(ctx context.Context, cutoff time.Time, errMsg string) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE policy_evaluations
+		SET status = 'failed', error = $2, completed_at = NOW()
+		WHERE status = 'running' AND created_at < $1
+	`, cutoff, errMsg)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *Store) GetEvaluation(ctx context.Context, tenantID, evaluationID string) (EvaluationRecord, bool, error) {
+	rec := EvaluationRecord{TenantID: tenantID, EvaluationID: evaluationID}
+	var completedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT status, surface, baseline_policy_version, candidate_policy_version, window_from, window_to, k, request_payload, report_payload, error, created_at, completed_at
+		FROM policy_evaluations
+		WHERE tenant_id = $1 AND evaluation_id = $2
+	`, tenantID, evaluationID).Scan(&rec.Status, &rec.Surface, &rec.BaselinePolicyVersion, &rec.CandidatePolicyVersion, &rec.From, &rec.To, &rec.K,
+		&rec.Request, &rec.Report, &rec.Error, &rec.CreatedAt, &completedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return EvaluationRecord{}, false, nil
+	}
+	if err != nil {
+		return EvaluationRecord{}, false, err
+	}
+	if completedAt.Valid {
+		rec.CompletedAt = &completedAt.Time
+	}
+	return rec, true, nil
+}
+
+// ListEvaluations returns evaluations newest first, without their reports.
+func (s *Store) ListEvaluations(ctx context.Context, tenantID string, limit int) ([]EvaluationRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT evaluation_id, status, surface, baseline_policy_version, candidate_policy_version, window_from, window_to, k, error, created_at, completed_at
+		FROM policy_evaluations
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC, evaluation_id
+		LIMIT $2
+	`, tenantID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []EvaluationRecord{}
+	for rows.Next() {
+		rec := EvaluationRecord{TenantID: tenantID}
+		var completedAt sql.NullTime
+		if err := rows.Scan(&rec.EvaluationID, &rec.Status, &rec.Surface, &rec.BaselinePolicyVersion, &rec.CandidatePolicyVersion, &rec.From, &rec.To, &rec.K,
+			&rec.Error, &rec.CreatedAt, &completedAt); err != nil {
+			return nil, err
+		}
+		if completedAt.Valid {
+			rec.CompletedAt = &completedAt.Time
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
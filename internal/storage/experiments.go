@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+var (
+	// ErrExperimentExists is returned when the experiment ID is taken.
+	ErrExperimentExists = errors.New("experiment_exists")
+	// ErrSurfaceHasExperiment is returned when another experiment is already
+	// running on the surface.
+	ErrSurfaceHasExperiment = errors.New("surface_has_running_experiment")
+)
+
+// ExperimentRecord is a stored experiment. Payload is the experiment
+// document the engine reads; it never changes after creation.
+type ExperimentRecord struct {
+	ExperimentID string     `json:"experiment_id"`
+	TenantID     string     `json:"tenant_id"`
+	Surface      string     `json:"surface"`
+	Status       string     `json:"status"`
+	Payload      []byte     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StoppedAt    *time.Time `json:"stopped_at,omitempty"`
+}
+
+// VariantResult aggregates the decisions made under one variant and the
+// feedback they received.
+type VariantResult struct {
+	Variant     string `json:"variant"`
+	Decisions   int64  `json:"decisions"`
+	Impressions int64  `json:"impressions"`
+	Clicks      int64  `json:"clicks"`
+	Conversions int64  `json:"conversions"`
+}
+
+// CreateExperiment stores a running experiment. At most one experiment runs
+// per (tenant, surface).
+func (s *Store) CreateExperiment(ctx context.Context, rec ExperimentRecord) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO experiments (tenant_id, experiment_id, surface, status, payload, created_at)
+		VALUES ($1, $2, $3, 'running', $4, NOW())
+	`, rec.TenantID, rec.ExperimentID, rec.Surface, rec.Payload)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		if pgErr.ConstraintName == "experiments_pkey" {
+			return ErrExperimentExists
+		}
+		return ErrSurfaceHasExperiment
+	}
+	return err
+}
+
+func (s *Store) GetExperiment(ctx context.Context, tenantID, experimentID string) (ExperimentRecord, bool, error) {
+	rec := ExperimentRecord{TenantID: tenantID, ExperimentID: experimentID}
+	var stoppedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT surface, status, payload, created_at, stopped_at
+		FROM experiments
+		WHERE tenant_id = $1 AND experiment_id = $2
+	`, tenantID, experimentID).Scan(&rec.Surface, &rec.Status, &rec.Payload, &rec.CreatedAt, &stoppedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ExperimentRecord{}, false, nil
+	}
+	if err != nil {
+		return ExperimentRecord{}, false, err
+	}
+	if stoppedAt.Valid {
+		rec.StoppedAt = &stoppedAt.Time
+	}
+	return rec, true, nil
+}
+
+func (s *Store) ListExperiments(ctx context.Context, tenantID string) ([]ExperimentRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT experiment_id, surface, status, payload, created_at, stopped_at
+		FROM experiments
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC, experiment_id
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ExperimentRecord{}
+	for rows.Next() {
+		rec := ExperimentRecord{TenantID: tenantID}
+		var stoppedAt sql.NullTime
+		if err := rows.Scan(&rec.ExperimentID, &rec.Surface, &rec.Status, &rec.Payload, &rec.CreatedAt, &stoppedAt); err != nil {
+			return nil, err
+		}
+		if stoppedAt.Valid {
+			rec.StoppedAt = &stoppedAt.Time
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// StopExperiment ends a running experiment. Stopping is final; stopping an
+// already stopped experiment is a no-op.
+func (s *Store) StopExperiment(ctx context.Context, tenantID, experimentID string) (ExperimentRecord, bool, error) {
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE experiments
+		SET status = 'stopped', stopped_at = NOW()
+		WHERE tenant_id = $1 AND experiment_id = $2 AND status = 'running'
+	`, tenantID, experimentID); err != nil {
+		return ExperimentRecord{}, false, err
+	}
+	return s.GetExperiment(ctx, tenantID, experimentID)
+}
+
+// ActiveExperiment returns the payload of the experiment running on surface.
+func (s *Store) ActiveExperiment(ctx context.Context, tenantID, surface string) ([]byte, bool, error) {
+	var payload []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT payload
+		FROM experiments
+		WHERE tenant_id = $1 AND surface = $2 AND status = 'running'
+	`, tenantID, surface).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return payload, true, nil
+}
+
+// ExperimentResults breaks an experiment's decisions and their feedback down
+// by variant.
+func (s *Store) ExperimentResults(ctx context.Context, tenantID, experimentID string) ([]VariantResult, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.variant,
+			COUNT(DISTINCT d.decision_id),
+			COUNT(f.event_id) FILTER (WHERE f.event_type = 'impression'),
+			COUNT(f.event_id) FILTER (WHERE f.event_type = 'click'),
+			COUNT(f.event_id) FILTER (WHERE f.event_type = 'conversion')
+		FROM decisions d
+		LEFT JOIN feedback_events f ON f.decision_id = d.decision_id AND f.tenant_id = d.tenant_id
+		WHERE d.tenant_id = $1 AND d.experiment_id = $2
+		GROUP BY d.variant
+		ORDER BY d.variant
+	`, tenantID, experimentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []VariantResult{}
+	for rows.Next() {
+		var res VariantResult
+		if err := rows.Scan(&res.Variant, &res.Decisions, &res.Impressions, &res.Clicks, &res.Conversions); err != nil {
+			return nil, err
+		}
+		out = append(out, res)
+	}
+	return out, rows.Err()
+}
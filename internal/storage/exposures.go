@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Exposure ledger sources. A served item is recorded when the decision is
+// stored; an impression for the same decision upgrades it to confirmed.
+const (
+	ExposureServed     = "served"
+	ExposureImpression = "impression"
+)
+
+// ExposureCount is how often one item was exposed to a user. Each decision
+// counts once per item.
+type ExposureCount struct {
+	ItemID      string    `json:"item_id"`
+	Exposures   int       `json:"exposures"`
+	Impressions int       `json:"impressions"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+func recordDecisionExposures(ctx context.Context, tx *sql.Tx, tenantID, userID, surface, decisionID string, itemIDs []string, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO exposure_events (tenant_id, user_id, item_id, decision_id, surface, source, occurred_at)
+		SELECT $1, $2, item_id, $4, $5, $6, $7
+		FROM unnest($3::text[]) AS item_id
+		ON CONFLICT (tenant_id, user_id, item_id, decision_id) DO NOTHING
+	`, tenantID, userID, itemIDs, decisionID, surface, ExposureServed, at)
+	return err
+}
+
+// recordImpressionExposure attributes an impression to the user the decision
+// was made for. Impressions on decisions without a user are not tracked.
+func recordImpressionExposure(ctx context.Context, tx *sql.Tx, rec FeedbackRecord) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO exposure_events (tenant_id, user_id, item_id, decision_id, surface, source, occurred_at)
+		SELECT d.tenant_id, d.user_id, $3, d.decision_id, d.surface, $4, $5
+		FROM decisions d
+		WHERE d.tenant_id = $1 AND d.decision_id = $2 AND d.user_id <> ''
+		ON CONFLICT (tenant_id, user_id, item_id, decision_id)
+		DO UPDATE SET source = EXCLUDED.source, occurred_at = EXCLUDED.occurred_at
+	`, rec.TenantID, rec.DecisionID, rec.ItemID, ExposureImpression, rec.OccurredAt)
+	return err
+}
+
+// CountExposures returns per-item exposure counts for a user since the given
+// time. With impressionsOnly only confirmed impressions count. Items never
+// exposed are absent from the result.
+func (s *Store) CountExposures(ctx context.Context, tenantID, userID string, itemIDs []string, since time.Time, impressionsOnly bool) (map[string]int, error) {
+	out := map[string]int{}
+	if len(itemIDs) == 0 {
+		return out, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT item_id, COUNT(*)
+		FROM exposure_events
+		WHERE tenant_id = $1 AND user_id = $2 AND item_id = ANY($3) AND occurred_at >= $4
+			AND (NOT $5 OR source = $6)
+		GROUP BY item_id
+	`, tenantID, userID, itemIDs, since, impressionsOnly, ExposureImpression)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var itemID string
+		var n int
+		if err := rows.Scan(&itemID, &n); err != nil {
+			return nil, err
+		}
+		out[itemID] = n
+	}
+	return out, rows.Err()
+}
+
+// ListUserExposures summarises a user's exposures in [from, to), most exposed
+// first.
+func (s *Store) ListUserExposures(ctx context.Context, tenantID, userID, surface string, from, to time.Time, limit int) ([]ExposureCount, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT item_id, COUNT(*), COUNT(*) FILTER (WHERE source = $6), MAX(occurred_at)
+		FROM exposure_events
+		WHERE tenant_id = $1 AND user_id = $2 AND occurred_at >= $3 AND occurred_at < $4
+			AND ($5 = '' OR surface = $5)
+		GROUP BY item_id
+		ORDER BY 2 DESC, 1
+		LIMIT $7
+	`, tenantID, userID, from, to, surface, ExposureImpression, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ExposureCount{}
+	for rows.Next() {
+		var c ExposureCount
+		if err := rows.Scan(&c.ItemID, &c.Exposures, &c.Impressions, &c.LastSeenAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
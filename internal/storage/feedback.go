@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// ErrDuplicateFeedback is returned when the same actor reports the same
+// event type for the same decision item twice.
+var ErrDuplicateFeedback = errors.New("duplicate_feedback")
+
+type FeedbackRecord struct {
+	EventID    string    `json:"event_id"`
+	TenantID   string    `json:"tenant_id"`
+	DecisionID string    `json:"decision_id"`
+	ItemID     string    `json:"item_id"`
+	EventType  string    `json:"event_type"`
+	ActorID    string    `json:"actor_id"`
+	Surface    string    `json:"surface"`
+	OccurredAt time.Time `json:"occurred_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type FeedbackAggregate struct {
+	ItemID      string `json:"item_id"`
+	Surface     string `json:"surface"`
+	Variant     string `json:"variant,omitempty"`
+	Impressions int64  `json:"impressions"`
+	Clicks      int64  `json:"clicks"`
+	Conversions int64  `json:"conversions"`
+}
+
+// FeedbackFilter narrows AggregateFeedback. Setting ExperimentID keeps only
+// feedback on that experiment's decisions and splits the rows by variant.
+type FeedbackFilter struct {
+	From         time.Time
+	To           time.Time
+	Surface      string
+	ItemID       string
+	ExperimentID string
+}
+
+// SaveFeedback stores the event and, when outboxPayload is non-empty, queues
+// it for upstream delivery in the same transaction so an accepted event is
+// never lost between the two writes. Impressions also confirm the exposure
+// in the ledger.
+func (s *Store) SaveFeedback(ctx context.Context, rec FeedbackRecord, outboxPayload []byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO feedback_events (event_id, tenant_id, decision_id, item_id, event_type, actor_id, surface, occurred_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+	`, rec.EventID, rec.TenantID, rec.DecisionID, rec.ItemID, rec.EventType, rec.ActorID, rec.Surface, rec.OccurredAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicateFeedback
+	}
+	if err != nil {
+		return err
+	}
+	if rec.EventType == "impression" {
+		if err := recordImpressionExposure(ctx, tx, rec); err != nil {
+			return err
+		}
+	}
+	if len(outboxPayload) > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO feedback_outbox (event_id, tenant_id, payload, status, attempts, next_attempt_at, created_at, updated_at)
+			VALUES ($1, $2, $3, 'pending', 0, NOW(), NOW(), NOW())
+		`, rec.EventID, rec.TenantID, outboxPayload); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) ListDecisionFeedback(ctx context.Context, tenantID, decisionID string) ([]FeedbackRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT event_id, item_id, event_type, actor_id, surface, occurred_at, created_at
+		FROM feedback_events
+		WHERE tenant_id = $1 AND decision_id = $2
+		ORDER BY occurred_at, event_id
+	`, tenantID, decisionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []FeedbackRecord{}
+	for rows.Next() {
+		rec := FeedbackRecord{TenantID: tenantID, DecisionID: decisionID}
+		if err := rows.Scan(&rec.EventID, &rec.ItemID, &rec.EventType, &rec.ActorID, &rec.Surface, &rec.OccurredAt, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) AggregateFeedback(ctx context.Context, tenantID string, f FeedbackFilter) ([]FeedbackAggregate, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT f.item_id, f.surface,
+			CASE WHEN $6 = '' THEN '' ELSE d.variant END,
+			COUNT(*) FILTER (WHERE f.event_type = 'impression'),
+			COUNT(*) FILTER (WHERE f.event_type = 'click'),
+			COUNT(*) FILTER (WHERE f.event_type = 'conversion')
+		FROM feedback_events f
+		JOIN decisions d ON d.decision_id = f.decision_id
+		WHERE f.tenant_id = $1
+			AND f.occurred_at >= $2 AND f.occurred_at < $3
+			AND ($4 = '' OR f.surface = $4)
+			AND ($5 = '' OR f.item_id = $5)
+			AND ($6 = '' OR d.experiment_id = $6)
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3
+	`, tenantID, f.From, f.To, f.Surface, f.ItemID, f.ExperimentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []FeedbackAggregate{}
+	for rows.Next() {
+		var agg FeedbackAggregate
+		if err := rows.Scan(&agg.ItemID, &agg.Surface, &agg.Variant, &agg.Impressions, &agg.Clicks, &agg.Conversions); err != nil {
+			return nil, err
+		}
+		out = append(out, agg)
+	}
+	return out, rows.Err()
+}
+
+// ListFeedbackForDecisions returns the feedback recorded against any of the
+// given decisions.
+func (s *Store) ListFeedbackForDecisions(ctx context.Context, tenantID string, decisionIDs []string) ([]FeedbackRecord, error) {
+	if len(decisionIDs) == 0 {
+		return []FeedbackRecord{}, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT event_id, decision_id, item_id, event_type, actor_id, surface, occurred_at, created_at
+		FROM feedback_events
+		WHERE tenant_id = $1 AND decision_id = ANY($2)
+		ORDER BY decision_id, occurred_at, event_id
+	`, tenantID, decisionIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []FeedbackRecord{}
+	for rows.Next() {
+		rec := FeedbackRecord{TenantID: tenantID}
+		if err := rows.Scan(&rec.EventID, &rec.DecisionID, &rec.ItemID, &rec.EventType, &rec.ActorID, &rec.Surface, &rec.OccurredAt, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// OutboxEntry is one queued feedback delivery.
+type OutboxEntry struct {
+	EventID  string
+	TenantID string
+	Payload  []byte
+	Attempts int
+}
+
+type OutboxStats struct {
+	Pending   int64 `json:"pending"`
+	Delivered int64 `json:"delivered"`
+	Dead      int64 `json:"dead"`
+}
+
+// ClaimFeedbackOutbox leases up to limit due entries. Claimed rows are pushed
+// out by lease so concurrent workers (or a crashed one) never double-send
+// before the lease expires.
+func (s *Store) ClaimFeedbackOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE feedback_outbox
+		SET next_attempt_at = NOW() + $2::interval, updated_at = NOW()
+		WHERE event_id IN (
+			SELECT event_id
+			FROM feedback_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, event_id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING event_id, tenant_id, payload, attempts
+	`, limit, intervalSeconds(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []OutboxEntry{}
+	for rows.Next() {
+		var e OutboxEntry
+		if err := rows.Scan(&e.EventID, &e.TenantID, &e.Payload, &e.Attempts); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) MarkFeedbackDelivered(ctx context.Context, eventID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE feedback_outbox
+		SET status = 'delivered', attempts = attempts + 1, last_error = '', updated_at = NOW()
+		WHERE event_id = $1
+	`, eventID)
+	return err
+}
+
+func (s *Store) MarkFeedbackRetry(ctx context.Context, eventID string, attempts int, next time.Time, lastError string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE feedback_outbox
+		SET attempts = $2, next_attempt_at = $3, last_error = $4, updated_at = NOW()
+		WHERE event_id = $1
+	`, eventID, attempts, next, lastError)
+	return err
+}
+
+func (s *Store) MarkFeedbackDead(ctx context.Context, eventID string, attempts int, lastError string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE feedback_outbox
+		SET status = 'dead', attempts = $2, last_error = $3, updated_at = NOW()
+		WHERE event_id = $1
+	`, eventID, attempts, lastError)
+	return err
+}
+
+func (s *Store) FeedbackOutboxStats(ctx context.Context, tenantID string) (OutboxStats, error) {
+	var st OutboxStats
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE status = 'pending'),
+			COUNT(*) FILTER (WHERE status = 'delivered'),
+			COUNT(*) FILTER (WHERE status = 'dead')
+		FROM feedback_outbox
+		WHERE tenant_id = $1
+	`, tenantID).Scan(&st.Pending, &st.Delivered, &st.Dead)
+	return st, err
+}
+
+func intervalSeconds(d time.Duration) string {
+	secs := int(d.Seconds())
+	if secs <= 0 {
+		secs = 1
+	}
+	return fmt.Sprintf("%d seconds", secs)
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrNoActivation is returned by RollbackActivation when the surface has no
+// activation in effect.
+var ErrNoActivation = errors.New("no_activation")
+
+// PolicyRecord is a published policy version. Document is the GoRules decision
+// model and Fixtures the JSON array of test cases published with it; neither
+// changes after publishing.
+type PolicyRecord struct {
+	TenantID      string    `json:"tenant_id"`
+	PolicyVersion string    `json:"policy_version"`
+	ContentHash   string    `json:"content_hash"`
+	Description   string    `json:"description,omitempty"`
+	Document      []byte    `json:"-"`
+	Fixtures      []byte    `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PolicyActivation points a tenant surface at a policy version from
+// ActivateAt on. Surface "" is the tenant-wide pointer. A rolled back
+// activation keeps its row with CanceledAt set.
+type PolicyActivation struct {
+	ActivationID  string     `json:"activation_id"`
+	TenantID      string     `json:"tenant_id"`
+	Surface       string     `json:"surface"`
+	PolicyVersion string     `json:"policy_version"`
+	ActivateAt    time.Time  `json:"activate_at"`
+	Actor         string     `json:"actor"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CanceledAt    *time.Time `json:"canceled_at,omitempty"`
+}
+
+// SavePolicy publishes an immutable policy version. Like SaveRuleSet it
+// returns the stored hash when the version already exists.
+func (s *Store) SavePolicy(ctx context.Context, rec PolicyRecord) (bool, string, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO policy_versions (tenant_id, policy_version, content_hash, description, document, fixtures, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (tenant_id, policy_version) DO NOTHING
+	`, rec.TenantID, rec.PolicyVersion, rec.ContentHash, rec.Description, rec.Document, rec.Fixtures)
+	if err != nil {
+		return false, "", err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return true, rec.ContentHash, nil
+	}
+	var existing string
+	err = s.db.QueryRowContext(ctx, `
+		SELECT content_hash
+		FROM policy_versions
+		WHERE tenant_id = $1 AND policy_version = $2
+	`, rec.TenantID, rec.PolicyVersion).Scan(&existing)
+	if err != nil {
+		return false, "", err
+	}
+	return false, existing, nil
+}
+
+func (s *Store) GetPolicy(ctx context.Context, tenantID, policyVersion string) (PolicyRecord, bool, error) {
+	rec := PolicyRecord{TenantID: tenantID, PolicyVersion: policyVersion}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT content_hash, description, document, fixtures, created_at
+		FROM policy_versions
+		WHERE tenant_id = $1 AND policy_version = $2
+	`, tenantID, policyVersion).Scan(&rec.ContentHash, &rec.Description, &rec.Document, &rec.Fixtures, &rec.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PolicyRecord{}, false, nil
+	}
+	if err != nil {
+		return PolicyRecord{}, false, err
+	}
+	return rec, true, nil
+}
+
+// ListPolicies returns a tenant's published versions, newest first, without
+// their documents.
+func (s *Store) ListPolicies(ctx context.Context, tenantID string) ([]PolicyRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT policy_version, content_hash, description, created_at
+		FROM policy_versions
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC, policy_version
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []PolicyRecord{}
+	for rows.Next() {
+		rec := PolicyRecord{TenantID: tenantID}
+		if err := rows.Scan(&rec.PolicyVersion, &rec.ContentHash, &rec.Description, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// GetDecisionModel returns the published decision model for a policy
+// version, making the registry a gorules.ModelSource.
+func (s *Store) GetDecisionModel(ctx context.Context, tenantID, policyVersion string) ([]byte, bool, error) {
+	rec, found, err := s.GetPolicy(ctx, tenantID, policyVersion)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return rec.Document, true, nil
+}
+
+// CreateActivation records an activation. Scheduled activations are stored
+// the same way with ActivateAt in the future. Replaying an activation ID is a
+// no-op.
+func (s *Store) CreateActivation(ctx context.Context, rec PolicyActivation) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO policy_activations (tenant_id, activation_id, surface, policy_version, activate_at, actor, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (tenant_id, activation_id) DO NOTHING
+	`, rec.TenantID, rec.ActivationID, rec.Surface, rec.PolicyVersion, rec.ActivateAt, rec.Actor)
+	return err
+}
+
+// ActivePolicyVersion returns the version in effect at the given time on
+// surface: the latest uncanceled activation that has started, preferring the
+// surface's own pointer over the tenant-wide one.
+func (s *Store) ActivePolicyVersion(ctx context.Context, tenantID, surface string, at time.Time) (string, bool, error) {
+	var version string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT policy_version
+		FROM policy_activations
+		WHERE tenant_id = $1 AND surface IN ($2, '') AND activate_at <= $3 AND canceled_at IS NULL
+		ORDER BY surface = $2 DESC, activate_at DESC, created_at DESC
+		LIMIT 1
+	`, tenantID, surface, at).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return version, true, nil
+}
+
+// ListActivations returns a tenant's activation history, newest first,
+// including scheduled and rolled back activations. An empty surface lists
+// every surface.
+func (s *Store) ListActivations(ctx context.Context, tenantID, surface string, limit int) ([]PolicyActivation, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT activation_id, surface, policy_version, activate_at, actor, created_at, canceled_at
+		FROM policy_activations
+		WHERE tenant_id = $1 AND ($2 = '' OR surface = $2)
+		ORDER BY activate_at DESC, created_at DESC
+		LIMIT $3
+	`, tenantID, surface, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []PolicyActivation{}
+	for rows.Next() {
+		rec := PolicyActivation{TenantID: tenantID}
+		var canceledAt sql.NullTime
+		if err := rows.Scan(&rec.ActivationID, &rec.Surface, &rec.PolicyVersion, &rec.ActivateAt, &rec.Actor, &rec.CreatedAt, &canceledAt); err != nil {
+			return nil, err
+		}
+		if canceledAt.Valid {
+			rec.CanceledAt = &canceledAt.Time
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// RollbackActivation cancels the activation in effect on surface's own
+// pointer, along with any not yet started, so the surface immediately falls
+// back to the activation before it (or the tenant-wide pointer). It returns
+// the canceled activation.
+func (s *Store) RollbackActivation(ctx context.Context, tenantID, surface string, at time.Time) (PolicyActivation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return PolicyActivation{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rec := PolicyActivation{TenantID: tenantID, Surface: surface}
+	err = tx.QueryRowContext(ctx, `
+		SELECT activation_id, policy_version, activate_at, actor, created_at
+		FROM policy_activations
+		WHERE tenant_id = $1 AND surface = $2 AND activate_at <= $3 AND canceled_at IS NULL
+		ORDER BY activate_at DESC, created_at DESC
+		LIMIT 1
+		FOR UPDATE
+	`, tenantID, surface, at).Scan(&rec.ActivationID, &rec.PolicyVersion, &rec.ActivateAt, &rec.Actor, &rec.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PolicyActivation{}, ErrNoActivation
+	}
+	if err != nil {
+		return PolicyActivation{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE policy_activations
+		SET canceled_at = $4
+		WHERE tenant_id = $1 AND surface = $2 AND canceled_at IS NULL
+			AND (activation_id = $3 OR activate_at > $4)
+	`, tenantID, surface, rec.ActivationID, at); err != nil {
+		return PolicyActivation{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return PolicyActivation{}, err
+	}
+	rec.CanceledAt = &at
+	return rec, nil
+}
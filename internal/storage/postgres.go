@@ -130,14 +130,75 @@ func (s *Store) PutIdempotency(ctx context.Context, tenantID, endpoint, key stri
 	return err
 }
 
-func (s *Store) SaveDecision(ctx context.Context, decisionID, tenantID, decisionHash, policyVersion, dataVersion string, generatedAt time.Time, payload []byte) error {
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO decisions (decision_id, tenant_id, decision_hash, policy_version, data_version, generated_at, payload)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+// DecisionRecord is one stored decision. Payload holds the exact response
+// bytes for byte-exact replay; Request and Inputs hold the canonical request
+// and upstream snapshot needed to recompute it. ExperimentID and Variant are
+// empty outside experiments. Surface, UserID, DependencyStatus and ItemIDs are
+// promoted out of the payloads so decisions can be listed and filtered.
+type DecisionRecord struct {
+	DecisionID       string
+	TenantID         string
+	DecisionHash     string
+	PolicyVersion    string
+	DataVersion      string
+	GeneratedAt      time.Time
+	Payload          []byte
+	Request          []byte
+	Inputs           []byte
+	ExperimentID     string
+	Variant          string
+	Surface          string
+	UserID           string
+	DependencyStatus string
+	ItemIDs          []string
+}
+
+// SaveDecision stores the decision and, for decisions made for a user, adds
+// its items to the exposure ledger in the same transaction.
+func (s *Store) SaveDecision(ctx context.Context, rec DecisionRecord) error {
+	itemIDs := rec.ItemIDs
+	if itemIDs == nil {
+		itemIDs = []string{}
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO decisions (decision_id, tenant_id, decision_hash, policy_version, data_version, generated_at, payload, request_payload, inputs_payload, experiment_id, variant, surface, user_id, dependency_status, item_ids)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 		ON CONFLICT (decision_id)
-		DO UPDATE SET payload = EXCLUDED.payload, decision_hash = EXCLUDED.decision_hash, policy_version = EXCLUDED.policy_version, data_version = EXCLUDED.data_version, generated_at = EXCLUDED.generated_at
-	`, decisionID, tenantID, decisionHash, policyVersion, dataVersion, generatedAt, payload)
-	return err
+		DO UPDATE SET payload = EXCLUDED.payload, decision_hash = EXCLUDED.decision_hash, policy_version = EXCLUDED.policy_version, data_version = EXCLUDED.data_version, generated_at = EXCLUDED.generated_at, request_payload = EXCLUDED.request_payload, inputs_payload = EXCLUDED.inputs_payload, experiment_id = EXCLUDED.experiment_id, variant = EXCLUDED.variant, surface = EXCLUDED.surface, user_id = EXCLUDED.user_id, dependency_status = EXCLUDED.dependency_status, item_ids = EXCLUDED.item_ids
+	`, rec.DecisionID, rec.TenantID, rec.DecisionHash, rec.PolicyVersion, rec.DataVersion, rec.GeneratedAt, rec.Payload, rec.Request, rec.Inputs, rec.ExperimentID, rec.Variant, rec.Surface, rec.UserID, rec.DependencyStatus, itemIDs)
+	if err != nil {
+		return err
+	}
+	if rec.UserID != "" && len(itemIDs) > 0 {
+		if err := recordDecisionExposures(ctx, tx, rec.TenantID, rec.UserID, rec.Surface, rec.DecisionID, itemIDs, rec.GeneratedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDecisionRecord loads a stored decision. Request and Inputs are nil for
+// decisions written before they were recorded.
+func (s *Store) GetDecisionRecord(ctx context.Context, decisionID, tenantID string) (DecisionRecord, bool, error) {
+	rec := DecisionRecord{DecisionID: decisionID, TenantID: tenantID}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT decision_hash, policy_version, data_version, generated_at, payload, request_payload, inputs_payload, surface, user_id
+		FROM decisions
+		WHERE decision_id = $1 AND tenant_id = $2
+	`, decisionID, tenantID).Scan(&rec.DecisionHash, &rec.PolicyVersion, &rec.DataVersion, &rec.GeneratedAt, &rec.Payload, &rec.Request, &rec.Inputs, &rec.Surface, &rec.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DecisionRecord{}, false, nil
+	}
+	if err != nil {
+		return DecisionRecord{}, false, err
+	}
+	return rec, true, nil
 }
 
 func (s *Store) GetDecisionPayload(ctx context.Context, decisionID, tenantID string) ([]byte, bool, error) {
@@ -197,6 +258,36 @@ func (s *Store) GetApp(ctx context.Context, tenantID, appID string) (App, bool,
 	return App{ID: appID, TenantID: tenantID, Name: name, Blueprint: bp, Version: version, CreatedAt: createdAt, UpdatedAt: updatedAt}, true, nil
 }
 
+// ListApps returns up to limit of a tenant's apps in ID order.
+func (s *Store) ListApps(ctx context.Context, tenantID string, limit int) ([]App, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, blueprint, version, created_at, updated_at
+		FROM apps
+		WHERE tenant_id = $1
+		ORDER BY id
+		LIMIT $2
+	`, tenantID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []App{}
+	for rows.Next() {
+		app := App{TenantID: tenantID}
+		var blueprint []byte
+		if err := rows.Scan(&app.ID, &app.Name, &blueprint, &app.Version, &app.CreatedAt, &app.UpdatedAt); err != nil {
+			return nil, err
+		}
+		app.Blueprint = map[string]any{}
+		if err := json.Unmarshal(blueprint, &app.Blueprint); err != nil {
+			return nil, err
+		}
+		out = append(out, app)
+	}
+	return out, rows.Err()
+}
+
 func (s *Store) UpdateApp(ctx context.Context, app App) error {
 	blueprint, err := json.Marshal(app.Blueprint)
 	if err != nil {
@@ -210,14 +301,55 @@ func (s *Store) UpdateApp(ctx context.Context, app App) error {
 	return err
 }
 
-func (s *Store) SaveMutation(ctx context.Context, mutationID, tenantID, appID, class string, before, after, mutationPayload []byte) error {
+func (s *Store) SaveMutation(ctx context.Context, mutationID, tenantID, appID, class, policyVersion, actorType, actorID string, before, after, mutationPayload []byte) error {
 	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO app_mutations (mutation_id, tenant_id, app_id, mutation_class, before_snapshot, after_snapshot, mutation_payload, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
-	`, mutationID, tenantID, appID, class, before, after, mutationPayload)
+		INSERT INTO app_mutations (mutation_id, tenant_id, app_id, mutation_class, policy_version, actor_type, actor_id, before_snapshot, after_snapshot, mutation_payload, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+	`, mutationID, tenantID, appID, class, policyVersion, actorType, actorID, before, after, mutationPayload)
 	return err
 }
 
+// MutationRecord is an applied app mutation. Before is the app snapshot the
+// mutation was checked against and Payload the mutation request. ActorType
+// is empty for mutations recorded before actors were stored.
+type MutationRecord struct {
+	MutationID    string
+	AppID         string
+	Class         string
+	PolicyVersion string
+	ActorType     string
+	ActorID       string
+	Before        []byte
+	Payload       []byte
+	CreatedAt     time.Time
+}
+
+// ListMutations returns a tenant's mutations created in [from, to), newest
+// first.
+func (s *Store) ListMutations(ctx context.Context, tenantID string, from, to time.Time, limit int) ([]MutationRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT mutation_id, app_id, mutation_class, policy_version, actor_type, actor_id, before_snapshot, mutation_payload, created_at
+		FROM app_mutations
+		WHERE tenant_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at DESC, mutation_id
+		LIMIT $4
+	`, tenantID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []MutationRecord{}
+	for rows.Next() {
+		var rec MutationRecord
+		if err := rows.Scan(&rec.MutationID, &rec.AppID, &rec.Class, &rec.PolicyVersion, &rec.ActorType, &rec.ActorID, &rec.Before, &rec.Payload, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
 func (s *Store) SaveVerifyReport(ctx context.Context, reportID, tenantID, appID string, payload []byte) error {
 	_, err := s.db.ExecContext(ctx, `
 		INSERT INTO verify_reports (report_id, tenant_id, app_id, payload, created_at)
@@ -339,6 +471,149 @@ func (s *Store) initSchema(ctx context.Context) error {
 				payload JSONB NOT NULL,
 				created_at TIMESTAMPTZ NOT NULL
 			)`,
+		`CREATE TABLE IF NOT EXISTS rule_sets (
+			tenant_id TEXT NOT NULL,
+			policy_version TEXT NOT NULL,
+			rule_set_hash TEXT NOT NULL,
+			payload BYTEA NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (tenant_id, policy_version)
+		)`,
+		`CREATE TABLE IF NOT EXISTS feedback_events (
+			event_id TEXT PRIMARY KEY,
+			tenant_id TEXT NOT NULL,
+			decision_id TEXT NOT NULL REFERENCES decisions (decision_id),
+			item_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			actor_id TEXT NOT NULL,
+			surface TEXT NOT NULL,
+			occurred_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			UNIQUE (tenant_id, decision_id, item_id, event_type, actor_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS feedback_events_tenant_decision_idx ON feedback_events (tenant_id, decision_id)`,
+		`CREATE INDEX IF NOT EXISTS feedback_events_tenant_occurred_idx ON feedback_events (tenant_id, occurred_at)`,
+		`CREATE TABLE IF NOT EXISTS feedback_outbox (
+			event_id TEXT PRIMARY KEY REFERENCES feedback_events (event_id),
+			tenant_id TEXT NOT NULL,
+			payload BYTEA NOT NULL,
+			status TEXT NOT NULL,
+			attempts INT NOT NULL,
+			next_attempt_at TIMESTAMPTZ NOT NULL,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS feedback_outbox_due_idx ON feedback_outbox (status, next_attempt_at)`,
+		`CREATE TABLE IF NOT EXISTS shadow_decisions (
+			shadow_id TEXT PRIMARY KEY,
+			tenant_id TEXT NOT NULL,
+			request_id TEXT NOT NULL,
+			surface TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			policy_version TEXT NOT NULL,
+			mismatch BOOLEAN NOT NULL,
+			divergence DOUBLE PRECISION NOT NULL,
+			request_payload BYTEA NOT NULL,
+			legacy_payload BYTEA NOT NULL,
+			engine_payload BYTEA NOT NULL,
+			diff_payload BYTEA NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS shadow_decisions_tenant_created_idx ON shadow_decisions (tenant_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS gorse_snapshots (
+			tenant_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			data_version TEXT NOT NULL,
+			payload BYTEA NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (tenant_id, user_id, data_version)
+		)`,
+		`CREATE TABLE IF NOT EXISTS catalog_versions (
+			tenant_id TEXT PRIMARY KEY,
+			revision BIGINT NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS catalog_item_revisions (
+			tenant_id TEXT NOT NULL,
+			item_id TEXT NOT NULL,
+			revision BIGINT NOT NULL,
+			base_score DOUBLE PRECISION NOT NULL,
+			tags BYTEA NOT NULL,
+			deleted BOOLEAN NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (tenant_id, item_id, revision)
+		)`,
+		`CREATE TABLE IF NOT EXISTS catalog_tag_revisions (
+			tenant_id TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			revision BIGINT NOT NULL,
+			parent TEXT NOT NULL,
+			description TEXT NOT NULL,
+			deleted BOOLEAN NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (tenant_id, tag, revision)
+		)`,
+		`CREATE TABLE IF NOT EXISTS experiments (
+			tenant_id TEXT NOT NULL,
+			experiment_id TEXT NOT NULL,
+			surface TEXT NOT NULL,
+			status TEXT NOT NULL,
+			payload BYTEA NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			stopped_at TIMESTAMPTZ,
+			CONSTRAINT experiments_pkey PRIMARY KEY (tenant_id, experiment_id)
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS experiments_running_surface_idx ON experiments (tenant_id, surface) WHERE status = 'running'`,
+		`CREATE TABLE IF NOT EXISTS exposure_events (
+			tenant_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			item_id TEXT NOT NULL,
+			decision_id TEXT NOT NULL,
+			surface TEXT NOT NULL,
+			source TEXT NOT NULL,
+			occurred_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (tenant_id, user_id, item_id, decision_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS exposure_events_user_occurred_idx ON exposure_events (tenant_id, user_id, occurred_at)`,
+		`CREATE TABLE IF NOT EXISTS policy_evaluations (
+			tenant_id TEXT NOT NULL,
+			evaluation_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			surface TEXT NOT NULL,
+			baseline_policy_version TEXT NOT NULL,
+			candidate_policy_version TEXT NOT NULL,
+			window_from TIMESTAMPTZ NOT NULL,
+			window_to TIMESTAMPTZ NOT NULL,
+			k INTEGER NOT NULL,
+			request_payload BYTEA NOT NULL,
+			report_payload BYTEA,
+			error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL,
+			completed_at TIMESTAMPTZ,
+			PRIMARY KEY (tenant_id, evaluation_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS policy_versions (
+			tenant_id TEXT NOT NULL,
+			policy_version TEXT NOT NULL,
+			content_hash TEXT NOT NULL,
+			description TEXT NOT NULL,
+			document BYTEA NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (tenant_id, policy_version)
+		)`,
+		`CREATE TABLE IF NOT EXISTS policy_activations (
+			tenant_id TEXT NOT NULL,
+			activation_id TEXT NOT NULL,
+			surface TEXT NOT NULL,
+			policy_version TEXT NOT NULL,
+			activate_at TIMESTAMPTZ NOT NULL,
+			actor TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			canceled_at TIMESTAMPTZ,
+			PRIMARY KEY (tenant_id, activation_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS policy_activations_surface_idx ON policy_activations (tenant_id, surface, activate_at DESC) WHERE canceled_at IS NULL`,
 	}
 
 	for _, stmt := range stmts {
@@ -371,6 +646,36 @@ func (s *Store) initSchema(ctx context.Context) error {
 				ALTER COLUMN response_body TYPE BYTEA USING convert_to(response_body::text, 'UTF8');
 			END IF;
 		END $$`,
+		`ALTER TABLE decisions ADD COLUMN IF NOT EXISTS request_payload BYTEA`,
+		`ALTER TABLE decisions ADD COLUMN IF NOT EXISTS inputs_payload BYTEA`,
+		`ALTER TABLE decisions ADD COLUMN IF NOT EXISTS experiment_id TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE decisions ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS decisions_experiment_idx ON decisions (tenant_id, experiment_id, variant) WHERE experiment_id <> ''`,
+		`ALTER TABLE decisions ADD COLUMN IF NOT EXISTS surface TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE decisions ADD COLUMN IF NOT EXISTS user_id TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE decisions ADD COLUMN IF NOT EXISTS dependency_status TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE decisions ADD COLUMN IF NOT EXISTS item_ids TEXT[] NOT NULL DEFAULT '{}'`,
+		// Every stored decision has a dependency_status, so an empty one marks
+		// a row written before the columns were promoted. The partial index
+		// holds only those rows, so once backfilled the startup check reads an
+		// empty index instead of scanning the table.
+		`CREATE INDEX IF NOT EXISTS decisions_unpromoted_idx ON decisions (decision_id) WHERE dependency_status = ''`,
+		`UPDATE decisions d
+		SET dependency_status = COALESCE(p.doc->>'dependency_status', 'ok'),
+			item_ids = ARRAY(SELECT jsonb_array_elements(p.doc->'items')->>'item_id'),
+			surface = COALESCE(convert_from(d.request_payload, 'UTF8')::jsonb->>'surface', ''),
+			user_id = COALESCE(convert_from(d.request_payload, 'UTF8')::jsonb->>'user_id', '')
+		FROM (SELECT decision_id, convert_from(payload, 'UTF8')::jsonb AS doc FROM decisions WHERE dependency_status = '') p
+		WHERE d.decision_id = p.decision_id`,
+		`CREATE INDEX IF NOT EXISTS decisions_tenant_generated_idx ON decisions (tenant_id, generated_at DESC, decision_id DESC)`,
+		`CREATE INDEX IF NOT EXISTS decisions_tenant_surface_generated_idx ON decisions (tenant_id, surface, generated_at DESC, decision_id DESC)`,
+		`CREATE INDEX IF NOT EXISTS decisions_tenant_user_generated_idx ON decisions (tenant_id, user_id, generated_at DESC, decision_id DESC)`,
+		`CREATE INDEX IF NOT EXISTS decisions_item_ids_idx ON decisions USING GIN (item_ids)`,
+		`ALTER TABLE app_mutations ADD COLUMN IF NOT EXISTS policy_version TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE policy_versions ADD COLUMN IF NOT EXISTS fixtures BYTEA NOT NULL DEFAULT '[]'::bytea`,
+		`ALTER TABLE app_mutations ADD COLUMN IF NOT EXISTS actor_type TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE app_mutations ADD COLUMN IF NOT EXISTS actor_id TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS app_mutations_tenant_created_idx ON app_mutations (tenant_id, created_at DESC)`,
 	}
 	for _, stmt := range migrations {
 		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
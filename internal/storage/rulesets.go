@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// SaveRuleSet stores an immutable rule set document. When a rule set already
+// exists for (tenant, policy_version) nothing is written and the stored hash
+// is returned so callers can distinguish a replayed publish from a conflict.
+func (s *Store) SaveRuleSet(ctx context.Context, tenantID, policyVersion, ruleSetHash string, payload []byte) (bool, string, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO rule_sets (tenant_id, policy_version, rule_set_hash, payload, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (tenant_id, policy_version) DO NOTHING
+	`, tenantID, policyVersion, ruleSetHash, payload)
+	if err != nil {
+		return false, "", err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return true, ruleSetHash, nil
+	}
+	var existing string
+	err = s.db.QueryRowContext(ctx, `
+		SELECT rule_set_hash
+		FROM rule_sets
+		WHERE tenant_id = $1 AND policy_version = $2
+	`, tenantID, policyVersion).Scan(&existing)
+	if err != nil {
+		return false, "", err
+	}
+	return false, existing, nil
+}
+
+func (s *Store) GetRuleSet(ctx context.Context, tenantID, policyVersion string) ([]byte, bool, error) {
+	payload, _, found, err := s.GetRuleSetWithHash(ctx, tenantID, policyVersion)
+	return payload, found, err
+}
+
+// GetRuleSetWithHash is GetRuleSet also returning the hash stored with the
+// rule set, which for older rule sets is under an earlier hash version.
+func (s *Store) GetRuleSetWithHash(ctx context.Context, tenantID, policyVersion string) ([]byte, string, bool, error) {
+	var payload []byte
+	var hash string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT payload, rule_set_hash
+		FROM rule_sets
+		WHERE tenant_id = $1 AND policy_version = $2
+	`, tenantID, policyVersion).Scan(&payload, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", false, nil
+	}
+	if err != nil {
+		return nil, "", false, err
+	}
+	return payload, hash, true, nil
+}
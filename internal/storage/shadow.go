@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// ShadowRecord pairs a mirrored legacy decision with the engine result for
+// the same request.
+type ShadowRecord struct {
+	ShadowID      string    `json:"shadow_id"`
+	TenantID      string    `json:"tenant_id"`
+	RequestID     string    `json:"request_id"`
+	Surface       string    `json:"surface"`
+	UserID        string    `json:"user_id"`
+	PolicyVersion string    `json:"policy_version"`
+	Mismatch      bool      `json:"mismatch"`
+	Divergence    float64   `json:"divergence"`
+	Request       []byte    `json:"-"`
+	Legacy        []byte    `json:"-"`
+	Engine        []byte    `json:"-"`
+	Diff          []byte    `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type ShadowParityRow struct {
+	Surface        string  `json:"surface"`
+	PolicyVersion  string  `json:"policy_version"`
+	Total          int64   `json:"total"`
+	Mismatches     int64   `json:"mismatches"`
+	MismatchRate   float64 `json:"mismatch_rate"`
+	MeanDivergence float64 `json:"mean_divergence"`
+}
+
+// SaveShadowDecision upserts by shadow_id so a re-mirrored legacy request
+// replaces its earlier comparison instead of being double counted.
+func (s *Store) SaveShadowDecision(ctx context.Context, rec ShadowRecord) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO shadow_decisions (shadow_id, tenant_id, request_id, surface, user_id, policy_version, mismatch, divergence, request_payload, legacy_payload, engine_payload, diff_payload, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (shadow_id)
+		DO UPDATE SET policy_version = EXCLUDED.policy_version, mismatch = EXCLUDED.mismatch, divergence = EXCLUDED.divergence,
+			legacy_payload = EXCLUDED.legacy_payload, engine_payload = EXCLUDED.engine_payload, diff_payload = EXCLUDED.diff_payload, created_at = EXCLUDED.created_at
+	`, rec.ShadowID, rec.TenantID, rec.RequestID, rec.Surface, rec.UserID, rec.PolicyVersion, rec.Mismatch, rec.Divergence, rec.Request, rec.Legacy, rec.Engine, rec.Diff, rec.CreatedAt)
+	return err
+}
+
+func (s *Store) ShadowParity(ctx context.Context, tenantID string, from, to time.Time) ([]ShadowParityRow, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT surface, policy_version, COUNT(*), COUNT(*) FILTER (WHERE mismatch), COALESCE(AVG(divergence), 0)
+		FROM shadow_decisions
+		WHERE tenant_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY surface, policy_version
+		ORDER BY surface, policy_version
+	`, tenantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ShadowParityRow{}
+	for rows.Next() {
+		var row ShadowParityRow
+		if err := rows.Scan(&row.Surface, &row.PolicyVersion, &row.Total, &row.Mismatches, &row.MeanDivergence); err != nil {
+			return nil, err
+		}
+		if row.Total > 0 {
+			row.MismatchRate = float64(row.Mismatches) / float64(row.Total)
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// WorstShadowDecisions returns mismatched comparisons ordered by divergence.
+func (s *Store) WorstShadowDecisions(ctx context.Context, tenantID, surface string, from, to time.Time, limit int) ([]ShadowRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT shadow_id, request_id, surface, user_id, policy_version, mismatch, divergence, legacy_payload, engine_payload, diff_payload, created_at
+		FROM shadow_decisions
+		WHERE tenant_id = $1 AND mismatch AND created_at >= $2 AND created_at < $3 AND ($4 = '' OR surface = $4)
+		ORDER BY divergence DESC, created_at DESC, shadow_id
+		LIMIT $5
+	`, tenantID, from, to, surface, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ShadowRecord{}
+	for rows.Next() {
+		rec := ShadowRecord{TenantID: tenantID}
+		if err := rows.Scan(&rec.ShadowID, &rec.RequestID, &rec.Surface, &rec.UserID, &rec.PolicyVersion, &rec.Mismatch, &rec.Divergence, &rec.Legacy, &rec.Engine, &rec.Diff, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
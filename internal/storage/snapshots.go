@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// PutGorseSnapshot stores the first Gorse response seen for (tenant, user,
+// data_version) and returns whichever snapshot is stored afterwards, so
+// concurrent writers converge on one retrieval input.
+func (s *Store) PutGorseSnapshot(ctx context.Context, tenantID, userID, dataVersion string, payload []byte) ([]byte, error) {
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO gorse_snapshots (tenant_id, user_id, data_version, payload, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (tenant_id, user_id, data_version) DO NOTHING
+	`, tenantID, userID, dataVersion, payload); err != nil {
+		return nil, err
+	}
+	stored, ok, err := s.GetGorseSnapshot(ctx, tenantID, userID, dataVersion)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("gorse snapshot missing after insert")
+	}
+	return stored, nil
+}
+
+func (s *Store) GetGorseSnapshot(ctx context.Context, tenantID, userID, dataVersion string) ([]byte, bool, error) {
+	var payload []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT payload
+		FROM gorse_snapshots
+		WHERE tenant_id = $1 AND user_id = $2 AND data_version = $3
+	`, tenantID, userID, dataVersion).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return payload, true, nil
+}
+
+// ReplaceGorseSnapshot overwrites the snapshot for (tenant, user,
+// data_version) only if it still holds prev, and returns whichever snapshot
+// is stored afterwards, so concurrent writers converge like PutGorseSnapshot.
+func (s *Store) ReplaceGorseSnapshot(ctx context.Context, tenantID, userID, dataVersion string, prev, payload []byte) ([]byte, error) {
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE gorse_snapshots
+		SET payload = $5
+		WHERE tenant_id = $1 AND user_id = $2 AND data_version = $3 AND payload = $4
+	`, tenantID, userID, dataVersion, prev, payload); err != nil {
+		return nil, err
+	}
+	stored, ok, err := s.GetGorseSnapshot(ctx, tenantID, userID, dataVersion)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("gorse snapshot missing after update")
+	}
+	return stored, nil
+}